@@ -0,0 +1,225 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/utils"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// apiPrefix is where the current version of the json API is served.
+const apiPrefix = "/api/v1"
+
+// apiProject is a Project as seen by the json API.
+type apiProject struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	CreationDate time.Time `json:"creationDate"`
+}
+
+func toAPIProject(p projects.Project) apiProject {
+	return apiProject{
+		ID:           p.ID,
+		Name:         p.Name,
+		Description:  p.Description,
+		CreationDate: p.CreationDate,
+	}
+}
+
+// apiProjectRequest holds the fields of the requests creating or replacing
+// a project, the others can't be set.
+type apiProjectRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// apiProjectPatch holds the fields of a PATCH request, the ones left out
+// are not changed.
+type apiProjectPatch struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+// apiHandler returns an APIHandler for fn, translating the errors like
+// appHandler does.
+// Browsers can't change anything from other sites.
+func apiHandler(fn utils.APIHandler) utils.APIHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if utils.CrossSiteChange(r) {
+			return utils.NewError(http.StatusForbidden, "cross-site request refused", nil)
+		}
+		return httpError(fn(w, r))
+	}
+}
+
+func (a *app) apiRoutes(mux *http.ServeMux) {
+	mux.Handle(apiPrefix+"/projects", apiHandler(a.apiProjectsHandler))
+	mux.Handle(apiPrefix+"/projects/{project}", apiHandler(a.apiProjectHandler))
+	mux.Handle(apiPrefix+"/projects/{project}/query", apiHandler(a.apiQueryHandler))
+	mux.Handle(apiPrefix+"/", apiHandler(func(w http.ResponseWriter, r *http.Request) error {
+		return utils.NotFound(errors.New("no such endpoint: " + r.URL.Path))
+	}))
+}
+
+// decodeJSON decodes the body of r in v, refusing unknown fields.
+func decodeJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err != nil {
+		return utils.BadRequest(errors.New("invalid json body: " + err.Error()))
+	}
+	return nil
+}
+
+func apiProjectURL(p projects.Project) string {
+	return apiPrefix + "/projects/" + url.PathEscape(p.ID)
+}
+
+// apiPathProject returns the project in the path of r, given by its ID or,
+// as the clients written before the IDs do, by its name.
+func (a *app) apiPathProject(r *http.Request) (projects.Project, error) {
+	ref := r.PathValue("project")
+	if projects.ValidID(ref) {
+		prj, err := a.projects.ByID(ref)
+		if !errors.Is(err, projects.ErrNotFound) {
+			return prj, err
+		}
+	}
+	return a.projects.Get(ref)
+}
+
+func (a *app) apiProjectsHandler(w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		prjs := a.visibleProjects(r)
+		res := make([]apiProject, 0, len(prjs))
+		for _, p := range prjs {
+			res = append(res, toAPIProject(p))
+		}
+		return utils.WriteJSON(w, http.StatusOK, res)
+	case "POST":
+		var req apiProjectRequest
+		err := decodeJSON(r, &req)
+		if err != nil {
+			return err
+		}
+		err = a.saveProject(ownedProject(r, projects.Project{
+			Name:        req.Name,
+			Description: req.Description,
+		}))
+		if err != nil {
+			return err
+		}
+		prj, err := a.projects.Get(req.Name)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Location", apiProjectURL(prj))
+		return utils.WriteJSON(w, http.StatusCreated, toAPIProject(prj))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		return utils.MethodNotAllowed(r.Method)
+	}
+}
+
+func (a *app) apiProjectHandler(w http.ResponseWriter, r *http.Request) error {
+	// reading needs any role, changing the project needs the owners.
+	var role projects.Role
+	switch r.Method {
+	case "GET":
+		role = projects.Viewer
+	case "PUT", "PATCH", "DELETE":
+		role = projects.Owner
+	default:
+		w.Header().Set("Allow", "GET, PUT, PATCH, DELETE")
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, err := a.apiPathProject(r)
+	if err == nil {
+		err = authorize(r, prj, role)
+	}
+	if err != nil {
+		return err
+	}
+	switch r.Method {
+	case "GET":
+		return utils.WriteJSON(w, http.StatusOK, toAPIProject(prj))
+	case "PUT":
+		var req apiProjectRequest
+		err = decodeJSON(r, &req)
+		if err != nil {
+			return err
+		}
+		return a.apiUpdateProject(w, prj, req.Name, req.Description)
+	case "PATCH":
+		var req apiProjectPatch
+		err = decodeJSON(r, &req)
+		if err != nil {
+			return err
+		}
+		name, description := prj.Name, prj.Description
+		if req.Name != nil {
+			name = *req.Name
+		}
+		if req.Description != nil {
+			description = *req.Description
+		}
+		return a.apiUpdateProject(w, prj, name, description)
+	default: // DELETE, the methods left are refused above.
+		err = a.deleteProject(prj)
+		if err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+// apiUpdateProject sets the name and the description of prj together and
+// answers with the updated project.
+func (a *app) apiUpdateProject(w http.ResponseWriter, prj projects.Project, name, description string) error {
+	err := a.updateProject(projects.Project{ID: prj.ID, Name: name, Description: description})
+	if err != nil {
+		return err
+	}
+	prj, err = a.projects.ByID(prj.ID)
+	if err != nil {
+		return err
+	}
+	return utils.WriteJSON(w, http.StatusOK, toAPIProject(prj))
+}
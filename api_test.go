@@ -0,0 +1,119 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// apiRequest sends a request to h and decodes the json answer in v.
+func apiRequest(t *testing.T, h http.Handler, method, path, body string, v interface{}) int {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if v != nil {
+		if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+			t.Errorf("%v %v: error decoding: %v\n", method, path, err)
+		}
+	}
+	return w.Code
+}
+
+func TestAPIProjects(t *testing.T) {
+	h := loggedIn(t, newApp(projects.NewMemoryStore(), t.TempDir()), "mauro")
+
+	var list []apiProject
+	if code := apiRequest(t, h, "GET", "/api/v1/projects", "", &list); code != http.StatusOK || len(list) != 0 {
+		t.Errorf("Expected empty list, got %v %v", code, list)
+	}
+	var p apiProject
+	code := apiRequest(t, h, "POST", "/api/v1/projects", `{"name":"first","description":"one"}`, &p)
+	if code != http.StatusCreated || p.Name != "first" || p.ID == "" {
+		t.Errorf("Error creating: %v %+v", code, p)
+	}
+	var e utils.ErrorBody
+	if code := apiRequest(t, h, "POST", "/api/v1/projects", `{"name":"first"}`, &e); code != http.StatusConflict || e.Status != code {
+		t.Errorf("Expected conflict, got %v %+v", code, e)
+	}
+	if code := apiRequest(t, h, "POST", "/api/v1/projects", `{"name":"../x"}`, &e); code != http.StatusBadRequest {
+		t.Errorf("Expected bad request, got %v %+v", code, e)
+	}
+	if code := apiRequest(t, h, "POST", "/api/v1/projects", `{"nome":"x"}`, &e); code != http.StatusBadRequest {
+		t.Errorf("Expected bad request for unknown fields, got %v %+v", code, e)
+	}
+	path := "/api/v1/projects/" + p.ID
+	if code := apiRequest(t, h, "GET", path, "", &p); code != http.StatusOK || p.Description != "one" {
+		t.Errorf("Error getting: %v %+v", code, p)
+	}
+	if code := apiRequest(t, h, "GET", "/api/v1/projects/first", "", &p); code != http.StatusOK || p.Description != "one" {
+		t.Errorf("Error getting by name: %v %+v", code, p)
+	}
+	if code := apiRequest(t, h, "PATCH", path, `{"description":"uno"}`, &p); code != http.StatusOK || p.Name != "first" || p.Description != "uno" {
+		t.Errorf("Error patching: %v %+v", code, p)
+	}
+	if code := apiRequest(t, h, "PUT", path, `{"name":"second","description":"due"}`, &p); code != http.StatusOK || p.Name != "second" || p.Description != "due" || path != "/api/v1/projects/"+p.ID {
+		t.Errorf("Error putting: %v %+v", code, p)
+	}
+	if code := apiRequest(t, h, "PUT", path, `{"name":"second","id":"x"}`, &e); code != http.StatusBadRequest {
+		t.Errorf("Expected bad request for a read-only field, got %v %+v", code, e)
+	}
+	if code := apiRequest(t, h, "GET", path, "", &p); code != http.StatusOK || p.Name != "second" {
+		t.Errorf("the ID should still find the project after rename: %v %+v", code, p)
+	}
+	if code := apiRequest(t, h, "GET", "/api/v1/projects/first", "", &e); code != http.StatusNotFound {
+		t.Errorf("Expected not found after rename, got %v %+v", code, e)
+	}
+	if code := apiRequest(t, h, "POST", path, "", &e); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected method not allowed, got %v %+v", code, e)
+	}
+	if code := apiRequest(t, h, "DELETE", path, "", nil); code != http.StatusNoContent {
+		t.Errorf("Error deleting: %v", code)
+	}
+	if code := apiRequest(t, h, "DELETE", path, "", &e); code != http.StatusNotFound {
+		t.Errorf("Expected not found deleting twice, got %v %+v", code, e)
+	}
+	r := httptest.NewRequest("POST", "/api/v1/projects", strings.NewReader(`{"name":"evil"}`))
+	r.Header.Set("Origin", "http://evil.example")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "cross-site") {
+		t.Errorf("Expected cross-site request refused, got %v %v", w.Code, w.Body)
+	}
+	if code := apiRequest(t, h, "GET", "/api/v1/nothing", "", &e); code != http.StatusNotFound {
+		t.Errorf("Expected not found, got %v %+v", code, e)
+	}
+}
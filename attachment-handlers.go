@@ -0,0 +1,173 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"github.com/scompo/data-management/attachments"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/utils"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// attachments returns the store of the attachments of prj.
+func (a *app) attachments(prj projects.Project) *attachments.Store {
+	return attachments.NewStore(filepath.Join(a.dir, prj.ID), a.blobs)
+}
+
+// attachmentURL returns the path of an attachment of a project.
+func attachmentURL(prj projects.Project, name string) string {
+	return projectURL(prj) + "/attachments/" + url.PathEscape(name)
+}
+
+// pathAttachment returns the project and the attachment named in the request
+// path, if the user has role in the project.
+func (a *app) pathAttachment(r *http.Request, role projects.Role) (projects.Project, attachments.Attachment, error) {
+	prj, err := a.pathProject(r, role)
+	if err != nil {
+		return prj, attachments.Attachment{}, err
+	}
+	at, err := a.attachments(prj).Get(r.PathValue("name"))
+	return prj, at, err
+}
+
+// uploadedName returns the name of an uploaded file without the directories,
+// that some browsers send.
+func uploadedName(filename string) string {
+	return filename[strings.LastIndexAny(filename, `/\`)+1:]
+}
+
+// uploadAttachmentHandler saves the File uploaded in a project, named Name
+// or as the file uploaded.
+func (a *app) uploadAttachmentHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, err := a.pathProject(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	err = utils.ParseForm(r)
+	if err != nil {
+		return err
+	}
+	f, header, err := r.FormFile("File")
+	if err == http.ErrMissingFile {
+		w.WriteHeader(http.StatusBadRequest)
+		return a.renderProjectView(w, r, prj, map[string]string{"File": "choose a file to upload"})
+	}
+	if err != nil {
+		return utils.TooLarge(err)
+	}
+	defer f.Close()
+	name := r.PostFormValue("Name")
+	if name == "" {
+		name = uploadedName(header.Filename)
+	}
+	_, err = a.attachments(prj).Save(name, f)
+	if errs, ok := formErrors(err); ok {
+		// the name of the attachment is the one of the file.
+		if reason, ok := errs["Name"]; ok {
+			errs["File"] = name + ": " + reason
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		return a.renderProjectView(w, r, prj, errs)
+	}
+	if err != nil {
+		return utils.TooLarge(err)
+	}
+	http.Redirect(w, r, projectURL(prj), http.StatusSeeOther)
+	return nil
+}
+
+// downloadAttachmentHandler answers with the content of an attachment,
+// supporting range requests. Images are shown by the browser, the other
+// files are downloaded.
+func (a *app) downloadAttachmentHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, err := a.pathProject(r, projects.Viewer)
+	if err != nil {
+		return err
+	}
+	at, f, err := a.attachments(prj).Open(r.PathValue("name"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	disposition := "attachment"
+	if at.Image() {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", at.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": at.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, at.Name, at.Uploaded, f)
+	return nil
+}
+
+// deleteAttachmentHandler asks for confirmation on GET, the attachment is
+// deleted only by POST or DELETE.
+func (a *app) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, at, err := a.pathAttachment(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	switch r.Method {
+	case "POST", "DELETE":
+		err = a.attachments(prj).Delete(at.Name)
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, projectURL(prj), http.StatusSeeOther)
+		return nil
+	case "GET":
+		t, err := prepareAppTemplate(r, "templates/attachments/delete.html")
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, map[string]interface{}{
+			"WebPage": WebPage{
+				Title:       appName,
+				PageName:    "Delete Attachment",
+				Breadcrumbs: projectCrumbs(prj),
+			},
+			"Project":    prj,
+			"Attachment": at,
+		})
+	default:
+		return utils.MethodNotAllowed(r.Method)
+	}
+}
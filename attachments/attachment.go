@@ -0,0 +1,338 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+// Package attachments contains the files uploaded in a project.
+// Their contents are kept in the blob store shared by all the projects.
+package attachments
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/scompo/data-management/blobs"
+	"github.com/scompo/data-management/utils"
+)
+
+// DirName is the directory inside a project where its attachments are
+// saved.
+const DirName = "attachments"
+
+var indexName = "attachments.json"
+
+// filesName is where the contents were saved before the blob store.
+var filesName = "files"
+
+// ErrNotFound is returned when an attachment does not exist.
+var ErrNotFound = errors.New("attachment not found")
+
+// ErrExists is returned when an attachment name is already used.
+var ErrExists = errors.New("attachment name already existent")
+
+// Attachment is a file uploaded in a project.
+// Hash is the hash of its content in the blob store.
+type Attachment struct {
+	Name        string
+	Size        int64
+	ContentType string
+	Uploaded    time.Time
+	Hash        string
+}
+
+// Image reports if the attachment can be shown as an image in the pages.
+// SVG images are left out, they can carry scripts.
+func (a Attachment) Image() bool {
+	return strings.HasPrefix(a.ContentType, "image/") && a.ContentType != "image/svg+xml"
+}
+
+var currentTime = time.Now
+
+// ValidationError is returned when an attachment field is not acceptable.
+type ValidationError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid attachment " + e.Field + " \"" + e.Value + "\": " + e.Reason
+}
+
+// Store saves the attachments of a project: their details in an index
+// inside Dir, and their contents in Blobs, referenced by the project with
+// the ID Project.
+type Store struct {
+	Dir     string
+	Blobs   *blobs.Store
+	Project string
+}
+
+// NewStore returns the Store for the attachments of the project in
+// projectDir, the directory named after its ID, saving the contents in bs.
+func NewStore(projectDir string, bs *blobs.Store) *Store {
+	return &Store{
+		Dir:     filepath.Join(projectDir, DirName),
+		Blobs:   bs,
+		Project: filepath.Base(projectDir),
+	}
+}
+
+// lock serializes the changes to the attachments of the project, between
+// goroutines and between processes sharing the directory.
+// The returned function releases it.
+func (s *Store) lock() (func(), error) {
+	err := os.MkdirAll(s.Dir, 0775)
+	if err != nil {
+		return nil, err
+	}
+	return utils.LockDir(s.Dir)
+}
+
+func (s *Store) ref(name string) blobs.Ref {
+	return blobs.Ref{Project: s.Project, Name: name}
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.Dir, filesName, name)
+}
+
+func (s *Store) read() ([]Attachment, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.Dir, indexName))
+	if os.IsNotExist(err) {
+		return []Attachment{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var as []Attachment
+	err = json.Unmarshal(data, &as)
+	return as, err
+}
+
+func (s *Store) write(as []Attachment) error {
+	sort.Slice(as, func(i, j int) bool {
+		return as[i].Name < as[j].Name
+	})
+	data, err := json.Marshal(as)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(s.Dir, indexName), data)
+}
+
+func indexOf(as []Attachment, name string) int {
+	for i, a := range as {
+		if a.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ContentType returns the content type of a file called name starting with
+// head: the one of its extension if known, else the one of its content.
+func ContentType(name string, head []byte) string {
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t
+	}
+	return http.DetectContentType(head)
+}
+
+// Save saves the content read from r as the attachment name.
+// Returns an error if an attachment with the same name already exists.
+func (s *Store) Save(name string, r io.Reader) (Attachment, error) {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return Attachment{}, err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return Attachment{}, err
+	}
+	defer unlock()
+	as, err := s.read()
+	if err != nil {
+		return Attachment{}, err
+	}
+	if indexOf(as, name) >= 0 {
+		return Attachment{}, fmt.Errorf("%w: %v", ErrExists, name)
+	}
+	err = os.MkdirAll(s.Dir, 0775)
+	if err != nil {
+		return Attachment{}, err
+	}
+	// the start of the content tells the type when the name does not.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return Attachment{}, err
+	}
+	head = head[:n]
+	h, size, err := s.Blobs.Put(s.ref(name), io.MultiReader(bytes.NewReader(head), r))
+	if err != nil {
+		return Attachment{}, err
+	}
+	a := Attachment{
+		Name:        name,
+		Size:        size,
+		ContentType: ContentType(name, head),
+		Uploaded:    currentTime(),
+		Hash:        h,
+	}
+	err = s.write(append(as, a))
+	if err != nil {
+		s.Blobs.Release(h, s.ref(name))
+		return Attachment{}, err
+	}
+	return a, nil
+}
+
+// All returns all the attachments sorted by name.
+func (s *Store) All() ([]Attachment, error) {
+	return s.read()
+}
+
+// Get returns an attachment by name.
+func (s *Store) Get(name string) (Attachment, error) {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return Attachment{}, err
+	}
+	as, err := s.read()
+	if err != nil {
+		return Attachment{}, err
+	}
+	i := indexOf(as, name)
+	if i < 0 {
+		return Attachment{}, fmt.Errorf("%w: %v", ErrNotFound, name)
+	}
+	return as[i], nil
+}
+
+// Open returns an attachment by name, with its content to read, checked
+// against its hash. The content has to be closed after use.
+func (s *Store) Open(name string) (Attachment, *os.File, error) {
+	a, err := s.Get(name)
+	if err != nil {
+		return a, nil, err
+	}
+	if a.Hash == "" {
+		f, err := os.Open(s.path(a.Name))
+		return a, f, err
+	}
+	f, err := s.Blobs.Open(a.Hash)
+	return a, f, err
+}
+
+// Delete deletes an attachment by name.
+// Deleting an attachment that does not exist is not an error.
+func (s *Store) Delete(name string) error {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	as, err := s.read()
+	if err != nil {
+		return err
+	}
+	i := indexOf(as, name)
+	if i < 0 {
+		return nil
+	}
+	a := as[i]
+	err = s.write(append(as[:i], as[i+1:]...))
+	if err != nil {
+		return err
+	}
+	if a.Hash == "" {
+		return os.Remove(s.path(name))
+	}
+	return s.Blobs.Release(a.Hash, s.ref(name))
+}
+
+// Migrate moves the contents saved before the blob store in it.
+// It's meant to be called on startup, before using the store.
+func (s *Store) Migrate() error {
+	if _, err := os.Stat(s.Dir); os.IsNotExist(err) {
+		return nil
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	as, err := s.read()
+	if err != nil {
+		return err
+	}
+	var moved []string
+	for i, a := range as {
+		if a.Hash != "" {
+			continue
+		}
+		f, err := os.Open(s.path(a.Name))
+		if err != nil {
+			return err
+		}
+		as[i].Hash, _, err = s.Blobs.Put(s.ref(a.Name), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		moved = append(moved, a.Name)
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+	err = s.write(as)
+	if err != nil {
+		return err
+	}
+	for _, name := range moved {
+		os.Remove(s.path(name))
+	}
+	os.Remove(filepath.Join(s.Dir, filesName))
+	return nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package attachments
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scompo/data-management/blobs"
+	"github.com/scompo/data-management/utils"
+)
+
+var testTime = time.Now()
+
+func setup(t *testing.T) *Store {
+	currentTime = func() time.Time {
+		return testTime
+	}
+	t.Cleanup(func() {
+		currentTime = time.Now
+	})
+	dir := t.TempDir()
+	return NewStore(filepath.Join(dir, "project-id"), blobs.NewStore(dir))
+}
+
+func TestSaveOpen(t *testing.T) {
+	s := setup(t)
+
+	a, err := s.Save("notes.txt", strings.NewReader("some notes"))
+	if err != nil {
+		t.Fatalf("Error saving: %v\n", err)
+	}
+	if a.Size != 10 || a.ContentType != "text/plain; charset=utf-8" || !testTime.Equal(a.Uploaded) {
+		t.Errorf("wrong attachment saved: %+v", a)
+	}
+	got, f, err := s.Open("notes.txt")
+	if err != nil {
+		t.Fatalf("Error opening: %v\n", err)
+	}
+	defer f.Close()
+	data, _ := ioutil.ReadAll(f)
+	if string(data) != "some notes" || got.Name != a.Name || got.Size != a.Size || !testTime.Equal(got.Uploaded) {
+		t.Errorf("wrong content \"%v\", %+v", string(data), got)
+	}
+	if _, err := s.Save("notes.txt", strings.NewReader("other")); !errors.Is(err, ErrExists) {
+		t.Errorf("no error for attachment name already existent: %v\n", err)
+	}
+	var verr *utils.ValidationError
+	if _, err := s.Save("../escape", strings.NewReader("x")); !errors.As(err, &verr) {
+		t.Errorf("Expected validation error: %v\n", err)
+	}
+	if _, err := s.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for attachment not existent: %v\n", err)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n"
+	tests := []struct {
+		name, content, expected string
+		image                   bool
+	}{
+		{"image.png", png, "image/png", true},
+		{"no-extension", png, "image/png", true},
+		{"drawing.svg", "<svg></svg>", "image/svg+xml", false},
+		{"data.bin", "\x00\x01", "application/octet-stream", false},
+	}
+	for _, test := range tests {
+		a := Attachment{ContentType: ContentType(test.name, []byte(test.content))}
+		if a.ContentType != test.expected || a.Image() != test.image {
+			t.Errorf("%v: expected %v, but was %v", test.name, test.expected, a.ContentType)
+		}
+	}
+}
+
+func TestAllDelete(t *testing.T) {
+	s := setup(t)
+
+	for _, name := range []string{"b", "a", "c"} {
+		if _, err := s.Save(name, strings.NewReader(name)); err != nil {
+			t.Fatalf("Error saving: %v\n", err)
+		}
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Errorf("Error deleting: %v\n", err)
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Errorf("should not error if attachment not existent: %v\n", err)
+	}
+	as, err := s.All()
+	if err != nil || len(as) != 2 || as[0].Name != "a" || as[1].Name != "c" {
+		t.Errorf("Expected attachments a and c, but found %+v, %v", as, err)
+	}
+}
+
+func TestBlobs(t *testing.T) {
+	s := setup(t)
+
+	a, _ := s.Save("a", strings.NewReader("same"))
+	s.Save("b", strings.NewReader("same"))
+	refs, err := s.Blobs.Refs(a.Hash)
+	if err != nil || len(refs) != 2 || refs[0].Project != "project-id" {
+		t.Errorf("Expected 2 references from project-id, but found %+v, %v", refs, err)
+	}
+	s.Delete("a")
+	s.Delete("b")
+	if _, err := s.Blobs.Open(a.Hash); !errors.Is(err, blobs.ErrNotFound) {
+		t.Errorf("the blob should be deleted with its attachments: %v\n", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	s := setup(t)
+
+	// saved before the blob store.
+	os.MkdirAll(filepath.Join(s.Dir, filesName), 0775)
+	ioutil.WriteFile(s.path("old"), []byte("old content"), 0664)
+	s.write([]Attachment{{Name: "old", Size: 11}})
+	if _, f, err := s.Open("old"); err != nil {
+		t.Errorf("Error opening before migrating: %v\n", err)
+	} else {
+		f.Close()
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatalf("Error migrating: %v\n", err)
+	}
+	a, f, err := s.Open("old")
+	if err != nil {
+		t.Fatalf("Error opening: %v\n", err)
+	}
+	data, _ := ioutil.ReadAll(f)
+	f.Close()
+	if a.Hash == "" || string(data) != "old content" {
+		t.Errorf("not migrated: %+v, \"%v\"", a, string(data))
+	}
+	if _, err := os.Stat(s.path("old")); !os.IsNotExist(err) {
+		t.Errorf("the old file should be removed: %v\n", err)
+	}
+}
@@ -0,0 +1,303 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+// Package blobs keeps file contents addressed by their SHA-256 hash, so that
+// the same content is saved once however many times it's used.
+// Every use is recorded as a reference, and a content is deleted when it has
+// no references left.
+package blobs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/scompo/data-management/utils"
+)
+
+// DirName is the directory, next to the projects, where the blobs are saved.
+const DirName = "blobs"
+
+var refsSuffix = ".refs"
+
+// ErrNotFound is returned when a blob does not exist.
+var ErrNotFound = errors.New("blob not found")
+
+// ErrCorrupt is returned when the content of a blob does not match its hash.
+var ErrCorrupt = errors.New("blob corrupted")
+
+// Ref is a use of a blob: the item Name of the project with the ID Project.
+type Ref struct {
+	Project string
+	Name    string
+}
+
+// Store saves the blobs inside Dir, each in a file named after its hash,
+// with the references next to it.
+type Store struct {
+	Dir string
+}
+
+// NewStore returns the Store of the blobs of the projects in prjDir.
+func NewStore(prjDir string) *Store {
+	return &Store{Dir: filepath.Join(prjDir, DirName)}
+}
+
+// ValidHash reports if h can be the hash of a blob.
+func ValidHash(h string) bool {
+	if len(h) != sha256.Size*2 || strings.ToLower(h) != h {
+		return false
+	}
+	_, err := hex.DecodeString(h)
+	return err == nil
+}
+
+// path returns the path of the blob with hash h, spread in directories by
+// the first two characters so that none gets too big.
+func (s *Store) path(h string) string {
+	return filepath.Join(s.Dir, h[:2], h)
+}
+
+// Put saves the content read from r, if not already saved, and adds ref to
+// its references. Returns the hash of the content and its size.
+func (s *Store) Put(ref Ref, r io.Reader) (string, int64, error) {
+	err := os.MkdirAll(s.Dir, 0775)
+	if err != nil {
+		return "", 0, err
+	}
+	// the content goes to a temporary file first, its name depends on it.
+	tmp, err := ioutil.TempFile(s.Dir, "put.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", size, err
+	}
+	h := hex.EncodeToString(hash.Sum(nil))
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return "", size, err
+	}
+	defer unlock()
+	// the blob goes first: a blob without references is unused, while
+	// references without the blob would be broken.
+	err = os.MkdirAll(filepath.Dir(s.path(h)), 0775)
+	if err != nil {
+		return "", size, err
+	}
+	_, err = os.Stat(s.path(h))
+	if os.IsNotExist(err) {
+		if err = os.Chmod(tmp.Name(), 0444); err == nil {
+			err = os.Rename(tmp.Name(), s.path(h))
+		}
+	}
+	if err != nil {
+		return "", size, err
+	}
+	err = s.addRef(h, ref)
+	if err != nil {
+		return "", size, err
+	}
+	return h, size, nil
+}
+
+func (s *Store) readRefs(h string) ([]Ref, error) {
+	data, err := ioutil.ReadFile(s.path(h) + refsSuffix)
+	if os.IsNotExist(err) {
+		return []Ref{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var refs []Ref
+	err = json.Unmarshal(data, &refs)
+	return refs, err
+}
+
+func (s *Store) writeRefs(h string, refs []Ref) error {
+	data, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.path(h)+refsSuffix, data)
+}
+
+func (s *Store) addRef(h string, ref Ref) error {
+	refs, err := s.readRefs(h)
+	if err != nil {
+		return err
+	}
+	for _, r := range refs {
+		if r == ref {
+			return nil
+		}
+	}
+	return s.writeRefs(h, append(refs, ref))
+}
+
+// removeRef removes ref from the references of the blob h, deleting the
+// blob if it was the last one.
+func (s *Store) removeRef(h string, ref Ref) error {
+	return s.removeRefs(h, func(r Ref) bool {
+		return r == ref
+	})
+}
+
+// removeRefs removes the references of the blob h matching remove, deleting
+// the blob if none is left.
+func (s *Store) removeRefs(h string, remove func(Ref) bool) error {
+	refs, err := s.readRefs(h)
+	if err != nil {
+		return err
+	}
+	kept := refs[:0]
+	for _, r := range refs {
+		if !remove(r) {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) > 0 {
+		return s.writeRefs(h, kept)
+	}
+	// the blob goes first, like in Put.
+	err = os.Remove(s.path(h))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Remove(s.path(h) + refsSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Release removes ref from the references of the blob with hash h, the blob
+// is deleted when no references are left.
+func (s *Store) Release(h string, ref Ref) error {
+	if !ValidHash(h) {
+		return fmt.Errorf("%w: %v", ErrNotFound, h)
+	}
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.removeRef(h, ref)
+}
+
+// ReleaseProject removes all the references of the project with the ID id,
+// deleting the blobs only it was using.
+func (s *Store) ReleaseProject(id string) error {
+	if _, err := os.Stat(s.Dir); os.IsNotExist(err) {
+		return nil
+	}
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*", "*"+refsSuffix))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		h := strings.TrimSuffix(filepath.Base(f), refsSuffix)
+		if !ValidHash(h) {
+			continue
+		}
+		err = s.removeRefs(h, func(r Ref) bool {
+			return r.Project == id
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Refs returns the references of the blob with hash h.
+func (s *Store) Refs(h string) ([]Ref, error) {
+	if !ValidHash(h) {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, h)
+	}
+	return s.readRefs(h)
+}
+
+// Open returns the content of the blob with hash h, to read and seek, after
+// checking that it matches the hash: ErrCorrupt is returned if not.
+// The content has to be closed after use.
+func (s *Store) Open(h string) (*os.File, error) {
+	if !ValidHash(h) {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, h)
+	}
+	f, err := os.Open(s.path(h))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, h)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = verify(f, h)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// verify checks that the content of f has the hash h, and rewinds it.
+func verify(f *os.File, h string) error {
+	hash := sha256.New()
+	_, err := io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != h {
+		return fmt.Errorf("%w: %v", ErrCorrupt, h)
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return err
+}
@@ -0,0 +1,113 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package blobs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPutOpen(t *testing.T) {
+	s := NewStore(t.TempDir())
+	a := Ref{Project: "p1", Name: "a"}
+	b := Ref{Project: "p2", Name: "b"}
+
+	h, size, err := s.Put(a, strings.NewReader("content"))
+	if err != nil || size != 7 || !ValidHash(h) {
+		t.Fatalf("Error putting: %v, %v, %v\n", h, size, err)
+	}
+	h2, _, err := s.Put(b, strings.NewReader("content"))
+	if err != nil || h2 != h {
+		t.Errorf("the same content should have the same hash: %v, %v, %v", h, h2, err)
+	}
+	refs, err := s.Refs(h)
+	if err != nil || len(refs) != 2 {
+		t.Errorf("Expected 2 references, but found %+v, %v", refs, err)
+	}
+	f, err := s.Open(h)
+	if err != nil {
+		t.Fatalf("Error opening: %v\n", err)
+	}
+	data, _ := ioutil.ReadAll(f)
+	f.Close()
+	if string(data) != "content" {
+		t.Errorf("wrong content \"%v\"", string(data))
+	}
+	if _, err := s.Open(strings.Repeat("0", 64)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for blob not existent: %v\n", err)
+	}
+	if _, err := s.Open("../../etc/passwd"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for invalid hash: %v\n", err)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	s := NewStore(t.TempDir())
+	h, _, _ := s.Put(Ref{Project: "p", Name: "a"}, strings.NewReader("content"))
+	os.Chmod(s.path(h), 0664)
+	if err := ioutil.WriteFile(s.path(h), []byte("changed"), 0664); err != nil {
+		t.Fatalf("Error writing: %v\n", err)
+	}
+	if _, err := s.Open(h); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected error for corrupted blob: %v\n", err)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	s := NewStore(t.TempDir())
+	a := Ref{Project: "p1", Name: "a"}
+	b := Ref{Project: "p2", Name: "b"}
+	c := Ref{Project: "p1", Name: "c"}
+	shared, _, _ := s.Put(a, strings.NewReader("shared"))
+	s.Put(b, strings.NewReader("shared"))
+	own, _, _ := s.Put(c, strings.NewReader("own"))
+
+	if err := s.ReleaseProject("p1"); err != nil {
+		t.Fatalf("Error releasing the project: %v\n", err)
+	}
+	if _, err := s.Open(own); !errors.Is(err, ErrNotFound) {
+		t.Errorf("the blob used only by the project should be deleted: %v\n", err)
+	}
+	f, err := s.Open(shared)
+	if err != nil {
+		t.Fatalf("the shared blob should be kept: %v\n", err)
+	}
+	f.Close()
+	if err := s.Release(shared, b); err != nil {
+		t.Fatalf("Error releasing: %v\n", err)
+	}
+	if _, err := s.Open(shared); !errors.Is(err, ErrNotFound) {
+		t.Errorf("the blob without references should be deleted: %v\n", err)
+	}
+}
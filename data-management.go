@@ -33,30 +33,97 @@ package main
 import (
 	"errors"
 	"flag"
+	"github.com/scompo/data-management/attachments"
+	"github.com/scompo/data-management/blobs"
+	"github.com/scompo/data-management/datasets"
+	"github.com/scompo/data-management/links"
+	"github.com/scompo/data-management/markdown"
+	"github.com/scompo/data-management/pages"
 	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/queries"
+	"github.com/scompo/data-management/query"
+	"github.com/scompo/data-management/users"
 	"github.com/scompo/data-management/utils"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 )
 
 const appName = "data-management"
 
 type WebPage struct {
-	Title    string
-	PageName string
+	Title       string
+	PageName    string
+	Breadcrumbs []Breadcrumb
+}
+
+// Breadcrumb is a step of the path to a page, shown in the header.
+type Breadcrumb struct {
+	Name string
+	URL  string
+}
+
+// app holds what the handlers need to serve a single data directory.
+type app struct {
+	projects projects.Store
+	// dir is where the content of the projects is saved, a directory named
+	// after the ID of every project.
+	dir string
+	// links is the index of the wiki links between the pages.
+	links *links.Index
+	// blobs keeps the contents of the attachments of all the projects.
+	blobs *blobs.Store
+	// maxUpload is the size limit of the requests, in bytes.
+	maxUpload int64
+	// users are the accounts that can log in, sessions the browsers where
+	// they did.
+	users    *users.Store
+	sessions *users.Sessions
+}
+
+// defaultMaxUpload is the default size limit of the requests, in megabytes.
+const defaultMaxUpload = 32
+
+func newApp(store projects.Store, dir string) *app {
+	return &app{
+		projects:  store,
+		dir:       dir,
+		links:     links.NewIndex(dir),
+		blobs:     blobs.NewStore(dir),
+		maxUpload: defaultMaxUpload << 20,
+		users:     users.NewStore(dir),
+		sessions:  users.NewSessions(dir),
+	}
 }
 
 func main() {
 
-	conf := utils.CreateConfig("port", "prj-dir")
+	conf := utils.CreateConfig("port", "prj-dir", "store", "max-upload", "add-user", "admin")
 
 	conf["port"] = flag.String("port", "8080", "server port")
 	conf["prj-dir"] = flag.String("prj-dir", "data/projects", "project directory path")
+	conf["store"] = flag.String("store", "file", "project store to use: file, sql or memory")
+	conf["max-upload"] = flag.String("max-upload", strconv.Itoa(defaultMaxUpload), "size limit of the uploads, in megabytes")
+	conf["add-user"] = flag.String("add-user", "", "add a user with this name, reading the password from the standard input, and exit")
+	conf["admin"] = flag.String("admin", "false", "with -add-user, make the user an administrator who adds the others")
 
 	flag.Parse()
 
+	if name := *conf["add-user"]; name != "" {
+		admin, err := strconv.ParseBool(*conf["admin"])
+		if err != nil {
+			log.Fatalln("invalid admin: " + *conf["admin"])
+		}
+		err = addUser(*conf["prj-dir"], name, admin, os.Stdin)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("User %v added\n", name)
+		return
+	}
+
 	err := initialize(conf)
 	if err != nil {
 		log.Fatalln(err)
@@ -71,24 +138,46 @@ func initialize(conf utils.Config) error {
 		log.Printf("%v: %v\n", k, *v)
 	}
 
-	projects.PrjDir = *conf["prj-dir"]
-	
-	err := os.MkdirAll(projects.PrjDir, 0775)
+	store, err := openStore(*conf["store"], *conf["prj-dir"])
 	if err != nil {
 		return err
 	}
 
-	fs := http.FileServer(http.Dir("static"))
+	a := newApp(store, *conf["prj-dir"])
+	maxUpload, err := strconv.ParseInt(*conf["max-upload"], 10, 64)
+	if err != nil || maxUpload <= 0 {
+		return errors.New("invalid max-upload: " + *conf["max-upload"])
+	}
+	a.maxUpload = maxUpload << 20
+	for _, prj := range a.projects.All() {
+		err = a.attachments(prj).Migrate()
+		if err != nil {
+			return err
+		}
+	}
+	if !a.links.Exists() {
+		log.Printf("Indexing the page links...\n")
+		err = a.indexAllLinks()
+		if err != nil {
+			return err
+		}
+	}
 
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
-	http.Handle("/", utils.AppHandler(mainHandler))
-	http.Handle("/projects/", utils.AppHandler(projectsHandler))
-	http.Handle("/projects/new", utils.AppHandler(newProjectHandler))
-	http.Handle("/projects/delete", utils.AppHandler(deleteProjectHandler))
-	http.Handle("/projects/view", utils.AppHandler(viewProjectHandler))
-	http.Handle("/pages/new", utils.AppHandler(pageNewHandler))
+	us, err := a.users.All()
+	if err != nil {
+		return err
+	}
+	if len(us) == 0 {
+		log.Printf("No users yet, nobody can log in: add one with -add-user\n")
+	}
+	err = a.claimProjects()
+	if err != nil {
+		return err
+	}
 
-	err = http.ListenAndServe(":"+*conf["port"], nil)
+	utils.ErrorPage = renderErrorPage
+
+	err = http.ListenAndServe(":"+*conf["port"], a.routes())
 	if err != nil {
 		return err
 	}
@@ -97,84 +186,428 @@ func initialize(conf utils.Config) error {
 	return nil
 }
 
-func pageNewHandler(w http.ResponseWriter, r *http.Request) error {
-	t, err := prepareAppTemplate("templates/pages/new.html")
+// openStore returns the project store called name, rooted in dir.
+func openStore(name, dir string) (projects.Store, error) {
+	if name == "memory" {
+		return projects.NewMemoryStore(), nil
+	}
+	err := os.MkdirAll(dir, 0775)
 	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "file":
+		s := projects.NewFileStore(dir)
+		err = s.Recover()
+		if err != nil {
+			return nil, err
+		}
+		return s, s.Migrate()
+	case "sql":
+		return projects.OpenSQLStore(dir)
+	default:
+		return nil, errors.New("unknown store: " + name)
+	}
+}
+
+// appHandler returns an AppHandler for fn, translating the errors of the
+// application packages in the HTTP errors to answer with.
+func appHandler(fn utils.AppHandler) utils.AppHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		return httpError(fn(w, r))
+	}
+}
+
+// httpError returns err as an *utils.Error if it's one the user can do
+// something about, otherwise err itself.
+func httpError(err error) error {
+	var verr *projects.ValidationError
+	var pverr *pages.ValidationError
+	var averr *attachments.ValidationError
+	var dverr *datasets.ValidationError
+	var qverr *queries.ValidationError
+	var qerr *query.Error
+	var serr *datasets.SchemaError
+	var uverr *users.ValidationError
+	var nerr *utils.ValidationError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, projects.ErrNotFound), errors.Is(err, pages.ErrNotFound),
+		errors.Is(err, attachments.ErrNotFound), errors.Is(err, datasets.ErrNotFound),
+		errors.Is(err, queries.ErrNotFound), errors.Is(err, users.ErrNotFound):
+		return utils.NotFound(err)
+	case errors.Is(err, projects.ErrExists), errors.Is(err, pages.ErrExists),
+		errors.Is(err, attachments.ErrExists), errors.Is(err, datasets.ErrExists),
+		errors.Is(err, datasets.ErrConflict), errors.Is(err, users.ErrExists):
+		return utils.Conflict(err)
+	case errors.As(err, &verr), errors.As(err, &pverr), errors.As(err, &averr),
+		errors.As(err, &dverr), errors.As(err, &qverr), errors.As(err, &qerr),
+		errors.As(err, &serr), errors.As(err, &uverr), errors.As(err, &nerr):
+		return utils.BadRequest(err)
+	default:
 		return err
 	}
-	return t.Execute(w, map[string]interface{}{
+}
+
+// renderErrorPage answers a failed request with the error page.
+func renderErrorPage(w http.ResponseWriter, r *http.Request, status int, message string) {
+	t, err := prepareAppTemplate(r, "templates/error.html")
+	if err != nil {
+		log.Printf("error page: %v\n", err)
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	err = t.Execute(w, map[string]interface{}{
 		"WebPage": WebPage{
 			Title:    appName,
-			PageName: "New Page",
+			PageName: http.StatusText(status),
 		},
+		"Status":  status,
+		"Message": message,
 	})
+	if err != nil {
+		log.Printf("error page: %v\n", err)
+	}
+}
+
+func (a *app) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	fs := http.FileServer(http.Dir("static"))
+
+	mux.Handle("/static/", http.StripPrefix("/static/", fs))
+	mux.Handle("/", appHandler(a.mainHandler))
+	mux.Handle("/projects", appHandler(a.projectsHandler))
+	mux.Handle("/projects/{$}", appHandler(a.projectsHandler))
+	mux.Handle("/projects/new", appHandler(a.newProjectHandler))
+	mux.Handle("/projects/view", appHandler(a.legacyViewProjectHandler))
+	mux.Handle("/projects/{id}", appHandler(a.viewProjectHandler))
+	mux.Handle("/projects/{id}/edit", appHandler(a.editProjectHandler))
+	mux.Handle("/projects/{id}/delete", appHandler(a.deleteProjectHandler))
+	mux.Handle("/projects/{id}/members", appHandler(a.membersHandler))
+	mux.Handle("/pages/new", appHandler(a.newPageHandler))
+	mux.Handle("/projects/{id}/pages/{page}", appHandler(a.viewPageHandler))
+	mux.Handle("/projects/{id}/pages/{page}/edit", appHandler(a.editPageHandler))
+	mux.Handle("/projects/{id}/pages/{page}/delete", appHandler(a.deletePageHandler))
+	mux.Handle("/projects/{id}/pages/{page}/move", appHandler(a.movePageHandler))
+	mux.Handle("/projects/{id}/pages/{page}/history", appHandler(a.pageHistoryHandler))
+	mux.Handle("/projects/{id}/pages/{page}/diff", appHandler(a.pageDiffHandler))
+	mux.Handle("/projects/{id}/pages/{page}/revisions/{n}", appHandler(a.viewRevisionHandler))
+	mux.Handle("/projects/{id}/pages/{page}/revisions/{n}/restore", appHandler(a.restoreRevisionHandler))
+	mux.Handle("/projects/{id}/attachments", appHandler(a.uploadAttachmentHandler))
+	mux.Handle("/projects/{id}/attachments/{name}", appHandler(a.downloadAttachmentHandler))
+	mux.Handle("/projects/{id}/attachments/{name}/delete", appHandler(a.deleteAttachmentHandler))
+	mux.Handle("/projects/{id}/datasets", appHandler(a.importDatasetHandler))
+	mux.Handle("/projects/{id}/datasets/{name}", appHandler(a.viewDatasetHandler))
+	mux.Handle("/projects/{id}/datasets/{name}/delete", appHandler(a.deleteDatasetHandler))
+	mux.Handle("/projects/{id}/datasets/{name}/export", appHandler(a.exportDatasetHandler))
+	mux.Handle("/projects/{id}/datasets/{name}/schema", appHandler(a.schemaHandler))
+	mux.Handle("/projects/{id}/datasets/{name}/upload", appHandler(a.uploadDatasetHandler))
+	mux.Handle("/projects/{id}/datasets/{name}/versions", appHandler(a.datasetVersionsHandler))
+	mux.Handle("/projects/{id}/datasets/{name}/versions/{n}/revert", appHandler(a.revertDatasetHandler))
+	mux.Handle("/projects/{id}/datasets/{name}/diff", appHandler(a.datasetDiffHandler))
+	mux.Handle("/projects/{id}/datasets/{name}/edit", appHandler(a.editDatasetHandler))
+	mux.Handle("/projects/{id}/datasets/{name}/edits", apiHandler(a.datasetEditsHandler))
+	mux.Handle("/projects/{id}/query", appHandler(a.queryHandler))
+	mux.Handle("/projects/{id}/query/export", appHandler(a.exportQueryHandler))
+	mux.Handle("/projects/{id}/queries", appHandler(a.saveQueryHandler))
+	mux.Handle("/projects/{id}/queries/{name}/delete", appHandler(a.deleteQueryHandler))
+	mux.Handle("/login", appHandler(a.loginHandler))
+	mux.Handle("/logout", appHandler(a.logoutHandler))
+	mux.Handle("/users", appHandler(a.usersHandler))
+	mux.Handle("/users/password", appHandler(a.passwordHandler))
+
+	api := http.NewServeMux()
+	a.apiRoutes(api)
+
+	root := http.NewServeMux()
+	root.Handle(apiPrefix+"/", a.requireAPIUser(api))
+	root.Handle("/", utils.CSRF(a.requireUser(mux)))
+	return utils.LimitBody(root, a.maxUpload)
+}
+
+// projectURL returns the path of the page of a project.
+func projectURL(prj projects.Project) string {
+	return "/projects/" + prj.ID
+}
+
+// projectCrumbs returns the breadcrumbs to the page of a project.
+func projectCrumbs(prj projects.Project) []Breadcrumb {
+	return []Breadcrumb{
+		{Name: "Projects", URL: "/projects"},
+		{Name: prj.Name, URL: projectURL(prj)},
+	}
+}
+
+// pathProject returns the project whose ID is in the request path, if the
+// user can do in it what role does.
+func (a *app) pathProject(r *http.Request, role projects.Role) (projects.Project, error) {
+	prj, err := a.projects.ByID(r.PathValue("id"))
+	if err != nil {
+		return prj, err
+	}
+	return prj, authorize(r, prj, role)
+}
+
+// saveProject saves the new project prj, resolving the wiki links to its
+// name.
+func (a *app) saveProject(prj projects.Project) error {
+	err := a.projects.Save(prj)
+	if err != nil {
+		return err
+	}
+	prj, err = a.projects.Get(prj.Name)
+	if err != nil {
+		return err
+	}
+	return a.linkProject(prj)
+}
+
+// updateProject changes the name and the description of prj, resolving
+// the wiki links to its new name.
+func (a *app) updateProject(prj projects.Project) error {
+	err := a.projects.Update(prj)
+	if err != nil {
+		return err
+	}
+	prj, err = a.projects.ByID(prj.ID)
+	if err != nil {
+		return err
+	}
+	return a.linkProject(prj)
+}
+
+// deleteProject deletes prj, with the links from its pages.
+func (a *app) deleteProject(prj projects.Project) error {
+	err := a.projects.Delete(prj.ID)
+	if err != nil {
+		return err
+	}
+	return a.links.RemoveProject(prj.ID)
+}
+
+// legacyViewProjectHandler redirects the project links by name used before
+// IDs existed.
+func (a *app) legacyViewProjectHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, err := a.projects.Get(r.URL.Query().Get("Name"))
+	if err == nil {
+		err = authorize(r, prj, projects.Viewer)
+	}
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, projectURL(prj), http.StatusMovedPermanently)
+	return nil
 }
 
-func viewProjectHandler(w http.ResponseWriter, r *http.Request) error {
-	name := r.URL.Query().Get("Name")
-	t, err := prepareAppTemplate("templates/projects/view.html")
+func (a *app) viewProjectHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, err := a.pathProject(r, projects.Viewer)
+	if err != nil {
+		return err
+	}
+	return a.renderProjectView(w, r, prj, nil)
+}
+
+// renderProjectView renders the page of a project, with its pages and
+// attachments. errs are the validation errors of the upload form.
+func (a *app) renderProjectView(w http.ResponseWriter, r *http.Request, prj projects.Project, errs map[string]string) error {
+	tree, err := a.pages(prj).Tree()
+	if err != nil {
+		return err
+	}
+	as, err := a.attachments(prj).All()
+	if err != nil {
+		return err
+	}
+	ds, err := a.datasets(prj).All()
 	if err != nil {
 		return err
 	}
-	prj, err := projects.Get(name)
+	t, err := prepareAppTemplate(r, "templates/projects/view.html")
 	if err != nil {
 		return err
 	}
+	if errs == nil {
+		errs = make(map[string]string)
+	}
 	return t.Execute(w, map[string]interface{}{
 		"WebPage": WebPage{
-			Title:    appName,
-			PageName: "View Project",
+			Title:       appName,
+			PageName:    "View Project",
+			Breadcrumbs: projectCrumbs(prj),
 		},
-		"Project": prj,
+		"Project":     prj,
+		"Access":      newProjectItem(r, prj),
+		"Tree":        pageTree(prj, tree),
+		"Attachments": as,
+		"Datasets":    ds,
+		"MaxUpload":   a.maxUpload,
+		"Errors":      errs,
 	})
 }
 
-func deleteProjectHandler(w http.ResponseWriter, r *http.Request) error {
-	name := r.URL.Query().Get("Name")
-	err := projects.Delete(name)
+// deleteProjectHandler asks for confirmation on GET, the project is deleted
+// only by POST or DELETE, by its owners.
+func (a *app) deleteProjectHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, err := a.pathProject(r, projects.Owner)
 	if err != nil {
 		return err
 	}
-	http.Redirect(w, r, "/projects", http.StatusFound)
-	return nil
+	switch r.Method {
+	case "POST", "DELETE":
+		err = a.deleteProject(prj)
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, "/projects", http.StatusSeeOther)
+		return nil
+	case "GET":
+		t, err := prepareAppTemplate(r, "templates/projects/delete.html")
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, map[string]interface{}{
+			"WebPage": WebPage{
+				Title:       appName,
+				PageName:    "Delete Project",
+				Breadcrumbs: projectCrumbs(prj),
+			},
+			"Project": prj,
+		})
+	default:
+		return utils.MethodNotAllowed(r.Method)
+	}
 }
 
-func newProjectHandler(w http.ResponseWriter, r *http.Request) error {
+func (a *app) editProjectHandler(w http.ResponseWriter, r *http.Request) error {
+	current, err := a.pathProject(r, projects.Owner)
+	if err != nil {
+		return err
+	}
 	switch r.Method {
 	case "POST":
 		err := r.ParseForm()
 		if err != nil {
 			return err
 		}
-		name := r.FormValue("Name")
-		description := r.FormValue("Description")
-		err = projects.Save(projects.Project{
-			Name:        name,
-			Description: description,
-		})
+		prj := projects.Project{
+			ID:          current.ID,
+			Name:        r.FormValue("Name"),
+			Description: r.FormValue("Description"),
+		}
+		err = a.updateProject(prj)
+		if errs, ok := formErrors(err); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return renderProjectForm(w, r, "templates/projects/edit.html", "Edit Project", current.Name, prj, errs)
+		}
 		if err != nil {
 			return err
 		}
-		http.Redirect(w, r, "/projects", http.StatusFound)
+		http.Redirect(w, r, projectURL(prj), http.StatusFound)
 		return nil
 	case "GET":
-		t, err := prepareAppTemplate("templates/projects/new.html")
+		return renderProjectForm(w, r, "templates/projects/edit.html", "Edit Project", current.Name, current, nil)
+	default:
+		return utils.MethodNotAllowed(r.Method)
+	}
+}
+
+func (a *app) newProjectHandler(w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "POST":
+		err := r.ParseForm()
 		if err != nil {
 			return err
 		}
-		return t.Execute(w, map[string]interface{}{
-			"WebPage": WebPage{
-				Title:    appName,
-				PageName: "New Project",
-			},
-		})
+		prj := projects.Project{
+			Name:        r.FormValue("Name"),
+			Description: r.FormValue("Description"),
+		}
+		err = a.saveProject(ownedProject(r, prj))
+		if errs, ok := formErrors(err); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return renderProjectForm(w, r, "templates/projects/new.html", "New Project", "", prj, errs)
+		}
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, "/projects", http.StatusFound)
+		return nil
+	case "GET":
+		return renderProjectForm(w, r, "templates/projects/new.html", "New Project", "", projects.Project{}, nil)
 	default:
-		return errors.New("method not supported, " + r.Method)
+		return utils.MethodNotAllowed(r.Method)
 	}
 }
 
-func projectsHandler(w http.ResponseWriter, r *http.Request) error {
-	t, err := prepareAppTemplate("templates/projects/list.html")
+// renderProjectForm renders one of the forms used to change a project,
+// with the values in prj and the validation errors in errs next to the
+// fields. originalName is the name of the project being edited, if any.
+func renderProjectForm(w http.ResponseWriter, r *http.Request, form, pageName, originalName string, prj projects.Project, errs map[string]string) error {
+	t, err := prepareAppTemplate(r, form)
+	if err != nil {
+		return err
+	}
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage": WebPage{
+			Title:    appName,
+			PageName: pageName,
+		},
+		"OriginalName": originalName,
+		"Project":      prj,
+		"Errors":       errs,
+	})
+}
+
+// formErrors returns the validation errors in err keyed by field name.
+// A name already used is reported on the Name field.
+// It returns false if err is not a validation error.
+func formErrors(err error) (map[string]string, bool) {
+	var verr *projects.ValidationError
+	var pverr *pages.ValidationError
+	var averr *attachments.ValidationError
+	var dverr *datasets.ValidationError
+	var qverr *queries.ValidationError
+	var uverr *users.ValidationError
+	var nerr *utils.ValidationError
+	switch {
+	case errors.As(err, &nerr):
+		return map[string]string{nerr.Field: nerr.Reason}, true
+	case errors.As(err, &verr):
+		return map[string]string{verr.Field: verr.Reason}, true
+	case errors.As(err, &pverr):
+		return map[string]string{pverr.Field: pverr.Reason}, true
+	case errors.As(err, &averr):
+		return map[string]string{averr.Field: averr.Reason}, true
+	case errors.As(err, &dverr):
+		return map[string]string{dverr.Field: dverr.Value + ": " + dverr.Reason}, true
+	case errors.As(err, &qverr):
+		return map[string]string{qverr.Field: qverr.Reason}, true
+	case errors.As(err, &uverr):
+		return map[string]string{uverr.Field: uverr.Reason}, true
+	case errors.Is(err, projects.ErrExists), errors.Is(err, pages.ErrExists),
+		errors.Is(err, attachments.ErrExists), errors.Is(err, datasets.ErrExists),
+		errors.Is(err, users.ErrExists):
+		return map[string]string{"Name": "already used"}, true
+	default:
+		return nil, false
+	}
+}
+
+// projectsHandler lists the projects the user can see.
+func (a *app) projectsHandler(w http.ResponseWriter, r *http.Request) error {
+	prjs := a.visibleProjects(r)
+	items := make([]projectItem, len(prjs))
+	for i, prj := range prjs {
+		items[i] = newProjectItem(r, prj)
+	}
+	t, err := prepareAppTemplate(r, "templates/projects/list.html")
 	if err != nil {
 		return err
 	}
@@ -183,12 +616,15 @@ func projectsHandler(w http.ResponseWriter, r *http.Request) error {
 			Title:    appName,
 			PageName: "All Projects",
 		},
-		"Projects": projects.All(),
+		"Projects": items,
 	})
 }
 
-func mainHandler(w http.ResponseWriter, r *http.Request) error {
-	t, err := prepareAppTemplate("templates/index.html")
+func (a *app) mainHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path != "/" {
+		return utils.NotFound(errors.New("page not found: " + r.URL.Path))
+	}
+	t, err := prepareAppTemplate(r, "templates/index.html")
 	if err != nil {
 		return err
 	}
@@ -200,8 +636,21 @@ func mainHandler(w http.ResponseWriter, r *http.Request) error {
 	})
 }
 
-func prepareAppTemplate(contentTemplate string) (*template.Template, error) {
-	return template.ParseFiles(
+// prepareAppTemplate parses the page layout together with contentTemplate.
+// The forms in the templates must include {{csrfField}}, the CSRF token of
+// the request r. Markdown can be rendered with {{markdown .Text}}, and
+// {{currentUser}} is the name of the user logged in.
+func prepareAppTemplate(r *http.Request, contentTemplate string) (*template.Template, error) {
+	return template.New("main.html").Funcs(template.FuncMap{
+		"markdown": markdown.Render,
+		"currentUser": func() string {
+			return currentUser(r)
+		},
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + utils.CSRFFieldName +
+				`" value="` + template.HTMLEscapeString(utils.CSRFToken(r)) + `" />`)
+		},
+	}).ParseFiles(
 		"templates/main.html",
 		"templates/header.html",
 		contentTemplate)
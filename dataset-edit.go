@@ -0,0 +1,152 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"errors"
+	"github.com/scompo/data-management/datasets"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/utils"
+	"net/http"
+)
+
+// apiDatasetEdits is the body of the requests editing the rows of a
+// dataset, see datasets.Edits.
+type apiDatasetEdits struct {
+	Version int                 `json:"version"`
+	Message string              `json:"message"`
+	Cells   []apiCellEdit       `json:"cells"`
+	Delete  []int               `json:"delete"`
+	Add     []map[string]string `json:"add"`
+}
+
+type apiCellEdit struct {
+	Row    int    `json:"row"`
+	Column string `json:"column"`
+	Value  string `json:"value"`
+}
+
+// apiRowError is a datasets.RowError as seen by the json API.
+type apiRowError struct {
+	Row    int    `json:"row"`
+	Column string `json:"column"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// apiSchemaError is the body answered when the edits break the schema.
+type apiSchemaError struct {
+	utils.ErrorBody
+	Rows   int           `json:"rows"`
+	Errors []apiRowError `json:"errors"`
+}
+
+// editDatasetHandler shows a page of the rows of a dataset in a grid where
+// they can be changed, the changes are sent to datasetEditsHandler.
+func (a *app) editDatasetHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, d, err := a.pathDataset(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	rows, page, pages, err := a.datasetPage(r, prj, d)
+	if err != nil {
+		return err
+	}
+	t, err := prepareAppTemplate(r, "templates/datasets/edit.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage": WebPage{
+			Title:       appName,
+			PageName:    "Edit " + d.Name,
+			Breadcrumbs: append(projectCrumbs(prj), Breadcrumb{Name: d.Name, URL: datasetURL(prj, d.Name)}),
+		},
+		"Project":  prj,
+		"Dataset":  d,
+		"Rows":     rows,
+		"Page":     page,
+		"Pages":    pages,
+		"Previous": page - 1,
+		"Next":     page + 1,
+	})
+}
+
+// datasetEditsHandler applies the json edits posted to the rows of a
+// dataset, answering with its new version and number of rows:
+//
+//	{"version": 3, "rows": 120}
+//
+// Edits breaking the schema are answered with 422 and the rows breaking it.
+func (a *app) datasetEditsHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, d, err := a.pathDataset(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	var req apiDatasetEdits
+	err = decodeJSON(r, &req)
+	if err != nil {
+		return err
+	}
+	e := datasets.Edits{Version: req.Version, Delete: req.Delete, Add: req.Add}
+	for _, c := range req.Cells {
+		e.Cells = append(e.Cells, datasets.CellEdit{Row: c.Row, Column: c.Column, Value: c.Value})
+	}
+	c := datasets.Change{Author: currentUser(r), Message: req.Message}
+	d, err = a.datasets(prj).Edit(d.Name, e, c)
+	var serr *datasets.SchemaError
+	if errors.As(err, &serr) {
+		status := http.StatusUnprocessableEntity
+		res := apiSchemaError{
+			ErrorBody: utils.ErrorBody{Status: status, Error: serr.Error()},
+			Rows:      serr.Rows,
+			Errors:    make([]apiRowError, len(serr.Errors)),
+		}
+		for i, re := range serr.Errors {
+			res.Errors[i] = apiRowError{Row: re.Row, Column: re.Column, Value: re.Value, Reason: re.Reason}
+		}
+		return utils.WriteJSON(w, status, res)
+	}
+	if err != nil {
+		return err
+	}
+	return utils.WriteJSON(w, http.StatusOK, map[string]int{
+		"version": d.Version,
+		"rows":    d.Rows,
+	})
+}
@@ -0,0 +1,258 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"errors"
+	"github.com/scompo/data-management/datasets"
+	"github.com/scompo/data-management/export"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/queries"
+	"github.com/scompo/data-management/utils"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// datasetPageSize is the number of rows in a page of the table view.
+const datasetPageSize = 50
+
+// datasetRow is a row shown in the table view, Number starts from 1.
+type datasetRow struct {
+	Number int
+	Cells  []string
+}
+
+// datasets returns the store of the datasets of prj.
+func (a *app) datasets(prj projects.Project) *datasets.Store {
+	return datasets.NewStore(filepath.Join(a.dir, prj.ID))
+}
+
+// datasetURL returns the path of a dataset of a project.
+func datasetURL(prj projects.Project, name string) string {
+	return projectURL(prj) + "/datasets/" + url.PathEscape(name)
+}
+
+// pathDataset returns the project and the dataset named in the request path,
+// if the user has role in the project.
+func (a *app) pathDataset(r *http.Request, role projects.Role) (projects.Project, datasets.Dataset, error) {
+	prj, err := a.pathProject(r, role)
+	if err != nil {
+		return prj, datasets.Dataset{}, err
+	}
+	d, err := a.datasets(prj).Get(r.PathValue("name"))
+	return prj, d, err
+}
+
+// delimiter returns the delimiter named s in the import form: a single
+// character, or "tab".
+func delimiter(s string) (rune, bool) {
+	if s == "tab" {
+		return '\t', true
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	return r, size == len(s)
+}
+
+// importDatasetHandler imports the CSV File uploaded in a project, named
+// Name or as the file without the extension. Delimiter and Encoding tell
+// how to read it.
+func (a *app) importDatasetHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, err := a.pathProject(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	err = utils.ParseForm(r)
+	if err != nil {
+		return err
+	}
+	// the errors are shown on the project view, next to the import form.
+	formFailed := func(errs map[string]string) error {
+		datasetErrs := make(map[string]string)
+		for field, reason := range errs {
+			datasetErrs["Dataset"+field] = reason
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		return a.renderProjectView(w, r, prj, datasetErrs)
+	}
+	f, header, err := r.FormFile("File")
+	if err == http.ErrMissingFile {
+		return formFailed(map[string]string{"File": "choose a CSV file to import"})
+	}
+	if err != nil {
+		return utils.TooLarge(err)
+	}
+	defer f.Close()
+	var opts datasets.Options
+	if d := r.PostFormValue("Delimiter"); d != "" {
+		var ok bool
+		opts.Delimiter, ok = delimiter(d)
+		if !ok {
+			return formFailed(map[string]string{"Delimiter": "must be a single character"})
+		}
+	}
+	opts.Encoding = r.PostFormValue("Encoding")
+	source := uploadedName(header.Filename)
+	name := r.PostFormValue("Name")
+	if name == "" {
+		name = strings.TrimSuffix(source, filepath.Ext(source))
+	}
+	d, err := a.datasets(prj).Import(name, source, f, opts)
+	if errs, ok := formErrors(err); ok {
+		return formFailed(errs)
+	}
+	if err != nil {
+		return utils.TooLarge(err)
+	}
+	http.Redirect(w, r, datasetURL(prj, d.Name), http.StatusSeeOther)
+	return nil
+}
+
+// viewDatasetHandler shows the schema of a dataset and a page of its rows,
+// the one in the page parameter starting from 1.
+func (a *app) viewDatasetHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, d, err := a.pathDataset(r, projects.Viewer)
+	if err != nil {
+		return err
+	}
+	rows, page, pages, err := a.datasetPage(r, prj, d)
+	if err != nil {
+		return err
+	}
+	qs, err := a.datasetQueries(prj, d.Name)
+	if err != nil {
+		return err
+	}
+	t, err := prepareAppTemplate(r, "templates/datasets/view.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage": WebPage{
+			Title:       appName,
+			PageName:    d.Name,
+			Breadcrumbs: append(projectCrumbs(prj), Breadcrumb{Name: d.Name, URL: datasetURL(prj, d.Name)}),
+		},
+		"Project":  prj,
+		"Access":   newProjectItem(r, prj),
+		"Dataset":  d,
+		"Rows":     rows,
+		"Page":     page,
+		"Pages":    pages,
+		"Previous": page - 1,
+		"Next":     page + 1,
+		"QueryURL": queryURL(prj, datasetQuery(d.Name)+" LIMIT 100"),
+		"Formats":  export.Formats,
+		"Queries":  qs,
+	})
+}
+
+// datasetPage returns the rows of d in the page asked by the page parameter
+// of r, starting from 1, the page and the number of pages.
+func (a *app) datasetPage(r *http.Request, prj projects.Project, d datasets.Dataset) ([]datasetRow, int, int, error) {
+	pages := (d.Rows + datasetPageSize - 1) / datasetPageSize
+	page := 1
+	if s := r.URL.Query().Get("page"); s != "" {
+		var err error
+		page, err = strconv.Atoi(s)
+		if err != nil || page < 1 || (page > pages && page != 1) {
+			return nil, 0, 0, utils.NotFound(errors.New("page " + s + " of the dataset not found"))
+		}
+	}
+	first := (page - 1) * datasetPageSize
+	cells, err := a.datasets(prj).Rows(d.Name, first, datasetPageSize)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	rows := make([]datasetRow, len(cells))
+	for i, c := range cells {
+		rows[i] = datasetRow{Number: first + i + 1, Cells: c}
+	}
+	return rows, page, pages, nil
+}
+
+// datasetQueries returns the saved queries of prj reading the dataset name.
+func (a *app) datasetQueries(prj projects.Project, name string) ([]queries.Query, error) {
+	all, err := a.queries(prj).All()
+	if err != nil {
+		return nil, err
+	}
+	qs := make([]queries.Query, 0)
+	for _, q := range all {
+		if from, _ := utils.NormalizeName(q.Dataset()); from == name {
+			qs = append(qs, q)
+		}
+	}
+	return qs, nil
+}
+
+// deleteDatasetHandler asks for confirmation on GET, the dataset is deleted
+// only by POST or DELETE.
+func (a *app) deleteDatasetHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, d, err := a.pathDataset(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	switch r.Method {
+	case "POST", "DELETE":
+		err = a.datasets(prj).Delete(d.Name)
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, projectURL(prj), http.StatusSeeOther)
+		return nil
+	case "GET":
+		t, err := prepareAppTemplate(r, "templates/datasets/delete.html")
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, map[string]interface{}{
+			"WebPage": WebPage{
+				Title:       appName,
+				PageName:    "Delete Dataset",
+				Breadcrumbs: projectCrumbs(prj),
+			},
+			"Project": prj,
+			"Dataset": d,
+		})
+	default:
+		return utils.MethodNotAllowed(r.Method)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"errors"
+	"github.com/scompo/data-management/datasets"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/utils"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// columnTypes are the types a column can be given.
+var columnTypes = []datasets.Type{datasets.Int, datasets.Float, datasets.Bool, datasets.Date, datasets.String}
+
+// schemaColumn is a column in the schema form, its fields are named after
+// Index.
+type schemaColumn struct {
+	datasets.Column
+	Index      int
+	EnumText   string
+	RefDataset string
+	RefColumn  string
+}
+
+func schemaColumns(columns []datasets.Column) []schemaColumn {
+	scs := make([]schemaColumn, len(columns))
+	for i, c := range columns {
+		scs[i] = schemaColumn{Column: c, Index: i, EnumText: strings.Join(c.Enum, ", ")}
+		if c.References != nil {
+			scs[i].RefDataset = c.References.Dataset
+			scs[i].RefColumn = c.References.Column
+		}
+	}
+	return scs
+}
+
+// formSchema returns the columns of d with the types and the rules posted
+// in the schema form.
+func formSchema(r *http.Request, d datasets.Dataset) []datasets.Column {
+	columns := make([]datasets.Column, len(d.Columns))
+	for i, c := range d.Columns {
+		field := func(name string) string {
+			return strings.TrimSpace(r.PostFormValue(name + "-" + strconv.Itoa(i)))
+		}
+		columns[i] = datasets.Column{
+			Name:     c.Name,
+			Type:     datasets.Type(field("Type")),
+			Required: field("Required") != "",
+			Unique:   field("Unique") != "",
+			Min:      field("Min"),
+			Max:      field("Max"),
+			Pattern:  field("Pattern"),
+		}
+		for _, e := range strings.Split(field("Enum"), ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				columns[i].Enum = append(columns[i].Enum, e)
+			}
+		}
+		if ref := field("RefDataset"); ref != "" {
+			columns[i].References = &datasets.Reference{Dataset: ref, Column: field("RefColumn")}
+		}
+	}
+	return columns
+}
+
+// schemaHandler shows the schema of a dataset, with the form to change the
+// types and the rules of its columns.
+func (a *app) schemaHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, d, err := a.pathDataset(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	switch r.Method {
+	case "POST":
+		columns := formSchema(r, d)
+		_, err = a.datasets(prj).SetSchema(d.Name, columns)
+		var serr *datasets.SchemaError
+		if errors.As(err, &serr) {
+			return a.renderSchemaErrors(w, r, prj, d, "The rows of the dataset don't follow the new schema.", serr)
+		}
+		if errs, ok := formErrors(err); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			d.Columns = columns
+			return a.renderSchema(w, r, prj, d, errs)
+		}
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, datasetURL(prj, d.Name), http.StatusSeeOther)
+		return nil
+	case "GET":
+		return a.renderSchema(w, r, prj, d, nil)
+	default:
+		return utils.MethodNotAllowed(r.Method)
+	}
+}
+
+// renderSchema renders the schema form of d, errs are the validation errors
+// to show.
+func (a *app) renderSchema(w http.ResponseWriter, r *http.Request, prj projects.Project, d datasets.Dataset, errs map[string]string) error {
+	ds, err := a.datasets(prj).All()
+	if err != nil {
+		return err
+	}
+	t, err := prepareAppTemplate(r, "templates/datasets/schema.html")
+	if err != nil {
+		return err
+	}
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage": WebPage{
+			Title:       appName,
+			PageName:    "Schema",
+			Breadcrumbs: append(projectCrumbs(prj), Breadcrumb{Name: d.Name, URL: datasetURL(prj, d.Name)}),
+		},
+		"Project":  prj,
+		"Dataset":  d,
+		"Columns":  schemaColumns(d.Columns),
+		"Types":    columnTypes,
+		"Datasets": ds,
+		"Errors":   errs,
+	})
+}
+
+// renderSchemaErrors answers with the report of the rows of d breaking its
+// schema, after what failed.
+func (a *app) renderSchemaErrors(w http.ResponseWriter, r *http.Request, prj projects.Project, d datasets.Dataset, what string, serr *datasets.SchemaError) error {
+	t, err := prepareAppTemplate(r, "templates/datasets/errors.html")
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	return t.Execute(w, map[string]interface{}{
+		"WebPage": WebPage{
+			Title:       appName,
+			PageName:    "Schema Errors",
+			Breadcrumbs: append(projectCrumbs(prj), Breadcrumb{Name: d.Name, URL: datasetURL(prj, d.Name)}),
+		},
+		"Project": prj,
+		"Dataset": d,
+		"What":    what,
+		"Errors":  serr.Errors,
+		"Rows":    serr.Rows,
+	})
+}
+
+// uploadDatasetHandler replaces the rows of a dataset with the ones of the
+// CSV File uploaded, read as told by Delimiter and Encoding. The rows
+// breaking the schema are reported.
+func (a *app) uploadDatasetHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, d, err := a.pathDataset(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	err = utils.ParseForm(r)
+	if err != nil {
+		return err
+	}
+	f, header, err := r.FormFile("File")
+	if err == http.ErrMissingFile {
+		return utils.BadRequest(errors.New("choose a CSV file to upload"))
+	}
+	if err != nil {
+		return utils.TooLarge(err)
+	}
+	defer f.Close()
+	var opts datasets.Options
+	if s := r.PostFormValue("Delimiter"); s != "" {
+		var ok bool
+		opts.Delimiter, ok = delimiter(s)
+		if !ok {
+			return utils.BadRequest(errors.New("the delimiter must be a single character"))
+		}
+	}
+	opts.Encoding = r.PostFormValue("Encoding")
+	source := uploadedName(header.Filename)
+	_, err = a.datasets(prj).Replace(d.Name, source, f, opts, datasetChange(r))
+	var serr *datasets.SchemaError
+	if errors.As(err, &serr) {
+		return a.renderSchemaErrors(w, r, prj, d, "The rows of "+source+" don't follow the schema, the dataset was not changed.", serr)
+	}
+	if err != nil {
+		return utils.TooLarge(err)
+	}
+	http.Redirect(w, r, datasetURL(prj, d.Name), http.StatusSeeOther)
+	return nil
+}
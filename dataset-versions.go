@@ -0,0 +1,211 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/scompo/data-management/datasets"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/utils"
+	"net/http"
+	"strconv"
+)
+
+// datasetDiffRows is the maximum number of changed rows shown in a diff.
+const datasetDiffRows = 500
+
+// datasetChange returns the change described by the Message form value,
+// made by the user logged in.
+func datasetChange(r *http.Request) datasets.Change {
+	return datasets.Change{
+		Author:  currentUser(r),
+		Message: r.PostFormValue("Message"),
+	}
+}
+
+// versionNumber parses the version number s of the dataset name, a bad one
+// is a version not found.
+func versionNumber(name, s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v version %v", datasets.ErrNotFound, name, s)
+	}
+	return n, nil
+}
+
+// diffCell is a cell of a changed row, Changed when Old and New differ.
+type diffCell struct {
+	Old     string
+	New     string
+	Changed bool
+}
+
+// diffRow is a row shown in the diff of two versions.
+type diffRow struct {
+	Key   string
+	Kind  string
+	Cells []diffCell
+}
+
+func diffRows(changes []datasets.RowChange) []diffRow {
+	rows := make([]diffRow, len(changes))
+	for i, c := range changes {
+		rows[i] = diffRow{Key: c.Key, Kind: c.Kind}
+		cells := c.New
+		if cells == nil {
+			cells = c.Old
+		}
+		rows[i].Cells = make([]diffCell, len(cells))
+		for j := range cells {
+			cell := diffCell{}
+			if c.Old != nil {
+				cell.Old = c.Old[j]
+			}
+			if c.New != nil {
+				cell.New = c.New[j]
+			}
+			if c.Changed != nil {
+				cell.Changed = c.Changed[j]
+			}
+			rows[i].Cells[j] = cell
+		}
+	}
+	return rows
+}
+
+// datasetVersionsHandler lists the versions of a dataset.
+func (a *app) datasetVersionsHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, d, err := a.pathDataset(r, projects.Viewer)
+	if err != nil {
+		return err
+	}
+	vs, err := a.datasets(prj).Versions(d.Name)
+	if err != nil {
+		return err
+	}
+	t, err := prepareAppTemplate(r, "templates/datasets/versions.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage": WebPage{
+			Title:       appName,
+			PageName:    "Versions of " + d.Name,
+			Breadcrumbs: append(projectCrumbs(prj), Breadcrumb{Name: d.Name, URL: datasetURL(prj, d.Name)}),
+		},
+		"Project":  prj,
+		"Dataset":  d,
+		"Versions": vs,
+	})
+}
+
+// datasetDiffHandler shows the rows added, removed and changed between the
+// versions from and to of a dataset, matched by the column key.
+// By default the last version is compared with the one before.
+func (a *app) datasetDiffHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, d, err := a.pathDataset(r, projects.Viewer)
+	if err != nil {
+		return err
+	}
+	q := r.URL.Query()
+	to := d.Version
+	if s := q.Get("to"); s != "" {
+		to, err = versionNumber(d.Name, s)
+		if err != nil {
+			return err
+		}
+	}
+	from := to - 1
+	if s := q.Get("from"); s != "" {
+		from, err = versionNumber(d.Name, s)
+		if err != nil {
+			return err
+		}
+	}
+	if to == 0 {
+		return utils.NotFound(errors.New("the dataset " + d.Name + " has no versions"))
+	}
+	diff, err := a.datasets(prj).Diff(d.Name, from, to, q.Get("key"), datasetDiffRows)
+	if err != nil {
+		return err
+	}
+	t, err := prepareAppTemplate(r, "templates/datasets/diff.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage": WebPage{
+			Title:       appName,
+			PageName:    "Changes to " + d.Name,
+			Breadcrumbs: append(projectCrumbs(prj), Breadcrumb{Name: d.Name, URL: datasetURL(prj, d.Name)}),
+		},
+		"Project": prj,
+		"Dataset": d,
+		"Diff":    diff,
+		"Rows":    diffRows(diff.Changes),
+		"Shown":   len(diff.Changes),
+		"Total":   diff.Added + diff.Removed + diff.Changed,
+		"MaxRows": datasetDiffRows,
+	})
+}
+
+// revertDatasetHandler makes a new version of a dataset with the rows of an
+// old one.
+func (a *app) revertDatasetHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, d, err := a.pathDataset(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	n, err := versionNumber(d.Name, r.PathValue("n"))
+	if err != nil {
+		return err
+	}
+	_, err = a.datasets(prj).Revert(d.Name, n, datasetChange(r))
+	var serr *datasets.SchemaError
+	if errors.As(err, &serr) {
+		return a.renderSchemaErrors(w, r, prj, d, "The rows of the version "+strconv.Itoa(n)+" don't follow the current schema.", serr)
+	}
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, datasetURL(prj, d.Name), http.StatusSeeOther)
+	return nil
+}
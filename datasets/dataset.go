@@ -0,0 +1,405 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+// Package datasets contains the tabular data imported in a project from CSV
+// files, with the schema of their columns.
+package datasets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/scompo/data-management/utils"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// DirName is the directory inside a project where its datasets are saved.
+const DirName = "datasets"
+
+var metaName = "dataset.json"
+var dataName = "data.csv"
+
+// ErrNotFound is returned when a dataset does not exist.
+var ErrNotFound = errors.New("dataset not found")
+
+// ErrExists is returned when a dataset name is already used.
+var ErrExists = errors.New("dataset name already existent")
+
+// Column is a column of a dataset, with the rules its values follow.
+// Min and Max are the range of the values and Enum the values allowed, in
+// the format of Type. Pattern is a regular expression matching the whole
+// values.
+type Column struct {
+	Name       string
+	Type       Type
+	Required   bool       `json:",omitempty"`
+	Unique     bool       `json:",omitempty"`
+	Min        string     `json:",omitempty"`
+	Max        string     `json:",omitempty"`
+	Pattern    string     `json:",omitempty"`
+	Enum       []string   `json:",omitempty"`
+	References *Reference `json:",omitempty"`
+}
+
+// Dataset type definition
+// Rows is the number of rows, without the header. Source is the name of
+// the file imported. Version is the number of the current version of the
+// rows, 0 for the datasets imported before the versions.
+type Dataset struct {
+	Name    string
+	Columns []Column
+	Rows    int
+	Source  string
+	Created time.Time
+	Updated time.Time
+	Version int
+}
+
+// Options tell how to read a CSV file.
+// Delimiter defaults to a comma, Encoding to UTF-8. The encodings are
+// named like in the web browsers, for example "utf-8", "windows-1252" or
+// "iso-8859-1".
+type Options struct {
+	Delimiter rune
+	Encoding  string
+}
+
+var currentTime = time.Now
+
+// ValidationError is returned when a dataset field is not acceptable.
+type ValidationError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid dataset " + e.Field + " \"" + e.Value + "\": " + e.Reason
+}
+
+// Store saves the datasets of a project, a directory for every dataset
+// inside Dir with its details and its data, as UTF-8 CSV.
+type Store struct {
+	Dir string
+}
+
+// NewStore returns the Store for the datasets of the project in projectDir.
+func NewStore(projectDir string) *Store {
+	return &Store{Dir: filepath.Join(projectDir, DirName)}
+}
+
+// lock serializes the changes to the datasets of the project, between
+// goroutines and between processes sharing the directory.
+// The returned function releases it.
+func (s *Store) lock() (func(), error) {
+	err := os.MkdirAll(s.Dir, 0775)
+	if err != nil {
+		return nil, err
+	}
+	return utils.LockDir(s.Dir)
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.Dir, name)
+}
+
+// decoder returns r decoded to UTF-8 from the encoding in opts, without the
+// byte order mark if any.
+func decoder(r io.Reader, opts Options) (io.Reader, error) {
+	if opts.Encoding != "" {
+		enc, err := htmlindex.Get(opts.Encoding)
+		if err != nil {
+			return nil, &ValidationError{Field: "Encoding", Value: opts.Encoding, Reason: "not supported"}
+		}
+		r = enc.NewDecoder().Reader(r)
+	}
+	br := bufio.NewReader(r)
+	bom, err := br.Peek(3)
+	if err == nil && bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		br.Discard(3)
+	}
+	return br, nil
+}
+
+// csvError returns the error reading a CSV file, as a validation error of
+// the file when it's about its content.
+func csvError(err error) error {
+	var perr *csv.ParseError
+	if errors.As(err, &perr) {
+		return &ValidationError{Field: "File", Value: "line " + strconv.Itoa(perr.Line), Reason: perr.Err.Error()}
+	}
+	return err
+}
+
+// header returns the column names in record: the empty ones are named after
+// their position, and they have to be unique.
+func header(record []string) ([]string, error) {
+	names := make([]string, len(record))
+	seen := make(map[string]bool)
+	for i, name := range record {
+		if name == "" {
+			name = "column " + strconv.Itoa(i+1)
+		}
+		if seen[name] {
+			return nil, &ValidationError{Field: "File", Value: name, Reason: "duplicate column"}
+		}
+		seen[name] = true
+		names[i] = name
+	}
+	return names, nil
+}
+
+// reader returns r decoded to UTF-8 as told by opts, setting the default
+// delimiter.
+func reader(r io.Reader, opts *Options) (io.Reader, error) {
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+	if opts.Delimiter == '"' || opts.Delimiter == '\r' || opts.Delimiter == '\n' {
+		return nil, &ValidationError{Field: "Delimiter", Value: string(opts.Delimiter), Reason: "not supported"}
+	}
+	return decoder(r, *opts)
+}
+
+// Import saves the CSV file read from r as the dataset name, inferring the
+// types of its columns. The first row of the file has the column names.
+// source is the name of the file, to remember where the data came from.
+// Returns an error if a dataset with the same name already exists.
+func (s *Store) Import(name, source string, r io.Reader, opts Options) (Dataset, error) {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return Dataset{}, err
+	}
+	r, err = reader(r, &opts)
+	if err != nil {
+		return Dataset{}, err
+	}
+	err = os.MkdirAll(s.Dir, 0775)
+	if err != nil {
+		return Dataset{}, err
+	}
+	// creating the directory is what reserves the name.
+	err = os.Mkdir(s.path(name), 0775)
+	if os.IsExist(err) {
+		return Dataset{}, fmt.Errorf("%w: %v", ErrExists, name)
+	}
+	if err != nil {
+		return Dataset{}, err
+	}
+	d := Dataset{Name: name, Source: source}
+	err = s.writeData(&d, r, opts)
+	if err == nil {
+		d.Created = currentTime()
+		d.Updated = d.Created
+		err = s.snapshot(&d, Change{Message: "Imported " + source}, d.Created)
+	}
+	if err == nil {
+		err = s.writeMeta(d)
+	}
+	if err != nil {
+		os.RemoveAll(s.path(name))
+		return Dataset{}, err
+	}
+	return d, nil
+}
+
+// writeData copies the CSV file read from r in the data of d, as UTF-8 and
+// comma separated, setting its columns and rows.
+func (s *Store) writeData(d *Dataset, r io.Reader, opts Options) error {
+	cr := csv.NewReader(r)
+	cr.Comma = opts.Delimiter
+	cr.ReuseRecord = true
+	return utils.WriteAtomicFunc(filepath.Join(s.path(d.Name), dataName), func(w io.Writer) error {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return &ValidationError{Field: "File", Value: d.Source, Reason: "empty file"}
+		}
+		if err != nil {
+			return csvError(err)
+		}
+		names, err := header(record)
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(w)
+		cw.Write(names)
+		in := newInference(len(names))
+		d.Rows = 0
+		for {
+			record, err = cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return csvError(err)
+			}
+			in.add(record)
+			err = cw.Write(record)
+			if err != nil {
+				return err
+			}
+			d.Rows++
+		}
+		cw.Flush()
+		d.Columns = make([]Column, len(names))
+		for i, t := range in.types() {
+			d.Columns[i] = Column{Name: names[i], Type: t}
+		}
+		return cw.Error()
+	})
+}
+
+func (s *Store) writeMeta(d Dataset) error {
+	meta, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(s.path(d.Name), metaName), meta)
+}
+
+// Get returns a dataset by name.
+func (s *Store) Get(name string) (Dataset, error) {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return Dataset{}, err
+	}
+	meta, err := ioutil.ReadFile(filepath.Join(s.path(name), metaName))
+	if os.IsNotExist(err) {
+		return Dataset{}, fmt.Errorf("%w: %v", ErrNotFound, name)
+	}
+	if err != nil {
+		return Dataset{}, err
+	}
+	var d Dataset
+	err = json.Unmarshal(meta, &d)
+	return d, err
+}
+
+// All returns all the datasets sorted by name.
+func (s *Store) All() ([]Dataset, error) {
+	infos, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return []Dataset{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ds := make([]Dataset, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		d, err := s.Get(info.Name())
+		if errors.Is(err, ErrNotFound) {
+			// a dataset being imported.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].Name < ds[j].Name
+	})
+	return ds, nil
+}
+
+// Delete deletes a dataset by name.
+// Deleting a dataset that does not exist is not an error.
+func (s *Store) Delete(name string) error {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(s.path(name))
+}
+
+// Reader reads the rows of a dataset, one at a time.
+type Reader struct {
+	Dataset Dataset
+	f       *os.File
+	r       *csv.Reader
+}
+
+// Open returns a Reader for the rows of the dataset name, without the
+// header. The Reader has to be closed after use.
+func (s *Store) Open(name string) (*Reader, error) {
+	d, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(d, filepath.Join(s.path(d.Name), dataName))
+}
+
+// Read returns the next row, io.EOF when there are no more.
+func (r *Reader) Read() ([]string, error) {
+	return r.r.Read()
+}
+
+// Close closes the data of the dataset.
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
+
+// Rows returns at most limit rows of the dataset name, skipping the first
+// offset ones.
+func (s *Store) Rows(name string, offset, limit int) ([][]string, error) {
+	r, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	rows := make([][]string, 0, limit)
+	for i := 0; len(rows) < limit; i++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if i >= offset {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,186 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package datasets
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+var testTime = time.Now()
+
+func setup(t *testing.T) *Store {
+	currentTime = func() time.Time {
+		return testTime
+	}
+	t.Cleanup(func() {
+		currentTime = time.Now
+	})
+	return NewStore(t.TempDir())
+}
+
+func TestImportCodes(t *testing.T) {
+	s := setup(t)
+
+	csv := "code,amount,negative\n01234,0,-1\n00567,0.5,-02\n"
+	d, err := s.Import("codes", "", strings.NewReader(csv), Options{})
+	if err != nil {
+		t.Fatalf("Error importing: %v\n", err)
+	}
+	if d.Columns[0].Type != String || d.Columns[1].Type != Float || d.Columns[2].Type != String {
+		t.Errorf("the numbers with leading zeros should be text: %+v", d.Columns)
+	}
+}
+
+func TestImportNotNumbers(t *testing.T) {
+	s := setup(t)
+
+	csv := "nan,inf,hex,big,small\nNaN,Inf,0x1p-2,12345678901234567890,1.5\n1,-infinity,2,1,-99999999999999999999\n"
+	d, err := s.Import("special", "", strings.NewReader(csv), Options{})
+	if err != nil {
+		t.Fatalf("Error importing: %v\n", err)
+	}
+	for _, c := range d.Columns {
+		if c.Type != String {
+			t.Errorf("the column %v should be text: %+v", c.Name, d.Columns)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	s := setup(t)
+
+	csv := "id,price,ok,day,name,\n1,1.5,true,2020-01-02,a,\n2,2,no,2020-01-03,\"b, c\",\n,,,,,\n"
+	d, err := s.Import("sales", "sales.csv", strings.NewReader(csv), Options{})
+	if err != nil {
+		t.Fatalf("Error importing: %v\n", err)
+	}
+	expected := []Column{
+		{Name: "id", Type: Int}, {Name: "price", Type: Float}, {Name: "ok", Type: Bool},
+		{Name: "day", Type: Date}, {Name: "name", Type: String}, {Name: "column 6", Type: String},
+	}
+	if len(d.Columns) != len(expected) || d.Rows != 3 || !testTime.Equal(d.Created) {
+		t.Fatalf("wrong dataset imported: %+v", d)
+	}
+	for i, c := range expected {
+		if d.Columns[i].Name != c.Name || d.Columns[i].Type != c.Type {
+			t.Errorf("Expected column %+v, but was %+v", c, d.Columns[i])
+		}
+	}
+	saved, err := s.Get("sales")
+	if err != nil || saved.Rows != 3 || saved.Source != "sales.csv" {
+		t.Errorf("wrong dataset saved: %+v, %v", saved, err)
+	}
+	rows, err := s.Rows("sales", 1, 5)
+	if err != nil || len(rows) != 2 || rows[0][4] != "b, c" {
+		t.Errorf("wrong rows: %v, %v", rows, err)
+	}
+	if _, err := s.Import("sales", "", strings.NewReader(csv), Options{}); !errors.Is(err, ErrExists) {
+		t.Errorf("no error for dataset name already existent: %v\n", err)
+	}
+	if _, err := s.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for dataset not existent: %v\n", err)
+	}
+}
+
+func TestImportOptions(t *testing.T) {
+	s := setup(t)
+
+	var latin1 bytes.Buffer
+	w := charmap.ISO8859_1.NewEncoder().Writer(&latin1)
+	w.Write([]byte("città;abitanti\nMilano;1352000\n"))
+	d, err := s.Import("cities", "", &latin1, Options{Delimiter: ';', Encoding: "iso-8859-1"})
+	if err != nil {
+		t.Fatalf("Error importing: %v\n", err)
+	}
+	if d.Columns[0].Name != "città" || d.Columns[1].Type != Int {
+		t.Errorf("wrong columns: %+v", d.Columns)
+	}
+	d, err = s.Import("bom", "", strings.NewReader("\xef\xbb\xbfa\tb\n1\t2\n"), Options{Delimiter: '\t'})
+	if err != nil || d.Columns[0].Name != "a" {
+		t.Errorf("the byte order mark should be skipped: %+v, %v", d, err)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	s := setup(t)
+
+	tests := []struct {
+		src  string
+		opts Options
+	}{
+		{"", Options{}},
+		{"a,a\n1,2\n", Options{}},
+		{"a,b\n1,2,3\n", Options{}},
+		{"a,b\n\"1,2\n", Options{}},
+		{"a,b\n", Options{Encoding: "klingon"}},
+		{"a,b\n", Options{Delimiter: '"'}},
+	}
+	for i, test := range tests {
+		var verr *ValidationError
+		if _, err := s.Import("bad", "", strings.NewReader(test.src), test.opts); !errors.As(err, &verr) {
+			t.Errorf("%v: Expected validation error: %v\n", i, err)
+		}
+	}
+	ds, err := s.All()
+	if err != nil || len(ds) != 0 {
+		t.Errorf("failed imports should leave nothing: %+v, %v", ds, err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		t        Type
+		s        string
+		expected interface{}
+	}{
+		{Int, "42", int64(42)},
+		{Float, "1.5", 1.5},
+		{Bool, "Yes", true},
+		{Date, "2020-01-02", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{String, "x", "x"},
+		{Int, "", nil},
+	}
+	for _, test := range tests {
+		v, err := Parse(test.t, test.s)
+		if err != nil || v != test.expected {
+			t.Errorf("Expected %v for %v \"%v\", but was %v, %v", test.expected, test.t, test.s, v, err)
+		}
+	}
+	if _, err := Parse(Int, "1.5"); err == nil {
+		t.Errorf("Expected error parsing 1.5 as int")
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package datasets
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+
+	"github.com/scompo/data-management/utils"
+)
+
+// ErrConflict is returned editing a dataset changed since the edits were
+// made.
+var ErrConflict = errors.New("dataset changed since the edits were made")
+
+// CellEdit sets the value of the column Column in the row Row.
+type CellEdit struct {
+	Row    int
+	Column string
+	Value  string
+}
+
+// Edits is a batch of changes to the rows of a dataset, made on its version
+// Version. The rows are numbered from 1 as in that version, the rows added
+// follow them: the errors about the rows are numbered the same way.
+// The cells of the rows deleted are not changed.
+type Edits struct {
+	Version int
+	Cells   []CellEdit
+	Delete  []int
+	Add     []map[string]string
+}
+
+// rowError returns the error for the row of an edit, nil if it is in d.
+func rowError(d Dataset, row int) error {
+	if row < 1 || row > d.Rows {
+		return &ValidationError{Field: "Row", Value: strconv.Itoa(row), Reason: "not a row of the dataset"}
+	}
+	return nil
+}
+
+// Edit applies the edits e to the rows of the dataset name, saving them as
+// a new version made by c. The rows have to follow the schema, otherwise
+// nothing changes and a SchemaError is returned.
+// If c has no message one counting the changes is used.
+func (s *Store) Edit(name string, e Edits, c Change) (Dataset, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer unlock()
+	d, err := s.Get(name)
+	if err != nil {
+		return Dataset{}, err
+	}
+	if e.Version != d.Version {
+		return Dataset{}, fmt.Errorf("%w: %v is at version %v, not %v", ErrConflict, d.Name, d.Version, e.Version)
+	}
+	if len(e.Cells)+len(e.Delete)+len(e.Add) == 0 {
+		return Dataset{}, &ValidationError{Field: "Edits", Reason: "nothing to change"}
+	}
+	// cells has the new values of the cells by row and column.
+	cells := make(map[int]map[int]string)
+	for _, ce := range e.Cells {
+		if err := rowError(d, ce.Row); err != nil {
+			return Dataset{}, err
+		}
+		i := columnIndex(d.Columns, ce.Column)
+		if i < 0 {
+			return Dataset{}, &ValidationError{Field: "Column", Value: ce.Column, Reason: "not in the schema"}
+		}
+		if cells[ce.Row] == nil {
+			cells[ce.Row] = make(map[int]string)
+		}
+		cells[ce.Row][i] = ce.Value
+	}
+	deleted := make(map[int]bool)
+	for _, row := range e.Delete {
+		if err := rowError(d, row); err != nil {
+			return Dataset{}, err
+		}
+		deleted[row] = true
+	}
+	added := make([][]string, len(e.Add))
+	for i, values := range e.Add {
+		added[i] = make([]string, len(d.Columns))
+		for column, v := range values {
+			j := columnIndex(d.Columns, column)
+			if j < 0 {
+				return Dataset{}, &ValidationError{Field: "Column", Value: column, Reason: "not in the schema"}
+			}
+			added[i][j] = v
+		}
+	}
+	err = s.legacy(&d)
+	if err != nil {
+		return Dataset{}, err
+	}
+	r, err := s.Open(d.Name)
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer r.Close()
+	rows := 0
+	err = utils.WriteAtomicFunc(filepath.Join(s.path(d.Name), dataName), func(w io.Writer) error {
+		cw := csv.NewWriter(w)
+		cw.Write(columnNames(d.Columns))
+		row := 0
+		err := s.checkNumbered(d.Name, d.Columns, func() (int, []string, error) {
+			for {
+				row++
+				if row > d.Rows {
+					if row > d.Rows+len(added) {
+						return row, nil, io.EOF
+					}
+					rows++
+					record := added[row-d.Rows-1]
+					return row, record, cw.Write(record)
+				}
+				record, err := r.Read()
+				if err == io.EOF {
+					return row, nil, errors.New("dataset " + d.Name + " shorter than its details")
+				}
+				if err != nil {
+					return row, nil, err
+				}
+				if deleted[row] {
+					continue
+				}
+				for i, v := range cells[row] {
+					record[i] = v
+				}
+				rows++
+				return row, record, cw.Write(record)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		cw.Flush()
+		return cw.Error()
+	})
+	if err != nil {
+		return Dataset{}, err
+	}
+	if c.Message == "" {
+		c.Message = fmt.Sprintf("Edited %v cells, added %v rows and deleted %v", len(e.Cells), len(e.Add), len(deleted))
+	}
+	d.Rows = rows
+	d.Updated = currentTime()
+	err = s.snapshot(&d, c, d.Updated)
+	if err != nil {
+		return Dataset{}, err
+	}
+	return d, s.writeMeta(d)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package datasets
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEdit(t *testing.T) {
+	s := setup(t)
+
+	d := importTest(t, s, "sales", "id,name\n1,a\n2,b\n3,c\n")
+	d.Columns[0].Unique = true
+	if _, err := s.SetSchema("sales", d.Columns); err != nil {
+		t.Fatalf("Error setting the schema: %v\n", err)
+	}
+	d, err := s.Edit("sales", Edits{
+		Version: 1,
+		Cells:   []CellEdit{{Row: 1, Column: "name", Value: "x"}, {Row: 2, Column: "name", Value: "y"}},
+		Delete:  []int{2},
+		Add:     []map[string]string{{"id": "4", "name": "d"}},
+	}, Change{Author: "mauro"})
+	if err != nil || d.Version != 2 || d.Rows != 3 {
+		t.Fatalf("Error editing: %+v, %v\n", d, err)
+	}
+	rows, _ := s.Rows("sales", 0, 10)
+	if len(rows) != 3 || rows[0][1] != "x" || rows[1][0] != "3" || rows[2][0] != "4" || rows[2][1] != "d" {
+		t.Errorf("rows not edited: %v", rows)
+	}
+	v, _ := s.Version("sales", 2)
+	if v.Author != "mauro" || v.Message != "Edited 2 cells, added 1 rows and deleted 1" {
+		t.Errorf("wrong version: %+v", v)
+	}
+
+	if _, err := s.Edit("sales", Edits{Version: 1, Delete: []int{1}}, Change{}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected conflict editing an old version: %v\n", err)
+	}
+	var verr *ValidationError
+	for _, e := range []Edits{
+		{Version: 2},
+		{Version: 2, Delete: []int{4}},
+		{Version: 2, Cells: []CellEdit{{Row: 1, Column: "missing"}}},
+		{Version: 2, Add: []map[string]string{{"missing": "1"}}},
+	} {
+		if _, err := s.Edit("sales", e, Change{}); !errors.As(err, &verr) {
+			t.Errorf("Expected validation error for %+v: %v\n", e, err)
+		}
+	}
+	// the added row is numbered after the existing ones.
+	var serr *SchemaError
+	_, err = s.Edit("sales", Edits{Version: 2, Add: []map[string]string{{"id": "3"}}}, Change{})
+	if !errors.As(err, &serr) || len(serr.Errors) != 1 || serr.Errors[0].Row != 4 || serr.Errors[0].Reason != "duplicate of row 2" {
+		t.Errorf("Expected schema error for the added row: %+v, %v", serr, err)
+	}
+	if d, _ := s.Get("sales"); d.Version != 2 || d.Rows != 3 {
+		t.Errorf("the dataset changed on errors: %+v", d)
+	}
+}
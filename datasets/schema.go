@@ -0,0 +1,479 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package datasets
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scompo/data-management/utils"
+)
+
+// maxRowErrors is the maximum number of errors kept in a SchemaError.
+const maxRowErrors = 100
+
+// Reference tells that the values of a column have to be values of Column
+// in the dataset Dataset of the same project.
+type Reference struct {
+	Dataset string
+	Column  string
+}
+
+// RowError is a value of a row breaking a rule of the schema. Row starts
+// from 1, the header is row 0.
+type RowError struct {
+	Row    int
+	Column string
+	Value  string
+	Reason string
+}
+
+// SchemaError is returned when the rows of a dataset break its schema.
+// Errors are the first ones found, Rows the number of rows with errors.
+type SchemaError struct {
+	Dataset string
+	Errors  []RowError
+	Rows    int
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%v rows of the dataset %v break its schema", e.Rows, e.Dataset)
+}
+
+// compareValues compares two values of the same type returned by Parse.
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int64:
+		b := b.(int64)
+		return cmp(a < b, a > b)
+	case float64:
+		b := b.(float64)
+		return cmp(a < b, a > b)
+	case time.Time:
+		b := b.(time.Time)
+		return cmp(a.Before(b), a.After(b))
+	case bool:
+		b := b.(bool)
+		return cmp(!a && b, a && !b)
+	}
+	return strings.Compare(a.(string), b.(string))
+}
+
+func cmp(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// valueKey returns the text telling apart the values returned by Parse.
+func valueKey(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+// checker checks the rows of a dataset against the rules of its columns.
+type checker struct {
+	dataset  string
+	columns  []Column
+	mins     []interface{}
+	maxs     []interface{}
+	patterns []*regexp.Regexp
+	enums    []map[string]bool
+	// seen are the rows of the values found so far in the unique columns.
+	seen []map[string]int
+	// refs are the values of the referenced columns.
+	refs   []map[string]bool
+	errors []RowError
+	rows   int
+}
+
+// ruleError returns the error of a rule of the column c.
+func ruleError(c Column, reason string) error {
+	return &ValidationError{Field: "Schema", Value: c.Name, Reason: reason}
+}
+
+// newChecker returns a checker for the rules of the columns of the dataset
+// name, reading the values referenced from the other datasets of s.
+func (s *Store) newChecker(name string, columns []Column) (*checker, error) {
+	n := len(columns)
+	c := &checker{
+		dataset:  name,
+		columns:  columns,
+		mins:     make([]interface{}, n),
+		maxs:     make([]interface{}, n),
+		patterns: make([]*regexp.Regexp, n),
+		enums:    make([]map[string]bool, n),
+		seen:     make([]map[string]int, n),
+		refs:     make([]map[string]bool, n),
+	}
+	for i, col := range columns {
+		if !knownType(col.Type) {
+			return nil, ruleError(col, "unknown type "+string(col.Type))
+		}
+		var err error
+		if col.Min != "" {
+			c.mins[i], err = Parse(col.Type, col.Min)
+			if err != nil {
+				return nil, ruleError(col, "the minimum "+col.Min+" is not a valid "+string(col.Type))
+			}
+		}
+		if col.Max != "" {
+			c.maxs[i], err = Parse(col.Type, col.Max)
+			if err != nil {
+				return nil, ruleError(col, "the maximum "+col.Max+" is not a valid "+string(col.Type))
+			}
+		}
+		if c.mins[i] != nil && c.maxs[i] != nil && compareValues(c.mins[i], c.maxs[i]) > 0 {
+			return nil, ruleError(col, "the minimum is greater than the maximum")
+		}
+		if col.Pattern != "" {
+			c.patterns[i], err = regexp.Compile("^(?:" + col.Pattern + ")$")
+			if err != nil {
+				return nil, ruleError(col, "invalid pattern: "+err.Error())
+			}
+		}
+		if len(col.Enum) > 0 {
+			c.enums[i] = make(map[string]bool)
+			for _, e := range col.Enum {
+				v, err := Parse(col.Type, e)
+				if err != nil || v == nil {
+					return nil, ruleError(col, "the allowed value \""+e+"\" is not a valid "+string(col.Type))
+				}
+				c.enums[i][valueKey(v)] = true
+			}
+		}
+		if col.Unique {
+			c.seen[i] = make(map[string]int)
+		}
+		if col.References != nil {
+			c.refs[i], err = s.referenced(col)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c, nil
+}
+
+func knownType(t Type) bool {
+	for _, known := range types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// referenced returns the values of the column referenced by c.
+func (s *Store) referenced(c Column) (map[string]bool, error) {
+	ref := c.References
+	r, err := s.Open(ref.Dataset)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ruleError(c, "the referenced dataset "+ref.Dataset+" does not exist")
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	col := -1
+	for i, rc := range r.Dataset.Columns {
+		if rc.Name == ref.Column {
+			col = i
+		}
+	}
+	if col < 0 {
+		return nil, ruleError(c, "the referenced dataset "+ref.Dataset+" has no column "+ref.Column)
+	}
+	values := make(map[string]bool)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		v, err := Parse(r.Dataset.Columns[col].Type, record[col])
+		if err == nil && v != nil {
+			values[valueKey(v)] = true
+		}
+	}
+}
+
+func (c *checker) fail(e RowError) {
+	if len(c.errors) < maxRowErrors {
+		c.errors = append(c.errors, e)
+	}
+}
+
+// check checks the row number row, returns false if it breaks the rules.
+func (c *checker) check(row int, record []string) bool {
+	errs := len(c.errors)
+	failed := false
+	fail := func(col Column, value, reason string) {
+		failed = true
+		c.fail(RowError{Row: row, Column: col.Name, Value: value, Reason: reason})
+	}
+	for i, col := range c.columns {
+		s := ""
+		if i < len(record) {
+			s = record[i]
+		}
+		v, err := Parse(col.Type, s)
+		switch {
+		case err != nil:
+			fail(col, s, "not a valid "+string(col.Type))
+			continue
+		case v == nil:
+			if col.Required {
+				fail(col, s, "required")
+			}
+			continue
+		case c.mins[i] != nil && compareValues(v, c.mins[i]) < 0:
+			fail(col, s, "less than "+col.Min)
+		case c.maxs[i] != nil && compareValues(v, c.maxs[i]) > 0:
+			fail(col, s, "greater than "+col.Max)
+		}
+		if c.patterns[i] != nil && !c.patterns[i].MatchString(s) {
+			fail(col, s, "does not match "+col.Pattern)
+		}
+		key := valueKey(v)
+		if c.enums[i] != nil && !c.enums[i][key] {
+			fail(col, s, "not one of "+strings.Join(col.Enum, ", "))
+		}
+		if c.seen[i] != nil {
+			if first, ok := c.seen[i][key]; ok {
+				fail(col, s, "duplicate of row "+strconv.Itoa(first))
+			} else {
+				c.seen[i][key] = row
+			}
+		}
+		if c.refs[i] != nil && !c.refs[i][key] {
+			fail(col, s, "not found in "+col.References.Column+" of "+col.References.Dataset)
+		}
+	}
+	if failed || len(c.errors) > errs {
+		c.rows++
+		return false
+	}
+	return true
+}
+
+// err returns the SchemaError for the rows checked, nil if they are fine.
+func (c *checker) err() error {
+	if c.rows == 0 {
+		return nil
+	}
+	return &SchemaError{Dataset: c.dataset, Errors: c.errors, Rows: c.rows}
+}
+
+// Check checks the rows read by next, the rows of the dataset name, against
+// the columns and their rules; next returns io.EOF after the last row.
+// Returns a SchemaError if some rows break the rules.
+func (s *Store) Check(name string, columns []Column, next func() ([]string, error)) error {
+	row := 0
+	return s.checkNumbered(name, columns, func() (int, []string, error) {
+		record, err := next()
+		row++
+		return row, record, err
+	})
+}
+
+// checkNumbered is Check for rows that next numbers itself.
+func (s *Store) checkNumbered(name string, columns []Column, next func() (int, []string, error)) error {
+	c, err := s.newChecker(name, columns)
+	if err != nil {
+		return err
+	}
+	for {
+		row, record, err := next()
+		if err == io.EOF {
+			return c.err()
+		}
+		if err != nil {
+			return err
+		}
+		c.check(row, record)
+	}
+}
+
+// SetSchema changes the types and the rules of the columns of the dataset
+// name, after checking that its rows follow them. The columns have to be
+// the ones of the dataset, in the same order.
+func (s *Store) SetSchema(name string, columns []Column) (Dataset, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer unlock()
+	d, err := s.Get(name)
+	if err != nil {
+		return Dataset{}, err
+	}
+	if len(columns) != len(d.Columns) {
+		return Dataset{}, &ValidationError{Field: "Schema", Value: d.Name, Reason: "the columns can't change"}
+	}
+	for i, c := range columns {
+		if c.Name != d.Columns[i].Name {
+			return Dataset{}, &ValidationError{Field: "Schema", Value: c.Name, Reason: "the columns can't change"}
+		}
+	}
+	r, err := s.Open(d.Name)
+	if err != nil {
+		return Dataset{}, err
+	}
+	err = s.Check(d.Name, columns, r.Read)
+	r.Close()
+	if err != nil {
+		return Dataset{}, err
+	}
+	d.Columns = columns
+	d.Updated = currentTime()
+	return d, s.writeMeta(d)
+}
+
+// Replace replaces the rows of the dataset name with the ones of the CSV
+// file read from r, checking them against its schema, as a new version.
+// The columns of the file are matched by name, the missing ones are left
+// empty. source is the name of the file.
+// If c has no message one saying what was uploaded is used.
+func (s *Store) Replace(name, source string, r io.Reader, opts Options, c Change) (Dataset, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer unlock()
+	d, err := s.Get(name)
+	if err != nil {
+		return Dataset{}, err
+	}
+	err = s.legacy(&d)
+	if err != nil {
+		return Dataset{}, err
+	}
+	r, err = reader(r, &opts)
+	if err != nil {
+		return Dataset{}, err
+	}
+	cr := csv.NewReader(r)
+	cr.Comma = opts.Delimiter
+	d.Source = source
+	err = utils.WriteAtomicFunc(filepath.Join(s.path(d.Name), dataName), func(w io.Writer) error {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return &ValidationError{Field: "File", Value: source, Reason: "empty file"}
+		}
+		if err != nil {
+			return csvError(err)
+		}
+		names, err := header(record)
+		if err != nil {
+			return err
+		}
+		// positions has the position in the file of every column.
+		positions := make([]int, len(d.Columns))
+		for i := range positions {
+			positions[i] = -1
+		}
+		var unknown []RowError
+		for i, n := range names {
+			found := false
+			for j, c := range d.Columns {
+				if c.Name == n {
+					positions[j] = i
+					found = true
+				}
+			}
+			if !found {
+				unknown = append(unknown, RowError{Column: n, Reason: "not in the schema"})
+			}
+		}
+		if len(unknown) > 0 {
+			return &SchemaError{Dataset: d.Name, Errors: unknown, Rows: 1}
+		}
+		cw := csv.NewWriter(w)
+		cw.Write(columnNames(d.Columns))
+		d.Rows = 0
+		row := make([]string, len(d.Columns))
+		err = s.Check(d.Name, d.Columns, func() ([]string, error) {
+			record, err := cr.Read()
+			if err != nil {
+				return nil, csvError(err)
+			}
+			for i, p := range positions {
+				row[i] = ""
+				if p >= 0 && p < len(record) {
+					row[i] = record[p]
+				}
+			}
+			d.Rows++
+			return row, cw.Write(row)
+		})
+		if err != nil {
+			return err
+		}
+		cw.Flush()
+		return cw.Error()
+	})
+	if err != nil {
+		return Dataset{}, err
+	}
+	if c.Message == "" {
+		c.Message = "Uploaded " + source
+	}
+	d.Updated = currentTime()
+	err = s.snapshot(&d, c, d.Updated)
+	if err != nil {
+		return Dataset{}, err
+	}
+	return d, s.writeMeta(d)
+}
+
+func columnNames(columns []Column) []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.Name
+	}
+	return names
+}
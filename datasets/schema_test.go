@@ -0,0 +1,162 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package datasets
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// importTest imports the CSV data as the dataset name.
+func importTest(t *testing.T, s *Store, name, data string) Dataset {
+	d, err := s.Import(name, name+".csv", strings.NewReader(data), Options{})
+	if err != nil {
+		t.Fatalf("Error importing: %v\n", err)
+	}
+	return d
+}
+
+func TestSetSchema(t *testing.T) {
+	s := setup(t)
+
+	importTest(t, s, "regions", "code\nN\nS\n")
+	d := importTest(t, s, "sales", "id,region,amount,status\n1,N,10,open\n2,S,20,closed\n3,N,,open\n")
+	rules := func(change func(c []Column)) []Column {
+		columns := append([]Column(nil), d.Columns...)
+		change(columns)
+		return columns
+	}
+	fine := rules(func(c []Column) {
+		c[0].Unique, c[0].Required, c[0].Min = true, true, "1"
+		c[1].References = &Reference{Dataset: "regions", Column: "code"}
+		c[2].Max = "20"
+		c[3].Enum = []string{"open", "closed"}
+		c[3].Pattern = "[a-z]+"
+	})
+	saved, err := s.SetSchema("sales", fine)
+	if err != nil {
+		t.Fatalf("Error setting the schema: %v\n", err)
+	}
+	if !saved.Columns[0].Unique || saved.Columns[1].References == nil {
+		t.Errorf("schema not saved: %+v", saved.Columns)
+	}
+	got, _ := s.Get("sales")
+	if got.Columns[3].Pattern != "[a-z]+" || len(got.Columns[3].Enum) != 2 {
+		t.Errorf("schema not saved: %+v", got.Columns)
+	}
+
+	tests := []struct {
+		change func(c []Column)
+		errors []RowError
+	}{
+		{func(c []Column) { c[2].Required = true }, []RowError{{3, "amount", "", "required"}}},
+		{func(c []Column) { c[2].Min = "15" }, []RowError{{1, "amount", "10", "less than 15"}}},
+		{func(c []Column) { c[3].Enum = []string{"open"} }, []RowError{{2, "status", "closed", "not one of open"}}},
+		{func(c []Column) { c[3].Pattern = "o.*" }, []RowError{{2, "status", "closed", "does not match o.*"}}},
+		{func(c []Column) { c[1].Unique = true }, []RowError{{3, "region", "N", "duplicate of row 1"}}},
+		{func(c []Column) { c[3].Type = Int }, []RowError{
+			{1, "status", "open", "not a valid int"}, {2, "status", "closed", "not a valid int"}, {3, "status", "open", "not a valid int"},
+		}},
+	}
+	for _, test := range tests {
+		_, err := s.SetSchema("sales", rules(test.change))
+		var serr *SchemaError
+		if !errors.As(err, &serr) {
+			t.Errorf("Expected schema error, but was %v", err)
+			continue
+		}
+		if len(serr.Errors) != len(test.errors) || serr.Rows != len(test.errors) {
+			t.Errorf("Expected errors %+v, but were %+v", test.errors, serr.Errors)
+			continue
+		}
+		for i, e := range test.errors {
+			if serr.Errors[i] != e {
+				t.Errorf("Expected error %+v, but was %+v", e, serr.Errors[i])
+			}
+		}
+	}
+
+	var verr *ValidationError
+	for _, change := range []func(c []Column){
+		func(c []Column) { c[0].Min = "one" },
+		func(c []Column) { c[0].Min, c[0].Max = "5", "1" },
+		func(c []Column) { c[3].Pattern = "(" },
+		func(c []Column) { c[0].Enum = []string{"x"} },
+		func(c []Column) { c[0].Type = "decimal" },
+		func(c []Column) { c[1].References = &Reference{Dataset: "missing", Column: "code"} },
+		func(c []Column) { c[1].References = &Reference{Dataset: "regions", Column: "missing"} },
+		func(c []Column) { c[0].Name = "renamed" },
+	} {
+		if _, err := s.SetSchema("sales", rules(change)); !errors.As(err, &verr) {
+			t.Errorf("Expected validation error, but was %v", err)
+		}
+	}
+	if _, err := s.SetSchema("missing", fine); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for dataset not existent: %v\n", err)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	s := setup(t)
+
+	d := importTest(t, s, "sales", "id,name\n1,a\n")
+	d.Columns[0].Unique = true
+	if _, err := s.SetSchema("sales", d.Columns); err != nil {
+		t.Fatalf("Error setting the schema: %v\n", err)
+	}
+	replaced, err := s.Replace("sales", "new.csv", strings.NewReader("name;id\nb;2\nc;3\n"), Options{Delimiter: ';'}, Change{})
+	if err != nil {
+		t.Fatalf("Error replacing: %v\n", err)
+	}
+	rows, _ := s.Rows("sales", 0, 10)
+	if replaced.Rows != 2 || replaced.Source != "new.csv" || len(rows) != 2 || rows[1][0] != "3" || rows[1][1] != "c" {
+		t.Errorf("rows not replaced correctly: %+v, %v", replaced, rows)
+	}
+	var serr *SchemaError
+	for _, data := range []string{"id,name\n1,a\n1,b\n", "id,other\n4,x\n", "id\nx\n"} {
+		if _, err := s.Replace("sales", "bad.csv", strings.NewReader(data), Options{}, Change{}); !errors.As(err, &serr) {
+			t.Errorf("Expected schema error for %q, but was %v", data, err)
+		}
+	}
+	rows, _ = s.Rows("sales", 0, 10)
+	if len(rows) != 2 || rows[0][0] != "2" {
+		t.Errorf("the rows should not change on errors, but were %v", rows)
+	}
+	// the missing columns are left empty.
+	if _, err := s.Replace("sales", "ids.csv", strings.NewReader("id\n7\n"), Options{}, Change{}); err != nil {
+		t.Errorf("Error replacing: %v\n", err)
+	}
+	rows, _ = s.Rows("sales", 0, 10)
+	if len(rows) != 1 || rows[0][0] != "7" || rows[0][1] != "" {
+		t.Errorf("Expected the row 7 without name, but was %v", rows)
+	}
+}
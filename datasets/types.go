@@ -0,0 +1,189 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package datasets
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is the type of the values of a column.
+type Type string
+
+// The types of the columns, from the most specific to the most general.
+const (
+	Int    Type = "int"
+	Float  Type = "float"
+	Bool   Type = "bool"
+	Date   Type = "date"
+	String Type = "string"
+)
+
+// types is the order in which the types are tried when inferring them.
+var types = []Type{Int, Float, Bool, Date, String}
+
+// dateLayouts are the date formats recognized, the first is the one used to
+// write the dates.
+var dateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "true", "yes":
+		return true, nil
+	case "false", "no":
+		return false, nil
+	}
+	return false, errors.New("not a boolean: " + s)
+}
+
+func parseDate(s string) (time.Time, error) {
+	var err error
+	for _, layout := range dateLayouts {
+		var t time.Time
+		t, err = time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// Parse returns the value of s for the type t: an int64, a float64, a bool,
+// a time.Time or a string. Empty cells have no value, nil.
+func Parse(t Type, s string) (interface{}, error) {
+	if s == "" {
+		return nil, nil
+	}
+	switch t {
+	case Int:
+		return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	case Float:
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+	case Bool:
+		return parseBool(strings.TrimSpace(s))
+	case Date:
+		return parseDate(strings.TrimSpace(s))
+	default:
+		return s, nil
+	}
+}
+
+// leadingZero reports if s is a number written with zeros in front, like
+// the codes: reading it as a number would lose them.
+func leadingZero(s string) bool {
+	s = strings.TrimLeft(strings.TrimSpace(s), "+-")
+	return len(s) > 1 && s[0] == '0' && s[1] >= '0' && s[1] <= '9'
+}
+
+// number reports if s can be a number of the type t when inferring the
+// types. Only the decimal numbers can: the codes with leading zeros, the
+// integers too big for an int64 and the other numbers strconv reads, like
+// NaN, Inf or 0x1p-2, are more likely text.
+func number(t Type, s string) bool {
+	s = strings.TrimSpace(s)
+	if leadingZero(s) || strings.Trim(s, "0123456789+-.eE") != "" {
+		return false
+	}
+	if strings.Trim(strings.TrimLeft(s, "+-"), "0123456789") == "" {
+		// the integers are floats only if they are ints too.
+		t = Int
+	}
+	_, err := Parse(t, s)
+	return err == nil
+}
+
+// inference guesses the types of the columns from their values.
+type inference struct {
+	// possible are the indexes in types the values of every column can
+	// still have.
+	possible [][]bool
+	// seen tells the columns with at least a value.
+	seen []bool
+}
+
+func newInference(columns int) *inference {
+	in := &inference{possible: make([][]bool, columns), seen: make([]bool, columns)}
+	for i := range in.possible {
+		in.possible[i] = make([]bool, len(types))
+		for j := range types {
+			in.possible[i][j] = true
+		}
+	}
+	return in
+}
+
+// add takes into account the values of a row.
+func (in *inference) add(row []string) {
+	for i, v := range row {
+		if v == "" {
+			continue
+		}
+		in.seen[i] = true
+		// String is always possible.
+		for j, t := range types[:len(types)-1] {
+			if !in.possible[i][j] {
+				continue
+			}
+			if t == Int || t == Float {
+				in.possible[i][j] = number(t, v)
+			} else {
+				_, err := Parse(t, v)
+				in.possible[i][j] = err == nil
+			}
+		}
+	}
+}
+
+// types returns the most specific type possible for every column, the
+// columns without values are strings.
+func (in *inference) types() []Type {
+	ts := make([]Type, len(in.possible))
+	for i, possible := range in.possible {
+		ts[i] = String
+		for j, t := range types {
+			if !in.seen[i] {
+				break
+			}
+			if possible[j] {
+				ts[i] = t
+				break
+			}
+		}
+	}
+	return ts
+}
@@ -0,0 +1,439 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package datasets
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scompo/data-management/utils"
+)
+
+var versionsName = "versions"
+
+// Version is a saved version of the rows of a dataset.
+type Version struct {
+	Number  int
+	Author  string
+	Message string
+	Time    time.Time
+	Source  string
+	Rows    int
+	Columns []Column
+}
+
+// Change describes a change to the rows of a dataset.
+type Change struct {
+	Author  string
+	Message string
+}
+
+func (s *Store) versionPath(name string, n int, ext string) string {
+	return filepath.Join(s.path(name), versionsName, strconv.Itoa(n)+ext)
+}
+
+// snapshot saves the current rows of d as a new version, made by c at t.
+// The details of d are not written, the version is found once they are.
+func (s *Store) snapshot(d *Dataset, c Change, t time.Time) error {
+	err := os.MkdirAll(filepath.Join(s.path(d.Name), versionsName), 0775)
+	if err != nil {
+		return err
+	}
+	n := d.Version + 1
+	data := s.versionPath(d.Name, n, ".csv")
+	// a version left by a change that failed.
+	os.Remove(data)
+	// the data is replaced by a rename, a link to it never changes.
+	err = os.Link(filepath.Join(s.path(d.Name), dataName), data)
+	if err != nil {
+		err = copyFile(filepath.Join(s.path(d.Name), dataName), data)
+	}
+	if err != nil {
+		return err
+	}
+	meta, err := json.Marshal(Version{
+		Number:  n,
+		Author:  c.Author,
+		Message: c.Message,
+		Time:    t,
+		Source:  d.Source,
+		Rows:    d.Rows,
+		Columns: d.Columns,
+	})
+	if err != nil {
+		return err
+	}
+	err = utils.WriteFileAtomic(s.versionPath(d.Name, n, ".json"), meta)
+	if err != nil {
+		return err
+	}
+	d.Version = n
+	return nil
+}
+
+func copyFile(from, to string) error {
+	f, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = utils.WriteAtomic(to, f)
+	return err
+}
+
+// legacy saves the rows of d as its first version, if it was imported
+// before the versions.
+func (s *Store) legacy(d *Dataset) error {
+	if d.Version > 0 {
+		return nil
+	}
+	return s.snapshot(d, Change{Message: "Imported " + d.Source}, d.Updated)
+}
+
+// Version returns the version n of a dataset.
+func (s *Store) Version(name string, n int) (Version, error) {
+	d, err := s.Get(name)
+	if err != nil {
+		return Version{}, err
+	}
+	if n < 1 || n > d.Version {
+		return Version{}, fmt.Errorf("%w: %v version %v", ErrNotFound, d.Name, n)
+	}
+	data, err := ioutil.ReadFile(s.versionPath(d.Name, n, ".json"))
+	if err != nil {
+		return Version{}, err
+	}
+	var v Version
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
+// Versions returns all the versions of a dataset, the newest first.
+func (s *Store) Versions(name string) ([]Version, error) {
+	d, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(filepath.Join(s.path(d.Name), versionsName))
+	if os.IsNotExist(err) {
+		return []Version{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	vs := make([]Version, 0, len(infos))
+	for _, info := range infos {
+		n, err := strconv.Atoi(strings.TrimSuffix(info.Name(), ".json"))
+		if err != nil || n > d.Version {
+			// not a version, or one being written.
+			continue
+		}
+		v, err := s.Version(d.Name, n)
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	sort.Slice(vs, func(i, j int) bool {
+		return vs[i].Number > vs[j].Number
+	})
+	return vs, nil
+}
+
+// OpenVersion returns a Reader for the rows of the version n of the dataset
+// name. Its Dataset has the columns of the version.
+func (s *Store) OpenVersion(name string, n int) (*Reader, error) {
+	v, err := s.Version(name, n)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	d.Columns, d.Rows, d.Source = v.Columns, v.Rows, v.Source
+	return s.open(d, s.versionPath(d.Name, n, ".csv"))
+}
+
+// Revert makes the rows of the version n of a dataset the current ones,
+// adding a new version: the history is never rewritten. The rows have to
+// follow the current schema.
+// If c has no message one saying what was reverted is used.
+func (s *Store) Revert(name string, n int, c Change) (Dataset, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer unlock()
+	v, err := s.Version(name, n)
+	if err != nil {
+		return Dataset{}, err
+	}
+	d, err := s.Get(name)
+	if err != nil {
+		return Dataset{}, err
+	}
+	r, err := s.OpenVersion(d.Name, n)
+	if err != nil {
+		return Dataset{}, err
+	}
+	err = s.Check(d.Name, d.Columns, r.Read)
+	r.Close()
+	if err != nil {
+		return Dataset{}, err
+	}
+	err = copyFile(s.versionPath(d.Name, n, ".csv"), filepath.Join(s.path(d.Name), dataName))
+	if err != nil {
+		return Dataset{}, err
+	}
+	if c.Message == "" {
+		c.Message = "Reverted to version " + strconv.Itoa(n)
+	}
+	d.Rows, d.Source = v.Rows, v.Source
+	d.Updated = currentTime()
+	err = s.snapshot(&d, c, d.Updated)
+	if err != nil {
+		return Dataset{}, err
+	}
+	return d, s.writeMeta(d)
+}
+
+// RowChange is a row added, removed or changed between two versions.
+// Old and New are its values in the columns of the Diff, nil when the row
+// is not there; Changed tells the cells that changed.
+type RowChange struct {
+	Key     string
+	Kind    string
+	Old     []string
+	New     []string
+	Changed []bool
+}
+
+// The kinds of RowChange.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Diff are the differences between the versions From and To of a dataset.
+// The rows are matched by the values of the column Key, or by their
+// position when it's empty. Changes has the first changes found, Added,
+// Removed and Changed count all of them.
+type Diff struct {
+	From    Version
+	To      Version
+	Columns []string
+	Key     string
+	Changes []RowChange
+	Added   int
+	Removed int
+	Changed int
+}
+
+// versionRows returns the reader of the version n of the dataset name, no
+// rows at all for the version 0.
+func (s *Store) versionRows(name string, n int) (Version, func() ([]string, error), func() error, error) {
+	if n == 0 {
+		return Version{}, func() ([]string, error) { return nil, io.EOF }, func() error { return nil }, nil
+	}
+	v, err := s.Version(name, n)
+	if err != nil {
+		return v, nil, nil, err
+	}
+	r, err := s.OpenVersion(name, n)
+	if err != nil {
+		return v, nil, nil, err
+	}
+	return v, r.Read, r.Close, nil
+}
+
+// rowKeys returns the keys of the rows of a version by the column at
+// position col, or by their position if col is negative. The rows with the
+// same value are told apart by their occurrence.
+type rowKeys struct {
+	col  int
+	seen map[string]int
+	row  int
+}
+
+func (k *rowKeys) key(record []string) string {
+	k.row++
+	if k.col < 0 {
+		return strconv.Itoa(k.row)
+	}
+	key := record[k.col]
+	k.seen[key]++
+	if n := k.seen[key]; n > 1 {
+		key += " (" + strconv.Itoa(n) + ")"
+	}
+	return key
+}
+
+func columnIndex(columns []Column, name string) int {
+	for i, c := range columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Diff compares the rows of the versions from and to of the dataset name,
+// matching them by the column key. The version 0 has no rows. Without a
+// key the first unique column is used, if any. At most limit changes are
+// kept.
+func (s *Store) Diff(name string, from, to int, key string, limit int) (Diff, error) {
+	oldV, readOld, closeOld, err := s.versionRows(name, from)
+	if err != nil {
+		return Diff{}, err
+	}
+	defer closeOld()
+	newV, readNew, closeNew, err := s.versionRows(name, to)
+	if err != nil {
+		return Diff{}, err
+	}
+	defer closeNew()
+	if key == "" {
+		for _, c := range newV.Columns {
+			if c.Unique {
+				key = c.Name
+				break
+			}
+		}
+	}
+	oldKeys := &rowKeys{col: -1, seen: make(map[string]int)}
+	newKeys := &rowKeys{col: -1, seen: make(map[string]int)}
+	if key != "" {
+		oldKeys.col = columnIndex(oldV.Columns, key)
+		newKeys.col = columnIndex(newV.Columns, key)
+		if newKeys.col < 0 || (from != 0 && oldKeys.col < 0) {
+			return Diff{}, &ValidationError{Field: "Key", Value: key, Reason: "not a column of both versions"}
+		}
+	}
+	// the columns of the new version, then the ones removed.
+	d := Diff{From: oldV, To: newV, Key: key, Changes: make([]RowChange, 0)}
+	d.Columns = columnNames(newV.Columns)
+	for _, c := range oldV.Columns {
+		if columnIndex(newV.Columns, c.Name) < 0 {
+			d.Columns = append(d.Columns, c.Name)
+		}
+	}
+	values := func(columns []Column, record []string) []string {
+		vs := make([]string, len(d.Columns))
+		for i, name := range d.Columns {
+			if j := columnIndex(columns, name); j >= 0 && j < len(record) {
+				vs[i] = record[j]
+			}
+		}
+		return vs
+	}
+	add := func(c RowChange) {
+		if len(d.Changes) < limit {
+			d.Changes = append(d.Changes, c)
+		}
+	}
+
+	old := make(map[string][]string)
+	var order []string
+	for {
+		record, err := readOld()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Diff{}, err
+		}
+		k := oldKeys.key(record)
+		old[k] = values(oldV.Columns, record)
+		order = append(order, k)
+	}
+	for {
+		record, err := readNew()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Diff{}, err
+		}
+		k := newKeys.key(record)
+		newValues := values(newV.Columns, record)
+		oldValues, ok := old[k]
+		if !ok {
+			d.Added++
+			add(RowChange{Key: k, Kind: Added, New: newValues})
+			continue
+		}
+		delete(old, k)
+		changed := make([]bool, len(d.Columns))
+		differ := false
+		for i := range changed {
+			changed[i] = oldValues[i] != newValues[i]
+			differ = differ || changed[i]
+		}
+		if differ {
+			d.Changed++
+			add(RowChange{Key: k, Kind: Changed, Old: oldValues, New: newValues, Changed: changed})
+		}
+	}
+	for _, k := range order {
+		if oldValues, ok := old[k]; ok {
+			d.Removed++
+			add(RowChange{Key: k, Kind: Removed, Old: oldValues})
+		}
+	}
+	return d, nil
+}
+
+// open returns a Reader for the rows of d in the CSV file at path.
+func (s *Store) open(d Dataset, path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(bufio.NewReader(f))
+	_, err = r.Read()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Reader{Dataset: d, f: f, r: r}, nil
+}
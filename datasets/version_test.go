@@ -0,0 +1,138 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package datasets
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVersions(t *testing.T) {
+	s := setup(t)
+
+	d := importTest(t, s, "sales", "id,name\n1,a\n2,b\n")
+	if d.Version != 1 {
+		t.Errorf("Expected version 1 after the import, but was %v", d.Version)
+	}
+	later := testTime.Add(time.Hour)
+	currentTime = func() time.Time {
+		return later
+	}
+	d, err := s.Replace("sales", "new.csv", strings.NewReader("id,name\n2,c\n3,d\n"), Options{}, Change{Author: "mauro"})
+	if err != nil || d.Version != 2 {
+		t.Fatalf("Error replacing: %+v, %v\n", d, err)
+	}
+	vs, err := s.Versions("sales")
+	if err != nil || len(vs) != 2 {
+		t.Fatalf("Expected 2 versions, but were %+v, %v", vs, err)
+	}
+	if vs[0].Number != 2 || vs[0].Author != "mauro" || vs[0].Message != "Uploaded new.csv" || !later.Equal(vs[0].Time) ||
+		vs[1].Number != 1 || vs[1].Message != "Imported sales.csv" || vs[1].Rows != 2 {
+		t.Errorf("wrong versions: %+v", vs)
+	}
+	r, err := s.OpenVersion("sales", 1)
+	if err != nil {
+		t.Fatalf("Error opening the version: %v\n", err)
+	}
+	row, _ := r.Read()
+	r.Close()
+	if row[1] != "a" {
+		t.Errorf("the old version changed: %v", row)
+	}
+
+	d, err = s.Revert("sales", 1, Change{})
+	if err != nil || d.Version != 3 || d.Rows != 2 || d.Source != "sales.csv" {
+		t.Fatalf("Error reverting: %+v, %v\n", d, err)
+	}
+	rows, _ := s.Rows("sales", 0, 10)
+	if len(rows) != 2 || rows[0][1] != "a" {
+		t.Errorf("rows not reverted: %v", rows)
+	}
+	v, _ := s.Version("sales", 3)
+	if v.Message != "Reverted to version 1" {
+		t.Errorf("wrong message: %v", v.Message)
+	}
+	if _, err := s.Version("sales", 4); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for version not existent: %v\n", err)
+	}
+	// the names of the version 2 are not allowed by the new schema.
+	d.Columns[1].Enum = []string{"a", "b"}
+	if _, err := s.SetSchema("sales", d.Columns); err != nil {
+		t.Fatalf("Error setting the schema: %v\n", err)
+	}
+	var serr *SchemaError
+	if _, err := s.Revert("sales", 2, Change{}); !errors.As(err, &serr) {
+		t.Errorf("Expected schema error reverting, but was %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	s := setup(t)
+
+	importTest(t, s, "sales", "id,name,amount\n1,a,10\n2,b,20\n3,c,30\n")
+	if _, err := s.Replace("sales", "new.csv", strings.NewReader("id,name,amount\n3,c,30\n2,b,25\n4,d,40\n"), Options{}, Change{}); err != nil {
+		t.Fatalf("Error replacing: %v\n", err)
+	}
+	d, err := s.Diff("sales", 1, 2, "id", 10)
+	if err != nil {
+		t.Fatalf("Error comparing: %v\n", err)
+	}
+	if d.Added != 1 || d.Removed != 1 || d.Changed != 1 || len(d.Changes) != 3 {
+		t.Fatalf("wrong diff: %+v", d)
+	}
+	changed, added, removed := d.Changes[0], d.Changes[1], d.Changes[2]
+	if changed.Kind != Changed || changed.Key != "2" || !changed.Changed[2] || changed.Changed[1] ||
+		changed.Old[2] != "20" || changed.New[2] != "25" {
+		t.Errorf("wrong change: %+v", changed)
+	}
+	if added.Kind != Added || added.Key != "4" || added.Old != nil || removed.Kind != Removed || removed.Key != "1" {
+		t.Errorf("wrong added and removed rows: %+v %+v", added, removed)
+	}
+
+	// by position every row changed but the third.
+	d, err = s.Diff("sales", 1, 2, "", 1)
+	if err != nil || d.Changed != 3 || d.Added != 0 || len(d.Changes) != 1 {
+		t.Errorf("wrong diff by position: %+v, %v", d, err)
+	}
+	d, err = s.Diff("sales", 0, 1, "id", 10)
+	if err != nil || d.Added != 3 || d.Removed != 0 {
+		t.Errorf("wrong diff with nothing: %+v, %v", d, err)
+	}
+	var verr *ValidationError
+	if _, err := s.Diff("sales", 1, 2, "missing", 10); !errors.As(err, &verr) {
+		t.Errorf("Expected validation error for the key: %v\n", err)
+	}
+	if _, err := s.Diff("sales", 1, 5, "id", 10); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for version not existent: %v\n", err)
+	}
+}
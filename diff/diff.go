@@ -0,0 +1,257 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+// Package diff computes the differences between texts, line by line, and
+// arranges them for the unified and the side by side views.
+package diff
+
+import "strings"
+
+// Op is what happened to a line.
+type Op int
+
+// The operations on the lines.
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+func (o Op) String() string {
+	switch o {
+	case Delete:
+		return "delete"
+	case Insert:
+		return "insert"
+	default:
+		return "equal"
+	}
+}
+
+// Line is a line of a diff.
+// Old and New are the 1-based line numbers in the old and the new text,
+// 0 when the line is not there.
+type Line struct {
+	Op   Op
+	Text string
+	Old  int
+	New  int
+}
+
+// split returns the lines of s, without the line terminators.
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// Texts returns the diff between the lines of a and b.
+func Texts(a, b string) []Line {
+	return Lines(split(a), split(b))
+}
+
+// Lines returns the shortest diff between a and b, computed with the Myers
+// algorithm. It takes O((N+M)D) time and O(D²) memory, D being the number
+// of changed lines.
+func Lines(a, b []string) []Line {
+	n, m := len(a), len(b)
+	max := n + m
+	off := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds the furthest x on the diagonals -d-1..d+1 before
+	// round d.
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[off-d-1:off+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(a, b []string, trace [][]int) []Line {
+	var res []Line
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int {
+			return v[k+d+1]
+		}
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			res = append(res, Line{Op: Equal, Text: a[x-1], Old: x, New: y})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				res = append(res, Line{Op: Insert, Text: b[prevY], New: prevY + 1})
+			} else {
+				res = append(res, Line{Op: Delete, Text: a[prevX], Old: prevX + 1})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+// Changed reports if there is any difference in lines.
+func Changed(lines []Line) bool {
+	for _, l := range lines {
+		if l.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// Hunk is a group of changed lines with some unchanged ones around them.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []Line
+}
+
+// Unified groups lines in hunks, keeping context unchanged lines around
+// the changed ones, like diff -u does.
+func Unified(lines []Line, context int) []Hunk {
+	var hunks []Hunk
+	start, end := -1, -1
+	flush := func() {
+		if start < 0 {
+			return
+		}
+		h := Hunk{Lines: lines[start:end]}
+		for _, l := range h.Lines {
+			if l.Op != Insert {
+				if h.OldStart == 0 {
+					h.OldStart = l.Old
+				}
+				h.OldLines++
+			}
+			if l.Op != Delete {
+				if h.NewStart == 0 {
+					h.NewStart = l.New
+				}
+				h.NewLines++
+			}
+		}
+		hunks = append(hunks, h)
+		start, end = -1, -1
+	}
+	for i, l := range lines {
+		if l.Op == Equal {
+			continue
+		}
+		from, to := i-context, i+context+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(lines) {
+			to = len(lines)
+		}
+		if start >= 0 && from > end {
+			flush()
+		}
+		if start < 0 {
+			start = from
+		}
+		end = to
+	}
+	flush()
+	return hunks
+}
+
+// Row is a row of the side by side view, Old or New are nil when the line
+// is only on the other side.
+type Row struct {
+	Old *Line
+	New *Line
+}
+
+// SideBySide arranges lines in rows, the deleted lines next to the
+// inserted ones that replace them.
+func SideBySide(lines []Line) []Row {
+	var rows []Row
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			rows = append(rows, Row{Old: &lines[i], New: &lines[i]})
+			i++
+			continue
+		}
+		var dels, ins []*Line
+		for ; i < len(lines) && lines[i].Op != Equal; i++ {
+			if lines[i].Op == Delete {
+				dels = append(dels, &lines[i])
+			} else {
+				ins = append(ins, &lines[i])
+			}
+		}
+		for j := 0; j < len(dels) || j < len(ins); j++ {
+			var row Row
+			if j < len(dels) {
+				row.Old = dels[j]
+			}
+			if j < len(ins) {
+				row.New = ins[j]
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
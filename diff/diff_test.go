@@ -0,0 +1,144 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+// apply rebuilds the old and the new text from lines.
+func apply(lines []Line) (string, string) {
+	var a, b []string
+	for _, l := range lines {
+		if l.Op != Insert {
+			a = append(a, l.Text)
+		}
+		if l.Op != Delete {
+			b = append(b, l.Text)
+		}
+	}
+	return strings.Join(a, "\n"), strings.Join(b, "\n")
+}
+
+func TestTexts(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		changes int
+	}{
+		{"", "", 0},
+		{"a\nb\nc", "a\nb\nc\n", 0},
+		{"", "a\nb", 2},
+		{"a\nb", "", 2},
+		{"a\nb\nc", "a\nc", 1},
+		{"a\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc", 5},
+		{"one\ntwo\nthree", "one\n2\nthree", 2},
+	}
+	for _, test := range tests {
+		lines := Texts(test.a, test.b)
+		changes := 0
+		for _, l := range lines {
+			if l.Op != Equal {
+				changes++
+			}
+		}
+		if changes != test.changes {
+			t.Errorf("%q -> %q: expected %v changes, but were %v: %v", test.a, test.b, test.changes, changes, lines)
+		}
+		a, b := apply(lines)
+		if a != strings.TrimSuffix(test.a, "\n") || b != strings.TrimSuffix(test.b, "\n") {
+			t.Errorf("%q -> %q: diff does not rebuild the texts: %q, %q", test.a, test.b, a, b)
+		}
+		if Changed(lines) != (changes > 0) {
+			t.Errorf("%q -> %q: Changed is wrong", test.a, test.b)
+		}
+	}
+}
+
+func TestLineNumbers(t *testing.T) {
+	lines := Texts("a\nb\nc", "a\nx\nc")
+	expected := []Line{
+		{Equal, "a", 1, 1},
+		{Delete, "b", 2, 0},
+		{Insert, "x", 0, 2},
+		{Equal, "c", 3, 3},
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %v, but was %v", expected, lines)
+	}
+	for i := range lines {
+		if lines[i] != expected[i] {
+			t.Errorf("Expected %v, but was %v", expected[i], lines[i])
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 20; i++ {
+		a = append(a, string(rune('a'+i)))
+	}
+	b = append(b, a...)
+	b[2] = "X"
+	b[15] = "Y"
+	hunks := Unified(Lines(a, b), 3)
+	if len(hunks) != 2 {
+		t.Fatalf("Expected 2 hunks, but were %v", len(hunks))
+	}
+	h := hunks[0]
+	if h.OldStart != 1 || h.OldLines != 6 || h.NewStart != 1 || h.NewLines != 6 || len(h.Lines) != 7 {
+		t.Errorf("wrong first hunk: %+v", h)
+	}
+	h = hunks[1]
+	if h.OldStart != 13 || h.OldLines != 7 || h.NewStart != 13 || h.NewLines != 7 {
+		t.Errorf("wrong second hunk: %+v", h)
+	}
+	if hunks := Unified(Lines(a, b), 10); len(hunks) != 1 {
+		t.Errorf("close changes should be in the same hunk, but were %v hunks", len(hunks))
+	}
+	if hunks := Unified(Lines(a, a), 3); len(hunks) != 0 {
+		t.Errorf("no changes should give no hunks, but were %v", len(hunks))
+	}
+}
+
+func TestSideBySide(t *testing.T) {
+	rows := SideBySide(Texts("a\nb\nc\nd", "a\nx\ny\nd"))
+	if len(rows) != 4 {
+		t.Fatalf("Expected 4 rows, but were %v", len(rows))
+	}
+	if rows[1].Old.Text != "b" || rows[1].New.Text != "x" {
+		t.Errorf("changed lines should be side by side: %v %v", rows[1].Old, rows[1].New)
+	}
+	rows = SideBySide(Texts("a", "a\nb"))
+	if len(rows) != 2 || rows[1].Old != nil || rows[1].New.Text != "b" {
+		t.Errorf("inserted line should be alone: %v", rows)
+	}
+}
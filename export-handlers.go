@@ -0,0 +1,208 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"errors"
+	"github.com/scompo/data-management/export"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/utils"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// exportLink is a link to download rows in a format.
+type exportLink struct {
+	Title string
+	URL   string
+}
+
+// exportLinks returns the links to the export at path with params in every
+// format.
+func exportLinks(path string, params url.Values) []exportLink {
+	links := make([]exportLink, len(export.Formats))
+	for i, f := range export.Formats {
+		values := url.Values{"format": {f.Name}}
+		for k, v := range params {
+			values[k] = v
+		}
+		links[i] = exportLink{Title: f.Title, URL: path + "?" + values.Encode()}
+	}
+	return links
+}
+
+// exportFormat returns the format named in the format parameter of r, CSV
+// by default.
+func exportFormat(r *http.Request) (export.Format, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	f, err := export.Find(format)
+	if err != nil {
+		return f, utils.BadRequest(errors.New("unknown export format " + format))
+	}
+	return f, nil
+}
+
+// writeExport answers with the rows returned by next until io.EOF, with
+// the columns, in the format f. The file is called name.
+// The first row is read before answering, to report the errors happening
+// at once. A later error ends the rows with it in the formats with room
+// for one, the others are left incomplete.
+func writeExport(w http.ResponseWriter, f export.Format, name string, columns []string, next func() ([]interface{}, error)) error {
+	row, err := next()
+	if err == io.EOF {
+		row, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", f.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + f.Extension}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	out := f.NewWriter(w, name)
+	werr := out.Header(columns)
+	for row != nil && werr == nil {
+		werr = out.Row(row)
+		if werr != nil {
+			break
+		}
+		row, err = next()
+		if err == io.EOF {
+			row, err = nil, nil
+		}
+		if err != nil {
+			break
+		}
+	}
+	e, ok := out.(export.ErrorWriter)
+	switch {
+	case werr != nil:
+		// the client has gone, nobody reads the rest.
+	case err != nil && ok:
+		// the rows have started, the error ends them as in the api.
+		status, message := utils.StatusOf(httpError(err))
+		werr = e.Fail(utils.ErrorBody{Status: status, Error: message})
+	case err != nil:
+		werr = err
+	default:
+		werr = out.Close()
+	}
+	if werr != nil {
+		// too late to change the answer, the download is left incomplete.
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
+
+// exportQuery answers with the results of the query src over a dataset of
+// prj, in the format named in the format parameter. The file is called
+// name. The rows are written as they are computed.
+func (a *app) exportQuery(w http.ResponseWriter, r *http.Request, prj projects.Project, src, name string) error {
+	f, err := exportFormat(r)
+	if err != nil {
+		return err
+	}
+	rows, closeData, err := a.runQuery(prj, src)
+	if err != nil {
+		return err
+	}
+	defer closeData()
+	return writeExport(w, f, name, rows.Columns, rows.Next)
+}
+
+// exportDataset answers with the rows of the dataset name of prj as they
+// are saved, in the format named in the format parameter.
+func (a *app) exportDataset(w http.ResponseWriter, r *http.Request, prj projects.Project, name string) error {
+	f, err := exportFormat(r)
+	if err != nil {
+		return err
+	}
+	data, err := a.datasets(prj).Open(name)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+	columns := make([]string, len(data.Dataset.Columns))
+	for i, c := range data.Dataset.Columns {
+		columns[i] = c.Name
+	}
+	return writeExport(w, f, data.Dataset.Name, columns, func() ([]interface{}, error) {
+		record, err := data.Read()
+		if err != nil {
+			return nil, err
+		}
+		row := make([]interface{}, len(record))
+		for i, v := range record {
+			row[i] = v
+		}
+		return row, nil
+	})
+}
+
+// exportDatasetHandler downloads the rows of a dataset as they are saved,
+// or the ones selected by the saved query in the query parameter.
+func (a *app) exportDatasetHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, d, err := a.pathDataset(r, projects.Viewer)
+	if err != nil {
+		return err
+	}
+	name := r.URL.Query().Get("query")
+	if name == "" {
+		return a.exportDataset(w, r, prj, d.Name)
+	}
+	q, err := a.queries(prj).Get(name)
+	if err != nil {
+		return err
+	}
+	if from, _ := utils.NormalizeName(q.Dataset()); from != d.Name {
+		return utils.BadRequest(errors.New("the query " + q.Name + " does not read the dataset " + d.Name))
+	}
+	return a.exportQuery(w, r, prj, q.Text, d.Name+" - "+q.Name)
+}
+
+// exportQueryHandler downloads the results of the query in the q parameter.
+func (a *app) exportQueryHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, err := a.pathProject(r, projects.Viewer)
+	if err != nil {
+		return err
+	}
+	return a.exportQuery(w, r, prj, r.URL.Query().Get("q"), "query")
+}
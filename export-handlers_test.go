@@ -0,0 +1,106 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/scompo/data-management/datasets"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/utils"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExportDataset(t *testing.T) {
+	a := newApp(projects.NewMemoryStore(), t.TempDir())
+	h := loggedIn(t, a, "mauro")
+	if err := a.projects.Save(ownedProject(withUser(httptest.NewRequest("GET", "/", nil), "mauro"), projects.Project{Name: "x"})); err != nil {
+		t.Fatalf("Error saving: %v\n", err)
+	}
+	prj, _ := a.projects.Get("x")
+	csv := "code,day,price\r\n01234,2021-03-04T00:00:00Z,1.50\r\n"
+	if _, err := a.datasets(prj).Import("sales", "sales.csv", strings.NewReader(csv), datasets.Options{}); err != nil {
+		t.Fatalf("Error importing: %v\n", err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", datasetURL(prj, "sales")+"/export?format=csv", nil))
+	if w.Code != http.StatusOK || strings.ReplaceAll(w.Body.String(), "\r\n", "\n") != strings.ReplaceAll(csv, "\r\n", "\n") {
+		t.Errorf("the rows should be exported as saved, got %v \"%v\"", w.Code, w.Body)
+	}
+}
+
+func TestExportFailingRow(t *testing.T) {
+	a := newApp(projects.NewMemoryStore(), t.TempDir())
+	h := loggedIn(t, a, "mauro")
+	if err := a.projects.Save(ownedProject(withUser(httptest.NewRequest("GET", "/", nil), "mauro"), projects.Project{Name: "x"})); err != nil {
+		t.Fatalf("Error saving: %v\n", err)
+	}
+	prj, _ := a.projects.Get("x")
+	if _, err := a.datasets(prj).Import("nums", "", strings.NewReader("a,b\n1,1\n1,0\n"), datasets.Options{}); err != nil {
+		t.Fatalf("Error importing: %v\n", err)
+	}
+	path := "/projects/" + prj.ID + "/query/export?" + url.Values{"q": {"SELECT a / b FROM nums"}}.Encode()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path+"&format=jsonl", nil))
+	var lines []map[string]json.RawMessage
+	for s := bufio.NewScanner(w.Body); s.Scan(); {
+		var line map[string]json.RawMessage
+		if err := json.Unmarshal(s.Bytes(), &line); err != nil {
+			t.Fatalf("Error reading the line %q: %v\n", s.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	var body utils.ErrorBody
+	if w.Code != http.StatusOK || len(lines) != 2 {
+		t.Fatalf("Expected a row and the error, got %v %v", w.Code, lines)
+	}
+	if err := json.Unmarshal(lines[1]["error"], &body); err != nil || body.Status != http.StatusBadRequest {
+		t.Errorf("the failing row should end the rows with an error: %v, %v", body, err)
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	// the answer is aborted before its end, the headers may be gone or not.
+	res, err := http.Get(srv.URL + path + "&format=csv")
+	if err == nil {
+		defer res.Body.Close()
+		_, err = ioutil.ReadAll(res.Body)
+	}
+	if err == nil {
+		t.Errorf("Expected the download to be left incomplete")
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+// Package export writes the rows of a dataset, or of the results of a
+// query, in the formats other programs read. The rows are written as they
+// come, nothing is kept in memory.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	"github.com/scompo/data-management/query"
+)
+
+// Format is a format rows can be exported in.
+type Format struct {
+	// Name is the one used to choose it.
+	Name        string
+	Extension   string
+	ContentType string
+	// Title is the name shown to the users.
+	Title string
+	// writer returns the Writer writing in the format to w a sheet named
+	// sheet.
+	writer func(w io.Writer, sheet string) Writer
+}
+
+// Formats are the available formats.
+var Formats = []Format{
+	{"csv", ".csv", "text/csv; charset=utf-8", "CSV", func(w io.Writer, sheet string) Writer {
+		return newCSVWriter(w, ',')
+	}},
+	{"tsv", ".tsv", "text/tab-separated-values; charset=utf-8", "TSV", func(w io.Writer, sheet string) Writer {
+		return newCSVWriter(w, '\t')
+	}},
+	{"json", ".json", "application/json; charset=utf-8", "JSON", func(w io.Writer, sheet string) Writer {
+		return &jsonWriter{w: bufio.NewWriter(w), lines: false}
+	}},
+	{"jsonl", ".jsonl", "application/jsonl; charset=utf-8", "JSON Lines", func(w io.Writer, sheet string) Writer {
+		return &jsonWriter{w: bufio.NewWriter(w), lines: true}
+	}},
+	{"xlsx", ".xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "Excel", newXLSXWriter},
+}
+
+// ErrFormat is returned for formats that are not available.
+var ErrFormat = errors.New("unknown export format")
+
+// Find returns the format called name.
+func Find(name string) (Format, error) {
+	for _, f := range Formats {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return Format{}, ErrFormat
+}
+
+// Writer writes rows in a format: first the names of the columns, then the
+// rows with the values returned by a query, and at last Close finishes
+// the output, without closing the underlying writer.
+type Writer interface {
+	Header(columns []string) error
+	Row(values []interface{}) error
+	Close() error
+}
+
+// ErrorWriter is a Writer of a format with room for an error, it can end
+// the rows with one when they fail after the output has started.
+type ErrorWriter interface {
+	Writer
+	// Fail finishes the output, as Close, after writing body as the error.
+	Fail(body interface{}) error
+}
+
+// NewWriter returns a Writer for the format f writing to w. sheet names
+// the rows, for the formats that need it.
+func (f Format) NewWriter(w io.Writer, sheet string) Writer {
+	return f.writer(w, sheet)
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, comma rune) *csvWriter {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	return &csvWriter{w: cw}
+}
+
+func (c *csvWriter) Header(columns []string) error {
+	return c.w.Write(columns)
+}
+
+func (c *csvWriter) Row(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = query.Format(v)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonWriter writes every row as an object, inside an array or on its own
+// line.
+type jsonWriter struct {
+	w       *bufio.Writer
+	lines   bool
+	columns [][]byte
+	rows    int
+}
+
+func (j *jsonWriter) Header(columns []string) error {
+	j.columns = make([][]byte, len(columns))
+	for i, c := range columns {
+		name, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		j.columns[i] = name
+	}
+	if !j.lines {
+		_, err := j.w.WriteString("[")
+		return err
+	}
+	return nil
+}
+
+// jsonValue returns the json value of a result, dates are text and numbers
+// json can't hold are null.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Time:
+		return query.Format(v)
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil
+		}
+	}
+	return v
+}
+
+func (j *jsonWriter) Row(values []interface{}) error {
+	switch {
+	case j.lines && j.rows > 0:
+		j.w.WriteString("\n")
+	case !j.lines && j.rows > 0:
+		j.w.WriteString(",\n")
+	case !j.lines:
+		j.w.WriteString("\n")
+	}
+	j.rows++
+	// the keys are written one by one to keep the order of the columns.
+	j.w.WriteString("{")
+	for i, v := range values {
+		if i > 0 {
+			j.w.WriteString(",")
+		}
+		j.w.Write(j.columns[i])
+		j.w.WriteString(":")
+		data, err := json.Marshal(jsonValue(v))
+		if err != nil {
+			return err
+		}
+		j.w.Write(data)
+	}
+	_, err := j.w.WriteString("}")
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	switch {
+	case !j.lines && j.rows > 0:
+		j.w.WriteString("\n]\n")
+	case !j.lines:
+		j.w.WriteString("]\n")
+	case j.rows > 0:
+		j.w.WriteString("\n")
+	}
+	return j.w.Flush()
+}
+
+// Fail ends the rows with an object holding body in the error field, as
+// the last one of the array or on the last line.
+func (j *jsonWriter) Fail(body interface{}) error {
+	data, err := json.Marshal(map[string]interface{}{"error": body})
+	if err != nil {
+		return err
+	}
+	switch {
+	case j.lines && j.rows > 0:
+		j.w.WriteString("\n")
+	case !j.lines && j.rows > 0:
+		j.w.WriteString(",\n")
+	case !j.lines:
+		j.w.WriteString("\n")
+	}
+	j.rows++
+	j.w.Write(data)
+	return j.Close()
+}
@@ -0,0 +1,187 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testColumns = []string{"id", "name", "price", "day", "ok"}
+
+var testRows = [][]interface{}{
+	{int64(1), "a, \"b\"", 1.5, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), true},
+	{int64(2), "<c>", nil, time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC), nil},
+}
+
+func write(t *testing.T, format string, rows [][]interface{}) []byte {
+	f, err := Find(format)
+	if err != nil {
+		t.Fatalf("Error finding %v: %v\n", format, err)
+	}
+	var b bytes.Buffer
+	w := f.NewWriter(&b, "sales")
+	if err := w.Header(testColumns); err != nil {
+		t.Fatalf("Error writing the header: %v\n", err)
+	}
+	for _, row := range rows {
+		if err := w.Row(row); err != nil {
+			t.Fatalf("Error writing a row: %v\n", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Error closing: %v\n", err)
+	}
+	return b.Bytes()
+}
+
+func TestText(t *testing.T) {
+	expected := map[string]string{
+		"csv": "id,name,price,day,ok\n1,\"a, \"\"b\"\"\",1.5,2020-01-02,true\n2,<c>,,2020-01-02T12:00:00Z,\n",
+		"tsv": "id\tname\tprice\tday\tok\n1\t\"a, \"\"b\"\"\"\t1.5\t2020-01-02\ttrue\n2\t<c>\t\t2020-01-02T12:00:00Z\t\n",
+		"jsonl": `{"id":1,"name":"a, \"b\"","price":1.5,"day":"2020-01-02","ok":true}` + "\n" +
+			`{"id":2,"name":"\u003cc\u003e","price":null,"day":"2020-01-02T12:00:00Z","ok":null}` + "\n",
+	}
+	for format, text := range expected {
+		if out := string(write(t, format, testRows)); out != text {
+			t.Errorf("Expected %v:\n%v\nbut was:\n%v", format, text, out)
+		}
+	}
+	if _, err := Find("pdf"); err != ErrFormat {
+		t.Errorf("Expected error for unknown format: %v\n", err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	for _, rows := range [][][]interface{}{testRows, nil} {
+		var objects []map[string]interface{}
+		if err := json.Unmarshal(write(t, "json", rows), &objects); err != nil {
+			t.Fatalf("Error decoding: %v\n", err)
+		}
+		if len(objects) != len(rows) {
+			t.Fatalf("Expected %v objects, but were %v", len(rows), len(objects))
+		}
+		if len(rows) > 0 && (objects[0]["id"] != 1.0 || objects[1]["name"] != "<c>") {
+			t.Errorf("wrong objects: %v", objects)
+		}
+	}
+}
+
+func TestFail(t *testing.T) {
+	f, _ := Find("json")
+	var b bytes.Buffer
+	w := f.NewWriter(&b, "sales").(ErrorWriter)
+	w.Header(testColumns)
+	w.Row(testRows[0])
+	if err := w.Fail("broken"); err != nil {
+		t.Fatalf("Error failing: %v\n", err)
+	}
+	var objects []map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &objects); err != nil {
+		t.Fatalf("Error decoding %v: %v\n", b.String(), err)
+	}
+	if len(objects) != 2 || objects[1]["error"] != "broken" {
+		t.Errorf("Expected the error after the row: %v", objects)
+	}
+	for _, format := range []string{"csv", "tsv", "xlsx"} {
+		f, _ := Find(format)
+		if _, ok := f.NewWriter(&b, "sales").(ErrorWriter); ok {
+			t.Errorf("%v has no room for errors", format)
+		}
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	data := write(t, "xlsx", testRows)
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Error reading the zip: %v\n", err)
+	}
+	parts := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("Error opening %v: %v\n", f.Name, err)
+		}
+		content, _ := ioutil.ReadAll(r)
+		r.Close()
+		parts[f.Name] = string(content)
+		// every part has to be well formed.
+		d := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			_, err := d.Token()
+			if err != nil {
+				if err != io.EOF {
+					t.Errorf("%v is not valid xml: %v", f.Name, err)
+				}
+				break
+			}
+		}
+	}
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, cell := range []string{
+		`<c r="A1" s="3" t="inlineStr"><is><t xml:space="preserve">id</t></is></c>`,
+		`<c r="A2"><v>1</v></c>`,
+		`<c r="C2"><v>1.5</v></c>`,
+		`<c r="D2" s="1"><v>43832</v></c>`,
+		`<c r="E2" t="b"><v>1</v></c>`,
+		`<c r="B3" t="inlineStr"><is><t xml:space="preserve">&lt;c&gt;</t></is></c>`,
+		`<c r="D3" s="2"><v>43832.5</v></c>`,
+	} {
+		if !strings.Contains(sheet, cell) {
+			t.Errorf("Expected cell %v in the sheet:\n%v", cell, sheet)
+		}
+	}
+	if strings.Contains(sheet, `r="C3"`) {
+		t.Errorf("empty values should have no cell")
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `name="sales"`) {
+		t.Errorf("wrong workbook: %v", parts["xl/workbook.xml"])
+	}
+}
+
+func TestNames(t *testing.T) {
+	for col, name := range map[int]string{0: "A1", 25: "Z1", 26: "AA1", 701: "ZZ1", 702: "AAA1"} {
+		if cellName(col, 0) != name {
+			t.Errorf("Expected %v, but was %v", name, cellName(col, 0))
+		}
+	}
+	if sheetName("a/b: [c]") != "a_b_ _c_" || sheetName("") != "Sheet1" || len([]rune(sheetName(strings.Repeat("x", 40)))) != 31 {
+		t.Errorf("wrong sheet names")
+	}
+}
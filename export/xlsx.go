@@ -0,0 +1,233 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scompo/data-management/query"
+)
+
+// The XLSX files have a single sheet, its cells hold the text inline so
+// that the rows can be written as they come, without a table of the shared
+// strings.
+
+// maxRows is the number of rows in a sheet, the header included.
+const maxRows = 1048576
+
+// ErrTooManyRows is returned when the rows don't fit in a sheet.
+var ErrTooManyRows = errors.New("too many rows for a spreadsheet")
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+// xlsxParts are the parts of the file before the sheet, the workbook is
+// written apart for the name of the sheet.
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	// the cell styles are: 0 the default, 1 dates, 2 dates with the time
+	// and 3 the bold header.
+	{"xl/styles.xml", `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="2"><font/><font><b/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border/></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="4">` +
+		`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="22" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+		`</cellXfs>` +
+		`</styleSheet>`},
+}
+
+type xlsxWriter struct {
+	out   io.Writer
+	sheet string
+	z     *zip.Writer
+	w     *bufio.Writer
+	rows  int
+}
+
+func newXLSXWriter(w io.Writer, sheet string) Writer {
+	return &xlsxWriter{out: w, sheet: sheetName(sheet)}
+}
+
+// sheetName returns name without the characters not allowed in the names
+// of the sheets, and at most 31 characters long.
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if strings.TrimSpace(name) == "" {
+		return "Sheet1"
+	}
+	return name
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// cellName returns the name of the cell in the column col and row, both
+// starting from 0: A1, B1, ..., AA1.
+func cellName(col, row int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name + strconv.Itoa(row+1)
+}
+
+func (x *xlsxWriter) Header(columns []string) error {
+	x.z = zip.NewWriter(x.out)
+	for _, part := range xlsxParts {
+		err := x.writePart(part.name, part.content)
+		if err != nil {
+			return err
+		}
+	}
+	err := x.writePart("xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" `+
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`+
+		`<sheets><sheet name="`+escape(x.sheet)+`" sheetId="1" r:id="rId1"/></sheets></workbook>`)
+	if err != nil {
+		return err
+	}
+	f, err := x.z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	x.w = bufio.NewWriter(f)
+	x.w.WriteString(xmlHeader)
+	x.w.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	values := make([]interface{}, len(columns))
+	for i, c := range columns {
+		values[i] = c
+	}
+	return x.row(values, true)
+}
+
+func (x *xlsxWriter) writePart(name, content string) error {
+	f, err := x.z.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, xmlHeader+content)
+	return err
+}
+
+func (x *xlsxWriter) Row(values []interface{}) error {
+	return x.row(values, false)
+}
+
+// excelEpoch is the day 0 of the dates in the cells.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+func (x *xlsxWriter) row(values []interface{}, header bool) error {
+	if x.rows == maxRows {
+		return ErrTooManyRows
+	}
+	x.w.WriteString(`<row r="` + strconv.Itoa(x.rows+1) + `">`)
+	for i, v := range values {
+		ref := `<c r="` + cellName(i, x.rows) + `"`
+		switch v := v.(type) {
+		case nil:
+		case int64:
+			x.w.WriteString(ref + `><v>` + strconv.FormatInt(v, 10) + `</v></c>`)
+		case float64:
+			if !math.IsInf(v, 0) && !math.IsNaN(v) {
+				x.w.WriteString(ref + `><v>` + strconv.FormatFloat(v, 'g', -1, 64) + `</v></c>`)
+			}
+		case bool:
+			b := "0"
+			if v {
+				b = "1"
+			}
+			x.w.WriteString(ref + ` t="b"><v>` + b + `</v></c>`)
+		case time.Time:
+			// the dates are days since the epoch, in local time as the
+			// sheets know no time zones.
+			_, offset := v.Zone()
+			days := float64(v.Add(time.Duration(offset)*time.Second).UTC().Sub(excelEpoch)) / float64(24*time.Hour)
+			style := "2"
+			if days == math.Trunc(days) {
+				style = "1"
+			}
+			x.w.WriteString(ref + ` s="` + style + `"><v>` + strconv.FormatFloat(days, 'f', -1, 64) + `</v></c>`)
+		default:
+			style := ""
+			if header {
+				style = ` s="3"`
+			}
+			x.w.WriteString(ref + style + ` t="inlineStr"><is><t xml:space="preserve">` + escape(query.Format(v)) + `</t></is></c>`)
+		}
+	}
+	_, err := x.w.WriteString("</row>")
+	x.rows++
+	return err
+}
+
+func (x *xlsxWriter) Close() error {
+	x.w.WriteString("</sheetData></worksheet>")
+	err := x.w.Flush()
+	if err != nil {
+		return err
+	}
+	return x.z.Close()
+}
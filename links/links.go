@@ -0,0 +1,211 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+// Package links keeps the index of the wiki links between pages, to know
+// which pages link to a page.
+package links
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/scompo/data-management/utils"
+)
+
+var indexName = "links.json"
+
+// Ref is a page of a project, by project ID and page name.
+// The links to another project also have the name used for it, and no ID
+// while there is no project with that name.
+type Ref struct {
+	Project     string
+	ProjectName string `json:",omitempty"`
+	Page        string
+}
+
+func (r Ref) key() string {
+	return r.Project + "/" + r.Page
+}
+
+type entry struct {
+	From Ref
+	To   []Ref
+}
+
+// Index is the index of the links, saved in a json file inside a directory.
+type Index struct {
+	Dir string
+}
+
+// NewIndex returns the Index saved in dir.
+func NewIndex(dir string) *Index {
+	return &Index{Dir: dir}
+}
+
+// mu serializes the changes to the indexes.
+var mu sync.Mutex
+
+func (x *Index) path() string {
+	return filepath.Join(x.Dir, indexName)
+}
+
+// Exists reports if the index has been saved.
+func (x *Index) Exists() bool {
+	_, err := os.Stat(x.path())
+	return err == nil
+}
+
+func (x *Index) read() (map[string]entry, error) {
+	es := make(map[string]entry)
+	data, err := ioutil.ReadFile(x.path())
+	if os.IsNotExist(err) {
+		return es, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []entry
+	err = json.Unmarshal(data, &list)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range list {
+		es[e.From.key()] = e
+	}
+	return es, nil
+}
+
+func (x *Index) write(es map[string]entry) error {
+	list := make([]entry, 0, len(es))
+	for _, e := range es {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].From.key() < list[j].From.key()
+	})
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(x.Dir, 0775)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(x.path(), data)
+}
+
+// update applies change to the index.
+func (x *Index) update(change func(es map[string]entry)) error {
+	mu.Lock()
+	defer mu.Unlock()
+	es, err := x.read()
+	if err != nil {
+		return err
+	}
+	change(es)
+	return x.write(es)
+}
+
+// Set records that the page from links to the pages to, replacing what was
+// recorded before.
+func (x *Index) Set(from Ref, to []Ref) error {
+	return x.update(func(es map[string]entry) {
+		if len(to) == 0 {
+			delete(es, from.key())
+			return
+		}
+		es[from.key()] = entry{From: from, To: to}
+	})
+}
+
+// Remove forgets the links from the page from.
+func (x *Index) Remove(from Ref) error {
+	return x.update(func(es map[string]entry) {
+		delete(es, from.key())
+	})
+}
+
+// RemoveProject forgets the links from all the pages of the project with
+// the ID id.
+func (x *Index) RemoveProject(id string) error {
+	return x.update(func(es map[string]entry) {
+		for k, e := range es {
+			if e.From.Project == id {
+				delete(es, k)
+			}
+		}
+	})
+}
+
+// ResolveProject points the links to the project name, saved or renamed
+// just now, to its ID id. The links to id with another name, the one
+// before the rename, are left without a project.
+func (x *Index) ResolveProject(name, id string) error {
+	return x.update(func(es map[string]entry) {
+		for _, e := range es {
+			for i, r := range e.To {
+				switch {
+				case r.ProjectName == name:
+					e.To[i].Project = id
+				case r.ProjectName != "" && r.Project == id:
+					e.To[i].Project = ""
+				}
+			}
+		}
+	})
+}
+
+// Backlinks returns the pages linking to the page to, sorted by project
+// and name.
+func (x *Index) Backlinks(to Ref) ([]Ref, error) {
+	mu.Lock()
+	es, err := x.read()
+	mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]Ref, 0)
+	for _, e := range es {
+		for _, r := range e.To {
+			if r.Project == to.Project && r.Page == to.Page {
+				refs = append(refs, e.From)
+				break
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].key() < refs[j].key()
+	})
+	return refs, nil
+}
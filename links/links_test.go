@@ -0,0 +1,99 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package links
+
+import (
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	x := NewIndex(t.TempDir())
+	if x.Exists() {
+		t.Errorf("the index should not exist before saving")
+	}
+	a := Ref{Project: "p1", Page: "a"}
+	b := Ref{Project: "p1", Page: "b"}
+	c := Ref{Project: "p2", Page: "c"}
+	if err := x.Set(a, []Ref{b, c}); err != nil {
+		t.Fatalf("Error setting: %v\n", err)
+	}
+	if err := x.Set(c, []Ref{b}); err != nil {
+		t.Fatalf("Error setting: %v\n", err)
+	}
+	refs, err := x.Backlinks(b)
+	if err != nil || len(refs) != 2 || refs[0] != a || refs[1] != c {
+		t.Errorf("Expected backlinks from a and c, but found %+v, %v", refs, err)
+	}
+	if err := x.Set(a, []Ref{c}); err != nil {
+		t.Fatalf("Error setting: %v\n", err)
+	}
+	refs, _ = x.Backlinks(b)
+	if len(refs) != 1 || refs[0] != c {
+		t.Errorf("Expected backlinks from c, but found %+v", refs)
+	}
+	if err := x.RemoveProject("p2"); err != nil {
+		t.Fatalf("Error removing project: %v\n", err)
+	}
+	refs, _ = x.Backlinks(b)
+	if len(refs) != 0 {
+		t.Errorf("Expected no backlinks, but found %+v", refs)
+	}
+	if err := x.Remove(a); err != nil {
+		t.Fatalf("Error removing: %v\n", err)
+	}
+	refs, _ = x.Backlinks(c)
+	if len(refs) != 0 || !x.Exists() {
+		t.Errorf("Expected no backlinks, but found %+v", refs)
+	}
+}
+
+func TestResolveProject(t *testing.T) {
+	x := NewIndex(t.TempDir())
+	a := Ref{Project: "p1", Page: "a"}
+	if err := x.Set(a, []Ref{{ProjectName: "later", Page: "b"}}); err != nil {
+		t.Fatalf("Error setting: %v\n", err)
+	}
+	if err := x.ResolveProject("later", "p2"); err != nil {
+		t.Fatalf("Error resolving: %v\n", err)
+	}
+	refs, err := x.Backlinks(Ref{Project: "p2", Page: "b"})
+	if err != nil || len(refs) != 1 || refs[0] != a {
+		t.Errorf("Expected backlinks from a, but found %+v, %v", refs, err)
+	}
+	// p2 is renamed.
+	if err := x.ResolveProject("other", "p2"); err != nil {
+		t.Fatalf("Error resolving: %v\n", err)
+	}
+	refs, _ = x.Backlinks(Ref{Project: "p2", Page: "b"})
+	if len(refs) != 0 {
+		t.Errorf("Expected no backlinks after the rename, but found %+v", refs)
+	}
+}
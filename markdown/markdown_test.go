@@ -0,0 +1,70 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		contains []string
+		missing  []string
+	}{
+		{"commonmark", "# Title\n\nsome *text*", []string{"<h1>Title</h1>", "<em>text</em>"}, nil},
+		{"table", "| a | b |\n|---|:-:|\n| 1 | 2 |", []string{"<table>", "<th>a</th>", `<td align="center">2</td>`}, nil},
+		{"task list", "- [x] done\n- [ ] todo", []string{`<input checked="" disabled="" type="checkbox"`, `<input disabled="" type="checkbox"`}, nil},
+		{"highlighting", "```go\nfunc main() {}\n```", []string{`<pre class="chroma">`, `<span class="kd">func</span>`}, nil},
+		{"script", "<script>alert(1)</script>hi", nil, []string{"<script"}},
+		{"javascript link", "[x](javascript:alert(1))", nil, []string{"javascript:"}},
+		{"event handler", `<img src="x.png" onerror="alert(1)">`, nil, []string{"onerror"}},
+		{"style", `<span style="color: red" class="x">s</span>`, nil, []string{"style="}},
+	}
+	for _, test := range tests {
+		res, err := Render(test.src)
+		if err != nil {
+			t.Errorf("%v: error rendering: %v\n", test.name, err)
+		}
+		for _, s := range test.contains {
+			if !strings.Contains(string(res), s) {
+				t.Errorf("%v: \"%v\" not in \"%v\"", test.name, s, res)
+			}
+		}
+		for _, s := range test.missing {
+			if strings.Contains(string(res), s) {
+				t.Errorf("%v: \"%v\" should not be in \"%v\"", test.name, s, res)
+			}
+		}
+	}
+}
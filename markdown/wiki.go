@@ -0,0 +1,236 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"net/url"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Link is a wiki link, [[Page]] or [[Project:Page]].
+// Project is empty when the link is to a page of the same project.
+type Link struct {
+	Project string
+	Page    string
+}
+
+// Resolver finds where wiki links point to.
+// Resolve returns the URL of the page linked, and if it exists. An empty
+// URL means there is nothing to link to.
+// Attachment returns the URL of the attachment name, used by the links and
+// the images with an attachment:name destination.
+type Resolver interface {
+	Resolve(l Link) (url string, exists bool)
+	Attachment(name string) string
+}
+
+// attachmentScheme starts the destinations of links and images pointing to
+// the attachments.
+const attachmentScheme = "attachment:"
+
+// wikiLink is the node of a wiki link in the markdown document.
+type wikiLink struct {
+	ast.BaseInline
+	Link    Link
+	Label   string
+	URL     string
+	Missing bool
+}
+
+var kindWikiLink = ast.NewNodeKind("WikiLink")
+
+func (n *wikiLink) Kind() ast.NodeKind {
+	return kindWikiLink
+}
+
+func (n *wikiLink) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{
+		"Project": n.Link.Project,
+		"Page":    n.Link.Page,
+	}, nil)
+}
+
+// resolverKey keeps the Resolver of a conversion in the parser context.
+var resolverKey = parser.NewContextKey()
+
+type wikiParser struct{}
+
+func (p wikiParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (p wikiParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	end := bytes.Index(line, []byte("]]"))
+	if end < 0 {
+		return nil
+	}
+	label := string(line[2:end])
+	if strings.TrimSpace(label) == "" || strings.ContainsAny(label, "[]") {
+		return nil
+	}
+	block.Advance(end + 2)
+	n := &wikiLink{Link: parseLink(label), Label: label}
+	if res, ok := pc.Get(resolverKey).(Resolver); ok {
+		var exists bool
+		n.URL, exists = res.Resolve(n.Link)
+		n.Missing = !exists
+	} else {
+		n.Missing = true
+	}
+	return n
+}
+
+// parseLink splits the text of a wiki link in project and page.
+func parseLink(s string) Link {
+	var l Link
+	if i := strings.Index(s, ":"); i >= 0 {
+		l.Project = strings.TrimSpace(s[:i])
+		s = s[i+1:]
+	}
+	l.Page = strings.TrimSpace(s)
+	return l
+}
+
+type wikiRenderer struct{}
+
+func (r wikiRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindWikiLink, r.render)
+}
+
+func (r wikiRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*wikiLink)
+	class := "wiki-link"
+	if n.Missing {
+		class = "wiki-missing"
+	}
+	label := template.HTMLEscapeString(n.Label)
+	if n.URL == "" {
+		w.WriteString(`<span class="` + class + `">` + label + `</span>`)
+		return ast.WalkSkipChildren, nil
+	}
+	w.WriteString(`<a href="` + template.HTMLEscapeString(n.URL) + `" class="` + class + `">` + label + `</a>`)
+	return ast.WalkSkipChildren, nil
+}
+
+// attachmentLinks rewrites the attachment destinations with the URLs given
+// by the Resolver. Without one they are left as they are, and removed by
+// the sanitization.
+type attachmentLinks struct{}
+
+func (t attachmentLinks) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	res, ok := pc.Get(resolverKey).(Resolver)
+	if !ok {
+		return
+	}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		var dest *[]byte
+		switch n := n.(type) {
+		case *ast.Image:
+			dest = &n.Destination
+		case *ast.Link:
+			dest = &n.Destination
+		default:
+			return ast.WalkContinue, nil
+		}
+		if bytes.HasPrefix(*dest, []byte(attachmentScheme)) {
+			name := string((*dest)[len(attachmentScheme):])
+			// names with spaces are written escaped.
+			if unescaped, err := url.PathUnescape(name); err == nil {
+				name = unescaped
+			}
+			*dest = []byte(res.Attachment(name))
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+type wiki struct{}
+
+func (e wiki) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		// before the standard links, that would take the first bracket.
+		util.Prioritized(wikiParser{}, 199),
+	), parser.WithASTTransformers(
+		util.Prioritized(attachmentLinks{}, 100),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(wikiRenderer{}, 500),
+	))
+}
+
+// RenderWiki renders the markdown in src to sanitized HTML like Render, with
+// the wiki links and the attachments pointing where res says.
+func RenderWiki(src string, res Resolver) (template.HTML, error) {
+	ctx := parser.NewContext()
+	ctx.Set(resolverKey, res)
+	var buf bytes.Buffer
+	err := md.Convert([]byte(src), &buf, parser.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(policy.SanitizeBytes(buf.Bytes())), nil
+}
+
+// Links returns the wiki links in the markdown in src, each once, in the
+// order they appear. Links inside code are not links.
+func Links(src string) []Link {
+	source := []byte(src)
+	doc := md.Parser().Parse(text.NewReader(source))
+	var ls []Link
+	seen := make(map[Link]bool)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if l, ok := n.(*wikiLink); ok && entering && !seen[l.Link] {
+			seen[l.Link] = true
+			ls = append(ls, l.Link)
+		}
+		return ast.WalkContinue, nil
+	})
+	return ls
+}
@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package markdown
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type testResolver map[string]bool
+
+func (r testResolver) Resolve(l Link) (string, bool) {
+	if l.Project == "none" {
+		return "", false
+	}
+	if l.Project != "" {
+		return "/wiki/" + l.Project + "/" + url.PathEscape(l.Page), r[l.Page]
+	}
+	return "/wiki/" + url.PathEscape(l.Page), r[l.Page]
+}
+
+func (r testResolver) Attachment(name string) string {
+	return "/files/" + url.PathEscape(name)
+}
+
+func TestRenderWiki(t *testing.T) {
+	res := testResolver{"Home": true}
+	tests := []struct {
+		src      string
+		contains string
+	}{
+		{"see [[Home]]", `<a href="/wiki/Home" class="wiki-link" rel="nofollow">Home</a>`},
+		{"see [[Other page]]", `<a href="/wiki/Other%20page" class="wiki-missing" rel="nofollow">Other page</a>`},
+		{"see [[prj:Home]]", `<a href="/wiki/prj/Home" class="wiki-link" rel="nofollow">prj:Home</a>`},
+		{"see [[none:Home]]", `<span class="wiki-missing">none:Home</span>`},
+		{"see `[[Home]]`", `<code>[[Home]]</code>`},
+		{"see [link](/x)", `<a href="/x" rel="nofollow">link</a>`},
+		{"see [[<b>x</b>]]", `&lt;b&gt;x&lt;/b&gt;`},
+		{"![a picture](attachment:my%20image.png)", `<img src="/files/my%20image.png" alt="a picture">`},
+		{"[the data](attachment:data.csv)", `<a href="/files/data.csv" rel="nofollow">the data</a>`},
+	}
+	for _, test := range tests {
+		out, err := RenderWiki(test.src, res)
+		if err != nil {
+			t.Errorf("Error rendering \"%v\": %v\n", test.src, err)
+		}
+		if !strings.Contains(string(out), test.contains) {
+			t.Errorf("\"%v\" not in \"%v\"", test.contains, out)
+		}
+	}
+}
+
+func TestLinks(t *testing.T) {
+	ls := Links("[[a]] and [[ p : b ]], [[a]] again\n\n    [[in code]]\n\n`[[code]]`")
+	if len(ls) != 2 || ls[0] != (Link{Page: "a"}) || ls[1] != (Link{Project: "p", Page: "b"}) {
+		t.Errorf("Expected links to a and p:b, but found %+v", ls)
+	}
+}
+
+func TestRenderAttachmentWithoutResolver(t *testing.T) {
+	out, err := Render("![a picture](attachment:image.png)")
+	if err != nil || strings.Contains(string(out), "attachment:") {
+		t.Errorf("attachment links should be removed without a resolver: %v, %v", out, err)
+	}
+}
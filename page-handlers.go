@@ -0,0 +1,377 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"errors"
+	"github.com/scompo/data-management/links"
+	"github.com/scompo/data-management/pages"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/utils"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+)
+
+// pages returns the store of the pages of prj.
+func (a *app) pages(prj projects.Project) *pages.Store {
+	return pages.NewStore(filepath.Join(a.dir, prj.ID))
+}
+
+// pageURL returns the path of a page of a project.
+func pageURL(prj projects.Project, name string) string {
+	return projectURL(prj) + "/pages/" + url.PathEscape(name)
+}
+
+// pathPage returns the project and the page named in the request path, if
+// the user has role in the project.
+func (a *app) pathPage(r *http.Request, role projects.Role) (projects.Project, pages.Page, error) {
+	prj, err := a.pathProject(r, role)
+	if err != nil {
+		return prj, pages.Page{}, err
+	}
+	p, err := a.pages(prj).Get(r.PathValue("page"))
+	return prj, p, err
+}
+
+// pageTreeItem is a page in the tree shown on the project view.
+type pageTreeItem struct {
+	Page     pages.Page
+	URL      string
+	Children []pageTreeItem
+}
+
+// pageTree returns the items to show for the pages in tree of prj.
+func pageTree(prj projects.Project, tree []*pages.Node) []pageTreeItem {
+	items := make([]pageTreeItem, len(tree))
+	for i, n := range tree {
+		items[i] = pageTreeItem{
+			Page:     n.Page,
+			URL:      pageURL(prj, n.Page.Name),
+			Children: pageTree(prj, n.Children),
+		}
+	}
+	return items
+}
+
+// pageCrumbs returns the breadcrumbs to the page name of prj, through the
+// pages containing it. The empty name is the project itself.
+func (a *app) pageCrumbs(prj projects.Project, name string) ([]Breadcrumb, error) {
+	crumbs := projectCrumbs(prj)
+	if name == "" {
+		return crumbs, nil
+	}
+	store := a.pages(prj)
+	p, err := store.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	ancestors, err := store.Ancestors(p.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, ancestor := range append(ancestors, p) {
+		crumbs = append(crumbs, Breadcrumb{Name: ancestor.Name, URL: pageURL(prj, ancestor.Name)})
+	}
+	return crumbs, nil
+}
+
+// pageWebPage returns the WebPage called pageName, about the page name of
+// prj.
+func (a *app) pageWebPage(prj projects.Project, name, pageName string) (WebPage, error) {
+	crumbs, err := a.pageCrumbs(prj, name)
+	return WebPage{
+		Title:       appName,
+		PageName:    pageName,
+		Breadcrumbs: crumbs,
+	}, err
+}
+
+// renderPageEditor renders the markdown editor for a page, posting to
+// action. errs are the validation errors to show next to the fields.
+// New pages can choose their parent.
+func (a *app) renderPageEditor(w http.ResponseWriter, r *http.Request, pageName, action string, prj projects.Project, p pages.Page, errs map[string]string) error {
+	// the breadcrumbs of a new page lead to its parent, when it exists.
+	at := p.Name
+	if p.Created.IsZero() {
+		at = p.Parent
+		if _, err := a.pages(prj).Get(at); err != nil {
+			at = ""
+		}
+	}
+	wp, err := a.pageWebPage(prj, at, pageName)
+	if err != nil {
+		return err
+	}
+	ps, err := a.pages(prj).All()
+	if err != nil {
+		return err
+	}
+	t, err := prepareAppTemplate(r, "templates/pages/new.html")
+	if err != nil {
+		return err
+	}
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage": wp,
+		"Action":  action,
+		"Project": prj,
+		"Page":    p,
+		"Pages":   ps,
+		"Errors":  errs,
+	})
+}
+
+// newPageHandler creates a page in the project with the ID in the Project
+// parameter. The Name and Parent parameters can suggest the name and the
+// parent of the page.
+func (a *app) newPageHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, err := a.projects.ByID(r.FormValue("Project"))
+	if err == nil {
+		err = authorize(r, prj, projects.Editor)
+	}
+	if err != nil {
+		return err
+	}
+	switch r.Method {
+	case "POST":
+		p := pages.Page{
+			Name:   r.PostFormValue("Name"),
+			Body:   r.PostFormValue("Body"),
+			Parent: r.PostFormValue("Parent"),
+		}
+		err = a.pages(prj).Create(p, pageChange(r))
+		if errs, ok := formErrors(err); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return a.renderPageEditor(w, r, "New Page", "/pages/new", prj, p, errs)
+		}
+		if err != nil {
+			return err
+		}
+		p.Name, _ = utils.NormalizeName(p.Name)
+		err = a.indexLinks(prj, p.Name, p.Body)
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, pageURL(prj, p.Name), http.StatusSeeOther)
+		return nil
+	case "GET":
+		q := r.URL.Query()
+		p := pages.Page{Name: q.Get("Name"), Parent: q.Get("Parent")}
+		return a.renderPageEditor(w, r, "New Page", "/pages/new", prj, p, nil)
+	default:
+		return utils.MethodNotAllowed(r.Method)
+	}
+}
+
+func (a *app) viewPageHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, p, err := a.pathPage(r, projects.Viewer)
+	if err != nil {
+		return err
+	}
+	content, err := a.renderPage(r, prj, p.Body)
+	if err != nil {
+		return err
+	}
+	backlinks, err := a.backlinks(r, prj, p.Name)
+	if err != nil {
+		return err
+	}
+	wp, err := a.pageWebPage(prj, p.Name, p.Name)
+	if err != nil {
+		return err
+	}
+	t, err := prepareAppTemplate(r, "templates/pages/view.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage":   wp,
+		"Project":   prj,
+		"Access":    newProjectItem(r, prj),
+		"Page":      p,
+		"Content":   content,
+		"Backlinks": backlinks,
+	})
+}
+
+func (a *app) editPageHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, p, err := a.pathPage(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	switch r.Method {
+	case "POST":
+		p.Body = r.PostFormValue("Body")
+		err = a.pages(prj).Update(p, pageChange(r))
+		if err != nil {
+			return err
+		}
+		err = a.indexLinks(prj, p.Name, p.Body)
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, pageURL(prj, p.Name), http.StatusSeeOther)
+		return nil
+	case "GET":
+		return a.renderPageEditor(w, r, "Edit Page", pageURL(prj, p.Name)+"/edit", prj, p, nil)
+	default:
+		return utils.MethodNotAllowed(r.Method)
+	}
+}
+
+// deletePageHandler asks for confirmation on GET, the page is deleted only
+// by POST or DELETE.
+func (a *app) deletePageHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, p, err := a.pathPage(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	switch r.Method {
+	case "POST", "DELETE":
+		err = a.pages(prj).Delete(p.Name)
+		if err != nil {
+			return err
+		}
+		err = a.links.Remove(links.Ref{Project: prj.ID, Page: p.Name})
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, projectURL(prj), http.StatusSeeOther)
+		return nil
+	case "GET":
+		wp, err := a.pageWebPage(prj, p.Name, "Delete Page")
+		if err != nil {
+			return err
+		}
+		t, err := prepareAppTemplate(r, "templates/pages/delete.html")
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, map[string]interface{}{
+			"WebPage": wp,
+			"Project": prj,
+			"Page":    p,
+		})
+	default:
+		return utils.MethodNotAllowed(r.Method)
+	}
+}
+
+// movePageHandler moves a page in the tree: Parent is the name of the new
+// parent, empty for the top level, and Position the place among its
+// children, starting from 1.
+func (a *app) movePageHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, p, err := a.pathPage(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	switch r.Method {
+	case "POST":
+		position, err := strconv.Atoi(r.PostFormValue("Position"))
+		if err != nil {
+			return utils.BadRequest(errors.New("invalid position " + r.PostFormValue("Position")))
+		}
+		err = a.pages(prj).Move(p.Name, r.PostFormValue("Parent"), position-1)
+		if errs, ok := formErrors(err); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return a.renderMovePage(w, r, prj, p, errs)
+		}
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, projectURL(prj), http.StatusSeeOther)
+		return nil
+	case "GET":
+		return a.renderMovePage(w, r, prj, p, nil)
+	default:
+		return utils.MethodNotAllowed(r.Method)
+	}
+}
+
+// renderMovePage renders the forms to move p, errs are the validation
+// errors to show next to the fields.
+func (a *app) renderMovePage(w http.ResponseWriter, r *http.Request, prj projects.Project, p pages.Page, errs map[string]string) error {
+	store := a.pages(prj)
+	tree, err := store.Tree()
+	if err != nil {
+		return err
+	}
+	siblings, err := store.Children(p.Parent)
+	if err != nil {
+		return err
+	}
+	position := 1
+	for i, sibling := range siblings {
+		if sibling.Name == p.Name {
+			position = i + 1
+		}
+	}
+	wp, err := a.pageWebPage(prj, p.Name, "Move Page")
+	if err != nil {
+		return err
+	}
+	t, err := prepareAppTemplate(r, "templates/pages/move.html")
+	if err != nil {
+		return err
+	}
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage":  wp,
+		"Project":  prj,
+		"Page":     p,
+		"Parents":  parentCandidates(tree, p.Name),
+		"Siblings": len(siblings),
+		"Position": position,
+		"Up":       position - 1,
+		"Down":     position + 1,
+		"Errors":   errs,
+	})
+}
+
+// parentCandidates returns the names of the pages in tree that can contain
+// the page name: all but the page itself and the pages inside it.
+func parentCandidates(tree []*pages.Node, name string) []string {
+	names := make([]string, 0)
+	for _, n := range tree {
+		if n.Page.Name == name {
+			continue
+		}
+		names = append(names, n.Page.Name)
+		names = append(names, parentCandidates(n.Children, name)...)
+	}
+	return names
+}
@@ -0,0 +1,228 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"fmt"
+	"github.com/scompo/data-management/diff"
+	"github.com/scompo/data-management/pages"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/utils"
+	"net/http"
+	"strconv"
+)
+
+// diffContext is the number of unchanged lines shown around the changes in
+// the unified diff.
+const diffContext = 3
+
+// pageChange returns the change described by the Message form value, made
+// by the user logged in.
+func pageChange(r *http.Request) pages.Change {
+	return pages.Change{
+		Author:  currentUser(r),
+		Message: r.PostFormValue("Message"),
+	}
+}
+
+// revisionNumber parses the revision number s of the page name, a bad one
+// is a revision not found.
+func revisionNumber(name, s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v revision %v", pages.ErrNotFound, name, s)
+	}
+	return n, nil
+}
+
+// pageHistoryHandler lists the revisions of a page.
+func (a *app) pageHistoryHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, p, err := a.pathPage(r, projects.Viewer)
+	if err != nil {
+		return err
+	}
+	revs, err := a.pages(prj).Revisions(p.Name)
+	if err != nil {
+		return err
+	}
+	wp, err := a.pageWebPage(prj, p.Name, "History of "+p.Name)
+	if err != nil {
+		return err
+	}
+	t, err := prepareAppTemplate(r, "templates/pages/history.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage":   wp,
+		"Project":   prj,
+		"Page":      p,
+		"Revisions": revs,
+	})
+}
+
+// viewRevisionHandler shows a page as it was in a revision.
+func (a *app) viewRevisionHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, p, err := a.pathPage(r, projects.Viewer)
+	if err != nil {
+		return err
+	}
+	n, err := revisionNumber(p.Name, r.PathValue("n"))
+	if err != nil {
+		return err
+	}
+	rev, err := a.pages(prj).Revision(p.Name, n)
+	if err != nil {
+		return err
+	}
+	content, err := a.renderPage(r, prj, rev.Body)
+	if err != nil {
+		return err
+	}
+	wp, err := a.pageWebPage(prj, p.Name, p.Name)
+	if err != nil {
+		return err
+	}
+	t, err := prepareAppTemplate(r, "templates/pages/revision.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage":  wp,
+		"Project":  prj,
+		"Page":     p,
+		"Revision": rev,
+		"Content":  content,
+	})
+}
+
+// restoreRevisionHandler makes a new revision of a page with the body of
+// an old one.
+func (a *app) restoreRevisionHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, p, err := a.pathPage(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	n, err := revisionNumber(p.Name, r.PathValue("n"))
+	if err != nil {
+		return err
+	}
+	store := a.pages(prj)
+	err = store.Restore(p.Name, n, pageChange(r))
+	if err != nil {
+		return err
+	}
+	p, err = store.Get(p.Name)
+	if err != nil {
+		return err
+	}
+	err = a.indexLinks(prj, p.Name, p.Body)
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, pageURL(prj, p.Name), http.StatusSeeOther)
+	return nil
+}
+
+// pageDiffHandler shows the differences between the revisions from and to
+// of a page, unified or side by side as asked by view.
+// By default the last revision is compared with the one before.
+func (a *app) pageDiffHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, p, err := a.pathPage(r, projects.Viewer)
+	if err != nil {
+		return err
+	}
+	q := r.URL.Query()
+	to := p.Revision
+	if s := q.Get("to"); s != "" {
+		to, err = revisionNumber(p.Name, s)
+		if err != nil {
+			return err
+		}
+	}
+	from := to - 1
+	if s := q.Get("from"); s != "" {
+		from, err = revisionNumber(p.Name, s)
+		if err != nil {
+			return err
+		}
+	}
+	store := a.pages(prj)
+	newRev, err := store.Revision(p.Name, to)
+	if err != nil {
+		return err
+	}
+	// the first revision is compared with nothing.
+	var oldRev pages.Revision
+	if from != 0 {
+		oldRev, err = store.Revision(p.Name, from)
+		if err != nil {
+			return err
+		}
+	}
+	wp, err := a.pageWebPage(prj, p.Name, "Changes to "+p.Name)
+	if err != nil {
+		return err
+	}
+	lines := diff.Texts(oldRev.Body, newRev.Body)
+	data := map[string]interface{}{
+		"WebPage": wp,
+		"Project": prj,
+		"Page":    p,
+		"From":    oldRev,
+		"To":      newRev,
+		"Changed": diff.Changed(lines),
+	}
+	if q.Get("view") == "side" {
+		data["View"] = "side"
+		data["Rows"] = diff.SideBySide(lines)
+	} else {
+		data["View"] = "unified"
+		data["Hunks"] = diff.Unified(lines, diffContext)
+	}
+	t, err := prepareAppTemplate(r, "templates/pages/diff.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
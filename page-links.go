@@ -0,0 +1,173 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"errors"
+	"github.com/scompo/data-management/links"
+	"github.com/scompo/data-management/markdown"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/utils"
+	"html/template"
+	"net/http"
+	"net/url"
+)
+
+// pageLinks resolves the wiki links in the pages of a project, for the
+// user making r.
+type pageLinks struct {
+	a   *app
+	r   *http.Request
+	prj projects.Project
+}
+
+// target returns the project and the normalized page name a link points to.
+func (pl pageLinks) target(l markdown.Link) (projects.Project, string, error) {
+	prj := pl.prj
+	if l.Project != "" {
+		var err error
+		prj, err = pl.a.projects.Get(l.Project)
+		if err != nil {
+			return prj, "", err
+		}
+	}
+	name, err := utils.NormalizeName(l.Page)
+	return prj, name, err
+}
+
+// Resolve links to the page, or to its creation when it does not exist.
+// There is no link when the project does not exist, the user can't see it
+// or the name is not valid.
+func (pl pageLinks) Resolve(l markdown.Link) (string, bool) {
+	prj, name, err := pl.target(l)
+	if err == nil {
+		err = authorize(pl.r, prj, projects.Viewer)
+	}
+	if err != nil {
+		return "", false
+	}
+	_, err = pl.a.pages(prj).Get(name)
+	if err != nil {
+		return "/pages/new?Project=" + url.QueryEscape(prj.ID) + "&Name=" + url.QueryEscape(name), false
+	}
+	return pageURL(prj, name), true
+}
+
+// Attachment links to the attachment name of the project.
+func (pl pageLinks) Attachment(name string) string {
+	return attachmentURL(pl.prj, name)
+}
+
+// renderPage renders the body of a page of prj for the user making r, with
+// its wiki links.
+func (a *app) renderPage(r *http.Request, prj projects.Project, body string) (template.HTML, error) {
+	return markdown.RenderWiki(body, pageLinks{a: a, r: r, prj: prj})
+}
+
+// indexLinks records the wiki links in the body of the page name of prj.
+// Links to projects that do not exist are recorded by the project name,
+// until a project with that name is saved.
+func (a *app) indexLinks(prj projects.Project, name, body string) error {
+	to := make([]links.Ref, 0)
+	for _, l := range markdown.Links(body) {
+		page, err := utils.NormalizeName(l.Page)
+		if err != nil {
+			continue
+		}
+		ref := links.Ref{Project: prj.ID, Page: page}
+		if l.Project != "" {
+			ref.Project = ""
+			ref.ProjectName, err = utils.NormalizeName(l.Project)
+			if err != nil {
+				continue
+			}
+			target, err := a.projects.Get(ref.ProjectName)
+			if err == nil {
+				ref.Project = target.ID
+			} else if !errors.Is(err, projects.ErrNotFound) {
+				continue
+			}
+		}
+		to = append(to, ref)
+	}
+	return a.links.Set(links.Ref{Project: prj.ID, Page: name}, to)
+}
+
+// linkProject points the wiki links naming prj, saved or renamed just now,
+// to it.
+func (a *app) linkProject(prj projects.Project) error {
+	return a.links.ResolveProject(prj.Name, prj.ID)
+}
+
+// indexAllLinks records the wiki links of all the pages.
+func (a *app) indexAllLinks() error {
+	for _, prj := range a.projects.All() {
+		ps, err := a.pages(prj).All()
+		if err != nil {
+			return err
+		}
+		for _, p := range ps {
+			err = a.indexLinks(prj, p.Name, p.Body)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backlink is a page linking to another one.
+type backlink struct {
+	Project projects.Project
+	Page    string
+}
+
+// backlinks returns the pages linking to the page name of prj.
+// Projects deleted in the meantime, and the ones the user making r can't
+// see, are left out.
+func (a *app) backlinks(r *http.Request, prj projects.Project, name string) ([]backlink, error) {
+	refs, err := a.links.Backlinks(links.Ref{Project: prj.ID, Page: name})
+	if err != nil {
+		return nil, err
+	}
+	bs := make([]backlink, 0, len(refs))
+	for _, ref := range refs {
+		from, err := a.projects.ByID(ref.Project)
+		if err == nil {
+			err = authorize(r, from, projects.Viewer)
+		}
+		if err != nil {
+			continue
+		}
+		bs = append(bs, backlink{Project: from, Page: ref.Page})
+	}
+	return bs, nil
+}
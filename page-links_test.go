@@ -0,0 +1,85 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"github.com/scompo/data-management/projects"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestLinksToLaterProjects(t *testing.T) {
+	a := newApp(projects.NewMemoryStore(), t.TempDir())
+	h := loggedIn(t, a, "mauro")
+	r := withUser(httptest.NewRequest("GET", "/", nil), "mauro")
+	if err := a.projects.Save(ownedProject(r, projects.Project{Name: "x"})); err != nil {
+		t.Fatalf("Error saving: %v\n", err)
+	}
+	prj, _ := a.projects.Get("x")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, formRequest("/pages/new", url.Values{"Project": {prj.ID}, "Name": {"home"}, "Body": {"see [[later:target]]"}}))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Error creating the page: %v", w.Code)
+	}
+	backlinks := func(name string) []backlink {
+		target, err := a.projects.Get(name)
+		if err != nil {
+			t.Fatalf("Error getting %v: %v\n", name, err)
+		}
+		bs, err := a.backlinks(r, target, "target")
+		if err != nil {
+			t.Fatalf("Error reading the backlinks: %v\n", err)
+		}
+		return bs
+	}
+
+	var p apiProject
+	if code := apiRequest(t, h, "POST", "/api/v1/projects", `{"name":"later"}`, &p); code != http.StatusCreated {
+		t.Fatalf("Error creating: %v %+v", code, p)
+	}
+	if bs := backlinks("later"); len(bs) != 1 || bs[0].Project.ID != prj.ID || bs[0].Page != "home" {
+		t.Errorf("the link should be resolved when the project is created: %+v", bs)
+	}
+	if code := apiRequest(t, h, "PATCH", "/api/v1/projects/"+p.ID, `{"name":"renamed"}`, &p); code != http.StatusOK {
+		t.Fatalf("Error renaming: %v %+v", code, p)
+	}
+	if bs := backlinks("renamed"); len(bs) != 0 {
+		t.Errorf("the link names the project before the rename: %+v", bs)
+	}
+	if code := apiRequest(t, h, "POST", "/api/v1/projects", `{"name":"later"}`, &p); code != http.StatusCreated {
+		t.Fatalf("Error creating: %v %+v", code, p)
+	}
+	if bs := backlinks("later"); len(bs) != 1 {
+		t.Errorf("the link should be resolved to the new project: %+v", bs)
+	}
+}
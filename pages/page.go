@@ -0,0 +1,321 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+// Package pages contains pages definition and functions.
+// Pages are markdown documents saved inside a project directory.
+package pages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/scompo/data-management/utils"
+)
+
+// DirName is the directory inside a project where its pages are saved.
+const DirName = "pages"
+
+var metaName = "page.json"
+var contentName = "content.md"
+
+// ErrNotFound is returned when a page does not exist.
+var ErrNotFound = errors.New("page not found")
+
+// ErrExists is returned when a page name is already used.
+var ErrExists = errors.New("page name already existent")
+
+// Page type definition
+// Revision is the number of the last revision, and Author who made it.
+// Parent is the name of the page containing this one, empty for the top
+// level pages, Order its position among the pages with the same parent.
+type Page struct {
+	Name     string
+	Body     string `json:"-"`
+	Created  time.Time
+	Updated  time.Time
+	Revision int
+	Author   string
+	Parent   string
+	Order    int
+}
+
+// Change tells who is changing a page and why.
+type Change struct {
+	Author  string
+	Message string
+}
+
+var currentTime = time.Now
+
+// ValidationError is returned when a page field is not acceptable.
+type ValidationError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid page " + e.Field + " \"" + e.Value + "\": " + e.Reason
+}
+
+// Store saves the pages of a project, a directory for every page inside Dir.
+type Store struct {
+	Dir string
+}
+
+// NewStore returns the Store for the pages of the project in projectDir.
+func NewStore(projectDir string) *Store {
+	return &Store{Dir: filepath.Join(projectDir, DirName)}
+}
+
+// lock serializes the changes to the pages of the project, between
+// goroutines and between processes sharing the directory, so that every
+// revision gets its own number.
+// The returned function releases it.
+func (s *Store) lock() (func(), error) {
+	err := os.MkdirAll(s.Dir, 0775)
+	if err != nil {
+		return nil, err
+	}
+	return utils.LockDir(s.Dir)
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.Dir, name)
+}
+
+// Create saves a new page, as its first revision, after the other children
+// of its parent.
+// Returns an error if a page with the same name already exists.
+func (s *Store) Create(p Page, c Change) error {
+	name, err := utils.NormalizeName(p.Name)
+	if err != nil {
+		return err
+	}
+	p.Name = name
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	p.Parent, err = s.parent(p.Parent)
+	if err != nil {
+		return err
+	}
+	siblings, err := s.Children(p.Parent)
+	if err != nil {
+		return err
+	}
+	p.Order = len(siblings)
+	if len(siblings) > 0 {
+		p.Order = siblings[len(siblings)-1].Order + 1
+	}
+	err = os.MkdirAll(s.Dir, 0775)
+	if err != nil {
+		return err
+	}
+	// creating the directory is what reserves the name.
+	err = os.Mkdir(s.path(p.Name), 0775)
+	if os.IsExist(err) {
+		return fmt.Errorf("%w: %v", ErrExists, p.Name)
+	}
+	if err != nil {
+		return err
+	}
+	p.Created = currentTime()
+	p.Revision = 0
+	return s.write(p, c)
+}
+
+// Update changes the body of an existing page, adding a revision.
+func (s *Store) Update(p Page, c Change) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	current, err := s.Get(p.Name)
+	if err != nil {
+		return err
+	}
+	if current.Revision == 0 {
+		// saved before revisions existed, the current body becomes the
+		// first one.
+		err = s.writeRevision(current.Name, Revision{
+			Number: 1,
+			Author: current.Author,
+			Time:   current.Updated,
+			Body:   current.Body,
+		})
+		if err != nil {
+			return err
+		}
+		current.Revision = 1
+	}
+	current.Body = p.Body
+	return s.write(current, c)
+}
+
+// write saves p as a new revision made by c.
+// The page metadata is written last, so that the new revision is there
+// only when everything has been saved.
+func (s *Store) write(p Page, c Change) error {
+	p.Revision++
+	p.Author = c.Author
+	p.Updated = currentTime()
+	err := s.writeRevision(p.Name, Revision{
+		Number:  p.Revision,
+		Author:  c.Author,
+		Message: c.Message,
+		Time:    p.Updated,
+		Body:    p.Body,
+	})
+	if err != nil {
+		return err
+	}
+	err = utils.WriteFileAtomic(filepath.Join(s.path(p.Name), contentName), []byte(p.Body))
+	if err != nil {
+		return err
+	}
+	return s.writeMeta(p)
+}
+
+// writeMeta saves the metadata of p.
+func (s *Store) writeMeta(p Page) error {
+	meta, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(s.path(p.Name), metaName), meta)
+}
+
+// Get returns a page by name.
+func (s *Store) Get(name string) (Page, error) {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return Page{}, err
+	}
+	var p Page
+	meta, err := ioutil.ReadFile(filepath.Join(s.path(name), metaName))
+	if os.IsNotExist(err) {
+		return Page{}, fmt.Errorf("%w: %v", ErrNotFound, name)
+	}
+	if err != nil {
+		return Page{}, err
+	}
+	err = json.Unmarshal(meta, &p)
+	if err != nil {
+		return Page{}, err
+	}
+	body, err := ioutil.ReadFile(filepath.Join(s.path(name), contentName))
+	if err != nil {
+		return Page{}, err
+	}
+	p.Body = string(body)
+	return p, nil
+}
+
+// All returns all the pages sorted by name.
+func (s *Store) All() ([]Page, error) {
+	infos, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return []Page{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ps := make([]Page, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		p, err := s.Get(info.Name())
+		if errors.Is(err, ErrNotFound) {
+			// a page being created.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i].Name < ps[j].Name
+	})
+	return ps, nil
+}
+
+// Delete deletes a page by name, its children are moved to its parent.
+// Deleting a page that does not exist is not an error.
+func (s *Store) Delete(name string) error {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	p, err := s.Get(name)
+	if errors.Is(err, ErrNotFound) {
+		return os.RemoveAll(s.path(name))
+	}
+	if err != nil {
+		return err
+	}
+	children, err := s.Children(p.Name)
+	if err != nil {
+		return err
+	}
+	siblings, err := s.Children(p.Parent)
+	if err != nil {
+		return err
+	}
+	order := 0
+	if len(siblings) > 0 {
+		order = siblings[len(siblings)-1].Order + 1
+	}
+	for i, child := range children {
+		child.Parent = p.Parent
+		child.Order = order + i
+		err = s.writeMeta(child)
+		if err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(s.path(p.Name))
+}
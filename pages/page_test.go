@@ -0,0 +1,130 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package pages
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/scompo/data-management/utils"
+)
+
+var testTime = time.Now()
+
+func setup(t *testing.T) *Store {
+	currentTime = func() time.Time {
+		return testTime
+	}
+	t.Cleanup(func() {
+		currentTime = time.Now
+	})
+	return NewStore(t.TempDir())
+}
+
+func TestCreate(t *testing.T) {
+	s := setup(t)
+
+	p := Page{Name: "home", Body: "# Home\n"}
+	if err := s.Create(p, Change{}); err != nil {
+		t.Errorf("Error creating: %v\n", err)
+	}
+	saved, err := s.Get(p.Name)
+	if err != nil {
+		t.Errorf("Error getting: %v\n", err)
+	}
+	if saved.Body != p.Body {
+		t.Errorf("Expected body \"%v\", but was \"%v\"", p.Body, saved.Body)
+	}
+	if !testTime.Equal(saved.Created) || !testTime.Equal(saved.Updated) {
+		t.Errorf("Dates should be \"%v\", but were \"%v\" and \"%v\"", testTime, saved.Created, saved.Updated)
+	}
+	if err := s.Create(p, Change{}); !errors.Is(err, ErrExists) {
+		t.Errorf("no error for page name already existent: %v\n", err)
+	}
+	var verr *utils.ValidationError
+	if err := s.Create(Page{Name: "../escape"}, Change{}); !errors.As(err, &verr) {
+		t.Errorf("Expected validation error: %v\n", err)
+	}
+	if _, err := s.Get("not existent"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for page not existent: %v\n", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	s := setup(t)
+
+	if err := s.Create(Page{Name: "home", Body: "old"}, Change{}); err != nil {
+		t.Fatalf("Error creating: %v\n", err)
+	}
+	later := testTime.Add(time.Hour)
+	currentTime = func() time.Time {
+		return later
+	}
+	if err := s.Update(Page{Name: "home", Body: "new"}, Change{Author: "mauro"}); err != nil {
+		t.Errorf("Error updating: %v\n", err)
+	}
+	p, _ := s.Get("home")
+	if p.Body != "new" || !later.Equal(p.Updated) || !testTime.Equal(p.Created) ||
+		p.Revision != 2 || p.Author != "mauro" {
+		t.Errorf("not updated correctly: %+v\n", p)
+	}
+	if err := s.Update(Page{Name: "not existent"}, Change{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for page not existent: %v\n", err)
+	}
+}
+
+func TestAllDelete(t *testing.T) {
+	s := setup(t)
+
+	ps, err := s.All()
+	if err != nil || len(ps) != 0 {
+		t.Errorf("Nothing should be saved, but found %v pages, %v", len(ps), err)
+	}
+	for _, name := range []string{"b", "a", "c"} {
+		if err := s.Create(Page{Name: name, Body: name}, Change{}); err != nil {
+			t.Fatalf("Error creating: %v\n", err)
+		}
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Errorf("Error deleting: %v\n", err)
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Errorf("should not error if page not existent: %v\n", err)
+	}
+	ps, err = s.All()
+	if err != nil {
+		t.Errorf("Error listing: %v\n", err)
+	}
+	if len(ps) != 2 || ps[0].Name != "a" || ps[1].Name != "c" || ps[0].Body != "a" {
+		t.Errorf("Expected pages a and c, but found %+v", ps)
+	}
+}
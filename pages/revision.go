@@ -0,0 +1,138 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package pages
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scompo/data-management/utils"
+)
+
+var revisionsName = "revisions"
+
+// Revision is a saved version of a page.
+type Revision struct {
+	Number  int
+	Author  string
+	Message string
+	Time    time.Time
+	Body    string
+}
+
+func (s *Store) revisionPath(name string, n int) string {
+	return filepath.Join(s.path(name), revisionsName, strconv.Itoa(n)+".json")
+}
+
+func (s *Store) writeRevision(name string, r Revision) error {
+	err := os.MkdirAll(filepath.Join(s.path(name), revisionsName), 0775)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.revisionPath(name, r.Number), data)
+}
+
+// Revision returns the revision n of a page.
+func (s *Store) Revision(name string, n int) (Revision, error) {
+	p, err := s.Get(name)
+	if err != nil {
+		return Revision{}, err
+	}
+	if n < 1 || n > p.Revision {
+		return Revision{}, fmt.Errorf("%w: %v revision %v", ErrNotFound, p.Name, n)
+	}
+	data, err := ioutil.ReadFile(s.revisionPath(p.Name, n))
+	if err != nil {
+		return Revision{}, err
+	}
+	var r Revision
+	err = json.Unmarshal(data, &r)
+	return r, err
+}
+
+// Revisions returns all the revisions of a page, the newest first.
+// The bodies are left out, use Revision to get them.
+func (s *Store) Revisions(name string) ([]Revision, error) {
+	p, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(filepath.Join(s.path(p.Name), revisionsName))
+	if os.IsNotExist(err) {
+		return []Revision{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rs := make([]Revision, 0, len(infos))
+	for _, info := range infos {
+		n, err := strconv.Atoi(strings.TrimSuffix(info.Name(), ".json"))
+		if err != nil || n > p.Revision {
+			// not a revision, or one being written.
+			continue
+		}
+		r, err := s.Revision(p.Name, n)
+		if err != nil {
+			return nil, err
+		}
+		r.Body = ""
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Number > rs[j].Number
+	})
+	return rs, nil
+}
+
+// Restore makes the body of the revision n of a page the current one,
+// adding a new revision: the history is never rewritten.
+// If c has no message one saying what was restored is used.
+func (s *Store) Restore(name string, n int, c Change) error {
+	r, err := s.Revision(name, n)
+	if err != nil {
+		return err
+	}
+	if c.Message == "" {
+		c.Message = "Restored revision " + strconv.Itoa(n)
+	}
+	return s.Update(Page{Name: name, Body: r.Body}, c)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package pages
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRevisions(t *testing.T) {
+	s := setup(t)
+
+	if err := s.Create(Page{Name: "home", Body: "one"}, Change{Author: "a", Message: "first"}); err != nil {
+		t.Fatalf("Error creating: %v\n", err)
+	}
+	if err := s.Update(Page{Name: "home", Body: "two"}, Change{Author: "b", Message: "second"}); err != nil {
+		t.Fatalf("Error updating: %v\n", err)
+	}
+	rs, err := s.Revisions("home")
+	if err != nil {
+		t.Fatalf("Error listing revisions: %v\n", err)
+	}
+	if len(rs) != 2 || rs[0].Number != 2 || rs[1].Number != 1 {
+		t.Fatalf("Expected revisions 2 and 1, but found %+v", rs)
+	}
+	if rs[0].Author != "b" || rs[0].Message != "second" || rs[0].Body != "" {
+		t.Errorf("wrong revision listed: %+v", rs[0])
+	}
+	r, err := s.Revision("home", 1)
+	if err != nil || r.Body != "one" || r.Author != "a" {
+		t.Errorf("wrong revision 1: %+v, %v", r, err)
+	}
+	if _, err := s.Revision("home", 3); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for revision not existent: %v\n", err)
+	}
+	if _, err := s.Revisions("not existent"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for page not existent: %v\n", err)
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	s := setup(t)
+
+	if err := s.Create(Page{Name: "home", Body: "zero"}, Change{}); err != nil {
+		t.Fatalf("Error creating: %v\n", err)
+	}
+	// every store on the same directory acts like another process would.
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(other *Store) {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				if err := other.Update(Page{Name: "home", Body: "text"}, Change{}); err != nil {
+					t.Errorf("Error updating: %v\n", err)
+				}
+			}
+		}(&Store{Dir: s.Dir})
+	}
+	wg.Wait()
+	rs, err := s.Revisions("home")
+	if err != nil || len(rs) != 41 || rs[0].Number != 41 {
+		t.Errorf("Expected 41 revisions, but found %v: %v", len(rs), err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	s := setup(t)
+
+	s.Create(Page{Name: "home", Body: "one"}, Change{})
+	s.Update(Page{Name: "home", Body: "two"}, Change{})
+	if err := s.Restore("home", 1, Change{Author: "c"}); err != nil {
+		t.Fatalf("Error restoring: %v\n", err)
+	}
+	p, _ := s.Get("home")
+	if p.Body != "one" || p.Revision != 3 {
+		t.Errorf("not restored: %+v", p)
+	}
+	r, _ := s.Revision("home", 3)
+	if r.Message != "Restored revision 1" || r.Author != "c" {
+		t.Errorf("wrong restore revision: %+v", r)
+	}
+	if err := s.Restore("home", 7, Change{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for revision not existent: %v\n", err)
+	}
+}
+
+func TestRevisionsLegacyPage(t *testing.T) {
+	s := setup(t)
+
+	s.Create(Page{Name: "old", Body: "before"}, Change{})
+	// pages saved before revisions have none.
+	meta, _ := json.Marshal(Page{Name: "old", Created: testTime, Updated: testTime})
+	if err := ioutil.WriteFile(filepath.Join(s.path("old"), metaName), meta, 0664); err != nil {
+		t.Fatalf("Error writing: %v\n", err)
+	}
+	if err := s.Update(Page{Name: "old", Body: "after"}, Change{}); err != nil {
+		t.Fatalf("Error updating: %v\n", err)
+	}
+	r, err := s.Revision("old", 1)
+	if err != nil || r.Body != "before" {
+		t.Errorf("the old body should be revision 1: %+v, %v", r, err)
+	}
+	p, _ := s.Get("old")
+	if p.Revision != 2 || p.Body != "after" {
+		t.Errorf("wrong page after update: %+v", p)
+	}
+}
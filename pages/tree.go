@@ -0,0 +1,204 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package pages
+
+import (
+	"errors"
+	"sort"
+)
+
+// Node is a page in the tree of the pages of a project.
+type Node struct {
+	Page     Page
+	Children []*Node
+}
+
+// sortSiblings sorts pages with the same parent by their order, then by
+// name.
+func sortSiblings(ps []Page) {
+	sort.SliceStable(ps, func(i, j int) bool {
+		if ps[i].Order != ps[j].Order {
+			return ps[i].Order < ps[j].Order
+		}
+		return ps[i].Name < ps[j].Name
+	})
+}
+
+// parent checks that the page name can be a parent and returns its
+// normalized name. The empty name is the top level.
+func (s *Store) parent(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	p, err := s.Get(name)
+	if errors.Is(err, ErrNotFound) {
+		return "", &ValidationError{Field: "Parent", Value: name, Reason: "not existent"}
+	}
+	return p.Name, err
+}
+
+// Children returns the pages whose parent is the page name, in order.
+// The empty name returns the top level pages.
+func (s *Store) Children(name string) ([]Page, error) {
+	ps, err := s.All()
+	if err != nil {
+		return nil, err
+	}
+	children := make([]Page, 0)
+	for _, p := range ps {
+		if p.Parent == name {
+			children = append(children, p)
+		}
+	}
+	sortSiblings(children)
+	return children, nil
+}
+
+// Tree returns the top level pages, with their children.
+// Pages whose parent is missing are at the top level.
+func (s *Store) Tree() ([]*Node, error) {
+	ps, err := s.All()
+	if err != nil {
+		return nil, err
+	}
+	sortSiblings(ps)
+	nodes := make(map[string]*Node, len(ps))
+	for _, p := range ps {
+		nodes[p.Name] = &Node{Page: p}
+	}
+	roots := make([]*Node, 0)
+	for _, p := range ps {
+		parent, ok := nodes[p.Parent]
+		if !ok || inside(nodes, p.Parent, p.Name) {
+			roots = append(roots, nodes[p.Name])
+			continue
+		}
+		parent.Children = append(parent.Children, nodes[p.Name])
+	}
+	return roots, nil
+}
+
+// inside reports if the page name is among the ancestors of the page
+// parent, following nodes.
+func inside(nodes map[string]*Node, parent, name string) bool {
+	for i := 0; parent != "" && i <= len(nodes); i++ {
+		if parent == name {
+			return true
+		}
+		n, ok := nodes[parent]
+		if !ok {
+			return false
+		}
+		parent = n.Page.Parent
+	}
+	return parent != ""
+}
+
+// Ancestors returns the pages containing the page name, from the top level
+// one to its parent.
+func (s *Store) Ancestors(name string) ([]Page, error) {
+	p, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	var ancestors []Page
+	seen := map[string]bool{p.Name: true}
+	for p.Parent != "" && !seen[p.Parent] {
+		seen[p.Parent] = true
+		p, err = s.Get(p.Parent)
+		if errors.Is(err, ErrNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ancestors = append([]Page{p}, ancestors...)
+	}
+	return ancestors, nil
+}
+
+// Move makes the page name a child of the page parent, at position among
+// its children, starting from 0. The empty parent is the top level.
+// A page can't be moved inside itself.
+func (s *Store) Move(name, parent string, position int) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	p, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	parent, err = s.parent(parent)
+	if err != nil {
+		return err
+	}
+	for ancestor := parent; ancestor != ""; {
+		if ancestor == p.Name {
+			return &ValidationError{Field: "Parent", Value: parent, Reason: "inside the page moved"}
+		}
+		a, err := s.Get(ancestor)
+		if err != nil {
+			return err
+		}
+		ancestor = a.Parent
+	}
+	siblings, err := s.Children(parent)
+	if err != nil {
+		return err
+	}
+	for i := range siblings {
+		if siblings[i].Name == p.Name {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if position < 0 {
+		position = 0
+	}
+	if position > len(siblings) {
+		position = len(siblings)
+	}
+	p.Parent = parent
+	siblings = append(siblings[:position], append([]Page{p}, siblings[position:]...)...)
+	for i, sibling := range siblings {
+		if sibling.Order == i && sibling.Name != p.Name {
+			continue
+		}
+		sibling.Order = i
+		err = s.writeMeta(sibling)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
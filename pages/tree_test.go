@@ -0,0 +1,143 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package pages
+
+import (
+	"errors"
+	"testing"
+)
+
+func names(ps []Page) []string {
+	ns := make([]string, len(ps))
+	for i, p := range ps {
+		ns[i] = p.Name
+	}
+	return ns
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTree(t *testing.T) {
+	s := setup(t)
+
+	for _, p := range []Page{
+		{Name: "root"},
+		{Name: "b", Parent: "root"},
+		{Name: "a", Parent: "root"},
+		{Name: "leaf", Parent: "a"},
+		{Name: "other"},
+	} {
+		if err := s.Create(p, Change{}); err != nil {
+			t.Fatalf("Error creating: %v\n", err)
+		}
+	}
+	var verr *ValidationError
+	if err := s.Create(Page{Name: "orphan", Parent: "missing"}, Change{}); !errors.As(err, &verr) {
+		t.Errorf("Expected validation error for missing parent: %v\n", err)
+	}
+	children, err := s.Children("root")
+	if err != nil || !equal(names(children), []string{"b", "a"}) {
+		t.Errorf("Expected children b and a, but found %v, %v", names(children), err)
+	}
+	tree, err := s.Tree()
+	if err != nil {
+		t.Fatalf("Error getting the tree: %v\n", err)
+	}
+	if len(tree) != 2 || tree[0].Page.Name != "root" || len(tree[0].Children) != 2 ||
+		tree[0].Children[1].Children[0].Page.Name != "leaf" {
+		t.Errorf("wrong tree: %+v", tree)
+	}
+	ancestors, err := s.Ancestors("leaf")
+	if err != nil || !equal(names(ancestors), []string{"root", "a"}) {
+		t.Errorf("Expected ancestors root and a, but found %v, %v", names(ancestors), err)
+	}
+}
+
+func TestMove(t *testing.T) {
+	s := setup(t)
+
+	for _, p := range []Page{{Name: "root"}, {Name: "a", Parent: "root"}, {Name: "b", Parent: "root"}, {Name: "c"}} {
+		s.Create(p, Change{})
+	}
+	if err := s.Move("b", "root", 0); err != nil {
+		t.Fatalf("Error moving: %v\n", err)
+	}
+	children, _ := s.Children("root")
+	if !equal(names(children), []string{"b", "a"}) {
+		t.Errorf("Expected children b and a, but found %v", names(children))
+	}
+	if err := s.Move("c", "a", 5); err != nil {
+		t.Fatalf("Error moving: %v\n", err)
+	}
+	children, _ = s.Children("a")
+	if !equal(names(children), []string{"c"}) {
+		t.Errorf("Expected children c, but found %v", names(children))
+	}
+	var verr *ValidationError
+	if err := s.Move("root", "c", 0); !errors.As(err, &verr) {
+		t.Errorf("Expected validation error moving inside itself: %v\n", err)
+	}
+	if err := s.Move("root", "root", 0); !errors.As(err, &verr) {
+		t.Errorf("Expected validation error moving inside itself: %v\n", err)
+	}
+	if err := s.Move("not existent", "", 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for page not existent: %v\n", err)
+	}
+	p, _ := s.Get("c")
+	if p.Body != "" || p.Revision != 1 {
+		t.Errorf("moving should not change the page: %+v", p)
+	}
+}
+
+func TestDeleteParent(t *testing.T) {
+	s := setup(t)
+
+	for _, p := range []Page{{Name: "top"}, {Name: "root"}, {Name: "a", Parent: "root"}, {Name: "b", Parent: "root"}} {
+		s.Create(p, Change{})
+	}
+	if err := s.Delete("root"); err != nil {
+		t.Fatalf("Error deleting: %v\n", err)
+	}
+	children, _ := s.Children("")
+	if !equal(names(children), []string{"top", "a", "b"}) {
+		t.Errorf("Expected top, a and b at the top, but found %v", names(children))
+	}
+}
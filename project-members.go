@@ -0,0 +1,226 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/users"
+	"github.com/scompo/data-management/utils"
+	"log"
+	"net/http"
+	"sort"
+)
+
+// authorize returns an error if the user making r can't do in prj what
+// role does. The projects the user can't see are not found, as if they
+// did not exist.
+func authorize(r *http.Request, prj projects.Project, role projects.Role) error {
+	have := prj.Role(currentUser(r))
+	if have.Can(role) {
+		return nil
+	}
+	if have == "" {
+		return fmt.Errorf("%w: %v", projects.ErrNotFound, prj.Name)
+	}
+	return utils.Forbidden(fmt.Errorf("this needs the role %v in the project %v, yours is %v", role, prj.Name, have))
+}
+
+// visibleProjects returns the projects the user making r can see.
+func (a *app) visibleProjects(r *http.Request) []projects.Project {
+	all := a.projects.All()
+	prjs := make([]projects.Project, 0, len(all))
+	for _, prj := range all {
+		if authorize(r, prj, projects.Viewer) == nil {
+			prjs = append(prjs, prj)
+		}
+	}
+	return prjs
+}
+
+// projectItem is a project shown in a list, with what the user can do.
+type projectItem struct {
+	Project projects.Project
+	Role    projects.Role
+	CanEdit bool
+	IsOwner bool
+}
+
+func newProjectItem(r *http.Request, prj projects.Project) projectItem {
+	role := prj.Role(currentUser(r))
+	return projectItem{
+		Project: prj,
+		Role:    role,
+		CanEdit: role.Can(projects.Editor),
+		IsOwner: role.Can(projects.Owner),
+	}
+}
+
+// ownedProject returns prj owned by the user making r, to create it.
+func ownedProject(r *http.Request, prj projects.Project) projects.Project {
+	prj.Members = []projects.Member{{User: currentUser(r), Role: projects.Owner}}
+	return prj
+}
+
+// memberRow is a member shown on the members page.
+type memberRow struct {
+	User string
+	Role projects.Role
+	// Deleted tells that the user does not exist anymore.
+	Deleted bool
+}
+
+// noRole is the role removing a member.
+const noRole = "none"
+
+// changeMember gives the user name the role in prj, or removes it if the
+// role is noRole.
+func (a *app) changeMember(prj projects.Project, name string, role projects.Role) error {
+	switch role {
+	case "":
+		return &projects.ValidationError{Field: "Members", Value: "", Reason: "unknown role"}
+	case noRole:
+		role = ""
+	default:
+		u, err := a.users.Get(name)
+		var verr *utils.ValidationError
+		if errors.Is(err, users.ErrNotFound) || errors.As(err, &verr) {
+			return &users.ValidationError{Field: "User", Value: name, Reason: "no such user"}
+		}
+		if err != nil {
+			return err
+		}
+		name = u.Name
+	}
+	return a.projects.SetMember(prj.ID, name, role)
+}
+
+// membersHandler shows the members of a project to its owners, who can
+// give a role to the User, or remove it with the Role "none".
+func (a *app) membersHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, err := a.pathProject(r, projects.Owner)
+	if err != nil {
+		return err
+	}
+	switch r.Method {
+	case "POST":
+		name := r.PostFormValue("User")
+		err = a.changeMember(prj, name, projects.Role(r.PostFormValue("Role")))
+		if errs, ok := formErrors(err); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return a.renderMembers(w, r, prj, name, errs)
+		}
+		if err != nil {
+			return err
+		}
+		prj, err = a.projects.ByID(prj.ID)
+		if err != nil {
+			return err
+		}
+		if authorize(r, prj, projects.Owner) != nil {
+			// the user is not an owner anymore.
+			http.Redirect(w, r, "/projects", http.StatusSeeOther)
+			return nil
+		}
+		http.Redirect(w, r, projectURL(prj)+"/members", http.StatusSeeOther)
+		return nil
+	case "GET":
+		return a.renderMembers(w, r, prj, "", nil)
+	default:
+		return utils.MethodNotAllowed(r.Method)
+	}
+}
+
+// renderMembers renders the members page of prj, name is the user being
+// added and errs the errors to show next to the fields.
+func (a *app) renderMembers(w http.ResponseWriter, r *http.Request, prj projects.Project, name string, errs map[string]string) error {
+	rows := make([]memberRow, len(prj.Members))
+	for i, m := range prj.Members {
+		_, err := a.users.Get(m.User)
+		if err != nil && !errors.Is(err, users.ErrNotFound) {
+			return err
+		}
+		rows[i] = memberRow{User: m.User, Role: m.Role, Deleted: err != nil}
+	}
+	us, err := a.users.All()
+	if err != nil {
+		return err
+	}
+	t, err := prepareAppTemplate(r, "templates/projects/members.html")
+	if err != nil {
+		return err
+	}
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage": WebPage{
+			Title:       appName,
+			PageName:    "Members",
+			Breadcrumbs: projectCrumbs(prj),
+		},
+		"Project": prj,
+		"Members": rows,
+		"Roles":   projects.Roles,
+		"NoRole":  noRole,
+		"Users":   us,
+		"Name":    name,
+		"Errors":  errs,
+	})
+}
+
+// claimProjects gives an owner to the projects saved before the roles
+// existed, that nobody could access otherwise: the first administrator, or
+// the first user if there are no administrators.
+func (a *app) claimProjects() error {
+	us, err := a.users.All()
+	if err != nil || len(us) == 0 {
+		return err
+	}
+	sort.SliceStable(us, func(i, j int) bool {
+		if us[i].Admin != us[j].Admin {
+			return us[i].Admin
+		}
+		return us[i].Created.Before(us[j].Created)
+	})
+	for _, prj := range a.projects.All() {
+		if len(prj.Members) > 0 {
+			continue
+		}
+		err = a.projects.SetMember(prj.ID, us[0].Name, projects.Owner)
+		if err != nil {
+			return err
+		}
+		log.Printf("The project %v is now owned by %v\n", prj.Name, us[0].Name)
+	}
+	return nil
+}
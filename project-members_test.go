@@ -0,0 +1,138 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"github.com/scompo/data-management/projects"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestProjectRoles(t *testing.T) {
+	a := newApp(projects.NewMemoryStore(), t.TempDir())
+	owner := loggedIn(t, a, "mauro")
+	member := loggedIn(t, a, "member")
+	other := loggedIn(t, a, "other")
+	serve := func(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := serve(owner, formRequest("/projects/new", url.Values{"Name": {"secret"}})); w.Code != http.StatusFound {
+		t.Fatalf("Error creating: %v", w.Code)
+	}
+	prj, err := a.projects.Get("secret")
+	if err != nil || prj.Role("mauro") != projects.Owner {
+		t.Fatalf("the creator should own the project: %+v, %v", prj, err)
+	}
+	path := "/projects/" + prj.ID
+	setRole := func(name string, role string) int {
+		return serve(owner, formRequest(path+"/members", url.Values{"User": {name}, "Role": {role}})).Code
+	}
+	if code := setRole("member", "viewer"); code != http.StatusSeeOther {
+		t.Errorf("Error adding the member: %v", code)
+	}
+	if code := setRole("nobody", "viewer"); code != http.StatusBadRequest {
+		t.Errorf("Expected bad request for a user not existent, got %v", code)
+	}
+	if code := setRole("mauro", noRole); code != http.StatusBadRequest {
+		t.Errorf("the last owner should not be removed, got %v", code)
+	}
+
+	if w := serve(member, httptest.NewRequest("GET", "/projects", nil)); !strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("the members should see the project in the list")
+	}
+	if w := serve(other, httptest.NewRequest("GET", "/projects", nil)); strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("the project should not be listed to the other users")
+	}
+	for _, c := range []struct {
+		h        http.Handler
+		r        *http.Request
+		expected int
+	}{
+		{member, httptest.NewRequest("GET", path, nil), http.StatusOK},
+		{other, httptest.NewRequest("GET", path, nil), http.StatusNotFound},
+		{other, httptest.NewRequest("GET", "/api/v1/projects/secret", nil), http.StatusNotFound},
+		{member, httptest.NewRequest("POST", "/api/v1/projects/secret", nil), http.StatusMethodNotAllowed},
+		{member, httptest.NewRequest("GET", "/pages/new?Project="+prj.ID, nil), http.StatusForbidden},
+		{member, formRequest(path+"/delete", url.Values{}), http.StatusForbidden},
+		{member, httptest.NewRequest("GET", path+"/members", nil), http.StatusForbidden},
+	} {
+		if w := serve(c.h, c.r); w.Code != c.expected {
+			t.Errorf("%v %v: expected %v, got %v", c.r.Method, c.r.URL, c.expected, w.Code)
+		}
+	}
+
+	if code := setRole("member", "editor"); code != http.StatusSeeOther {
+		t.Errorf("Error changing the role: %v", code)
+	}
+	if w := serve(member, httptest.NewRequest("GET", "/pages/new?Project="+prj.ID, nil)); w.Code != http.StatusOK {
+		t.Errorf("the editors should create pages, got %v", w.Code)
+	}
+	if w := serve(member, formRequest(path+"/delete", url.Values{})); w.Code != http.StatusForbidden {
+		t.Errorf("only the owners should delete the project, got %v", w.Code)
+	}
+	if w := serve(owner, formRequest(path+"/delete", url.Values{})); w.Code != http.StatusSeeOther {
+		t.Errorf("Error deleting: %v", w.Code)
+	}
+}
+
+func TestClaimProjects(t *testing.T) {
+	a := newApp(projects.NewMemoryStore(), t.TempDir())
+	if err := a.projects.Save(projects.Project{Name: "legacy"}); err != nil {
+		t.Fatalf("Error saving: %v\n", err)
+	}
+	if err := a.claimProjects(); err != nil {
+		t.Errorf("Error claiming without users: %v\n", err)
+	}
+	for _, name := range []string{"mauro", "other"} {
+		if _, err := a.users.Create(name, testPassword); err != nil {
+			t.Fatalf("Error creating the user: %v\n", err)
+		}
+	}
+	if err := a.users.SetAdmin("mauro", false); err != nil {
+		t.Fatalf("Error setting the administrator: %v\n", err)
+	}
+	if err := a.users.SetAdmin("other", true); err != nil {
+		t.Fatalf("Error setting the administrator: %v\n", err)
+	}
+	if err := a.claimProjects(); err != nil {
+		t.Errorf("Error claiming: %v\n", err)
+	}
+	prj, _ := a.projects.Get("legacy")
+	if prj.Role("other") != projects.Owner || prj.Role("mauro") != "" {
+		t.Errorf("the administrator should own the project: %+v", prj.Members)
+	}
+}
@@ -0,0 +1,357 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package projects
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/scompo/data-management/blobs"
+	"github.com/scompo/data-management/utils"
+)
+
+var prjIndexName = "projects.json"
+
+// prjBackupName is the last good copy of the index, kept to recover from
+// a corrupted one.
+var prjBackupName = prjIndexName + ".bak"
+
+// FileStore is a Store that keeps the projects index in a json file and
+// a directory for every project, named after its ID, all inside Dir.
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore returns a FileStore rooted in dir.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{Dir: dir}
+}
+
+// Path returns the base path for a project, given its ID.
+func (s *FileStore) Path(id string) string {
+	return filepath.Join(s.Dir, id)
+}
+
+// Save saves a Project.
+// Returns an error if something has gone wrong.
+func (s *FileStore) Save(p Project) error {
+	name, err := utils.NormalizeName(p.Name, reservedNames...)
+	if err != nil {
+		return err
+	}
+	p.Name = name
+	if len(p.Members) > 0 {
+		p.Members, err = checkMembers(p.Members)
+		if err != nil {
+			return err
+		}
+	}
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if s.Exists(p.Name) {
+		return existsError(p.Name)
+	}
+	p.ID, err = newID()
+	if err != nil {
+		return err
+	}
+	err = s.createProjectDir(p.ID)
+	if err != nil {
+		return err
+	}
+	p.CreationDate = currentTime()
+	return s.persist(p)
+}
+
+func (s *FileStore) persist(p Project) error {
+	projects, err := s.deserialize()
+	if err != nil {
+		return err
+	}
+	projects = append(projects, p)
+	return s.serialize(projects)
+}
+
+func (s *FileStore) deserialize() ([]Project, error) {
+	r, err := os.Open(filepath.Join(s.Dir, prjIndexName))
+	var data []Project
+	if err != nil {
+		if os.IsNotExist(err) {
+			return data, nil
+		}
+		return nil, err
+	}
+	defer r.Close()
+	dec := json.NewDecoder(r)
+	err = dec.Decode(&data)
+	return data, err
+}
+
+func (s *FileStore) serialize(prjs []Project) error {
+	data, err := json.Marshal(prjs)
+	if err != nil {
+		return err
+	}
+	index := filepath.Join(s.Dir, prjIndexName)
+	current, err := ioutil.ReadFile(index)
+	if err == nil && validIndex(current) {
+		err = utils.WriteFileAtomic(filepath.Join(s.Dir, prjBackupName), current)
+		if err != nil {
+			return err
+		}
+	}
+	return utils.WriteFileAtomic(index, append(data, '\n'))
+}
+
+func validIndex(data []byte) bool {
+	var prjs []Project
+	return json.Unmarshal(data, &prjs) == nil
+}
+
+// Recover checks the index and, if it's missing or corrupted, restores the
+// last good copy kept alongside it.
+// It's meant to be called on startup, before using the store.
+func (s *FileStore) Recover() error {
+	index := filepath.Join(s.Dir, prjIndexName)
+	data, err := ioutil.ReadFile(index)
+	if err == nil && validIndex(data) {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	backup, berr := ioutil.ReadFile(filepath.Join(s.Dir, prjBackupName))
+	if os.IsNotExist(berr) {
+		if os.IsNotExist(err) {
+			// nothing saved yet.
+			return nil
+		}
+		return errors.New("corrupted project index and no backup: " + index)
+	}
+	if berr != nil {
+		return berr
+	}
+	if !validIndex(backup) {
+		return errors.New("corrupted project index and backup: " + index)
+	}
+	return utils.WriteFileAtomic(index, backup)
+}
+
+// Migrate upgrades the index written by older versions: projects saved
+// before IDs existed get one, and their directory is renamed after it.
+// It's meant to be called on startup, before using the store.
+func (s *FileStore) Migrate() error {
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	ps, err := s.deserialize()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i := range ps {
+		if ps[i].ID == "" {
+			err = assignID(s.Dir, &ps[i])
+			if err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.serialize(ps)
+}
+
+func (s *FileStore) createProjectDir(id string) error {
+	return os.MkdirAll(s.Path(id), 0775)
+}
+
+// deleteProjectDir removes the directory of a project, and its references
+// to the blobs next to the projects.
+func (s *FileStore) deleteProjectDir(id string) error {
+	err := os.RemoveAll(s.Path(id))
+	if err != nil {
+		return err
+	}
+	return blobs.NewStore(s.Dir).ReleaseProject(id)
+}
+
+// Update changes the name and the description of the existing project
+// with the ID p.ID.
+// Projects saved with names no longer valid can be renamed too.
+func (s *FileStore) Update(p Project) error {
+	name, err := utils.NormalizeName(p.Name, reservedNames...)
+	if err != nil {
+		return err
+	}
+	p.Name = name
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	ps, err := s.deserialize()
+	if err != nil {
+		return err
+	}
+	ind := indexOfID(ps, p.ID)
+	if ind < 0 {
+		return ErrNotFound
+	}
+	if other := indexOf(ps, p.Name); other >= 0 && other != ind {
+		return existsError(p.Name)
+	}
+	ps[ind].Name = p.Name
+	ps[ind].Description = p.Description
+	return s.serialize(ps)
+}
+
+// SetMember changes the role of a user in an existing project.
+func (s *FileStore) SetMember(id, user string, role Role) error {
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	ps, err := s.deserialize()
+	if err != nil {
+		return err
+	}
+	ind := indexOfID(ps, id)
+	if ind < 0 {
+		return ErrNotFound
+	}
+	members, err := withMember(ps[ind].Members, user, role)
+	if err != nil {
+		return err
+	}
+	ps[ind].Members = members
+	return s.serialize(ps)
+}
+
+func indexOf(ps []Project, name string) int {
+	for i, p := range ps {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexOfID(ps []Project, id string) int {
+	for i, p := range ps {
+		if p.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Delete deletes a project by ID.
+// Projects saved with names no longer valid can be deleted too.
+func (s *FileStore) Delete(id string) error {
+	if !ValidID(id) {
+		return idError(id)
+	}
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	ps, err := s.deserialize()
+	if err != nil {
+		return err
+	}
+	ind := indexOfID(ps, id)
+	if ind < 0 {
+		return nil
+	}
+	ps = append(ps[:ind], ps[ind+1:]...)
+	err = s.serialize(ps)
+	if err != nil {
+		return err
+	}
+	return s.deleteProjectDir(id)
+}
+
+// All returns all the projects sorted by creation date.
+func (s *FileStore) All() []Project {
+	ps, err := s.deserialize()
+	if err != nil {
+		ps = make([]Project, 0)
+	} else {
+		sort.Stable(byCreationDate(ps))
+	}
+	return ps
+}
+
+// Get returns a project by name.
+func (s *FileStore) Get(name string) (Project, error) {
+	name, err := utils.NormalizeName(name, reservedNames...)
+	if err != nil {
+		return Project{}, err
+	}
+	for _, prj := range s.All() {
+		if prj.Name == name {
+			return prj, nil
+		}
+	}
+	return Project{}, ErrNotFound
+}
+
+// ByID returns a project by ID.
+func (s *FileStore) ByID(id string) (Project, error) {
+	if ValidID(id) {
+		for _, prj := range s.All() {
+			if prj.ID == id {
+				return prj, nil
+			}
+		}
+	}
+	return Project{}, ErrNotFound
+}
+
+// Exists checks if a project exists.
+func (s *FileStore) Exists(name string) bool {
+	_, err := s.Get(name)
+	return err == nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package projects
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStoreRecover(t *testing.T) {
+	setup(t)
+	s := NewFileStore(PrjDir)
+	if err := s.Recover(); err != nil {
+		t.Errorf("empty directory should not need recovery: %v\n", err)
+	}
+	for _, name := range []string{"first", "second"} {
+		if err := s.Save(Project{Name: name}); err != nil {
+			t.Fatalf("Error saving: %v\n", err)
+		}
+	}
+	if err := s.Recover(); err != nil {
+		t.Errorf("good index should not need recovery: %v\n", err)
+	}
+	index := filepath.Join(PrjDir, prjIndexName)
+	// simulate a write cut in half.
+	if err := ioutil.WriteFile(index, []byte(`[{"Name":"fir`), 0664); err != nil {
+		t.Fatalf("Error corrupting index: %v\n", err)
+	}
+	if err := s.Recover(); err != nil {
+		t.Errorf("Error recovering: %v\n", err)
+	}
+	if !s.Exists("first") {
+		t.Errorf("last good copy not restored")
+	}
+	if err := os.Remove(index); err != nil {
+		t.Fatalf("Error removing index: %v\n", err)
+	}
+	if err := s.Recover(); err != nil {
+		t.Errorf("Error recovering: %v\n", err)
+	}
+	if !s.Exists("first") {
+		t.Errorf("missing index not restored")
+	}
+	backup := filepath.Join(PrjDir, prjBackupName)
+	if err := ioutil.WriteFile(backup, []byte(`{`), 0664); err != nil {
+		t.Fatalf("Error corrupting backup: %v\n", err)
+	}
+	if err := ioutil.WriteFile(index, []byte(`{`), 0664); err != nil {
+		t.Fatalf("Error corrupting index: %v\n", err)
+	}
+	if err := s.Recover(); err == nil {
+		t.Errorf("expected error with nothing to recover from")
+	}
+	teardown(t)
+}
+
+func TestFileStoreNoTempFiles(t *testing.T) {
+	setup(t)
+	s := NewFileStore(PrjDir)
+	for _, name := range []string{"first", "second"} {
+		if err := s.Save(Project{Name: name}); err != nil {
+			t.Fatalf("Error saving: %v\n", err)
+		}
+	}
+	first, _ := s.Get("first")
+	if err := s.Delete(first.ID); err != nil {
+		t.Fatalf("Error deleting: %v\n", err)
+	}
+	files, err := filepath.Glob(filepath.Join(PrjDir, "*.tmp*"))
+	if err != nil || len(files) != 0 {
+		t.Errorf("temporary files left behind: %v\n", files)
+	}
+	teardown(t)
+}
@@ -0,0 +1,192 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package projects
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := newID()
+		if err != nil {
+			t.Fatalf("Error generating: %v\n", err)
+		}
+		if !ValidID(id) {
+			t.Errorf("not valid: \"%v\"", id)
+		}
+		if seen[id] {
+			t.Errorf("duplicated: \"%v\"", id)
+		}
+		seen[id] = true
+	}
+	for _, id := range []string{"", "..", "not-an-id", "0123456789abcdef0123456789abcdef0123"} {
+		if ValidID(id) {
+			t.Errorf("should not be valid: \"%v\"", id)
+		}
+	}
+}
+
+// writeLegacyProject creates a project the way it was saved before IDs
+// existed: no ID in the index and a directory named after it.
+func writeLegacyProject(t *testing.T, name string) {
+	err := os.MkdirAll(filepath.Join(PrjDir, name), 0775)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(PrjDir, name, "content"), []byte(name), 0664)
+	}
+	if err != nil {
+		t.Fatalf("Error creating legacy project: %v\n", err)
+	}
+}
+
+// checkMigrated checks that a legacy project got an ID and its directory.
+func checkMigrated(t *testing.T, s Store, path func(string) string, name string) {
+	p, err := s.Get(name)
+	if err != nil {
+		t.Fatalf("Error getting: %v\n", err)
+	}
+	if !ValidID(p.ID) {
+		t.Errorf("ID not assigned: \"%v\"", p.ID)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(path(p.ID), "content"))
+	if err != nil || string(data) != name {
+		t.Errorf("directory not moved: %v\n", err)
+	}
+}
+
+func TestFileStoreMigrate(t *testing.T) {
+	setup(t)
+	writeLegacyProject(t, "legacy")
+	// a legacy name pointing to a directory outside, that must stay there.
+	outside, err := ioutil.TempDir("", "outside")
+	if err != nil {
+		t.Fatalf("error setting test directory")
+	}
+	defer os.RemoveAll(outside)
+	unsafe := "../" + filepath.Base(outside)
+	index := `[{"Name":"legacy","Description":"old"},{"Name":"no-dir"},{"Name":"` + unsafe + `"}]`
+	err = ioutil.WriteFile(filepath.Join(PrjDir, prjIndexName), []byte(index), 0664)
+	if err != nil {
+		t.Fatalf("Error writing index: %v\n", err)
+	}
+	s := NewFileStore(PrjDir)
+	if err := s.Migrate(); err != nil {
+		t.Fatalf("Error migrating: %v\n", err)
+	}
+	checkMigrated(t, s, s.Path, "legacy")
+	p, _ := s.Get("no-dir")
+	if !ValidID(p.ID) {
+		t.Errorf("ID not assigned: \"%v\"", p.ID)
+	}
+	if err := s.Migrate(); err != nil {
+		t.Errorf("Error migrating twice: %v\n", err)
+	}
+	if again, _ := s.Get("no-dir"); again.ID != p.ID {
+		t.Errorf("ID changed by the second migration")
+	}
+	var legacy Project
+	for _, other := range s.All() {
+		if other.Name == unsafe {
+			legacy = other
+		}
+	}
+	if !ValidID(legacy.ID) {
+		t.Errorf("ID not assigned to an unsafe name: \"%v\"", legacy.ID)
+	}
+	// the names no longer valid can be changed, or deleted, by ID.
+	if err := s.Update(Project{ID: legacy.ID, Name: "recovered"}); err != nil {
+		t.Errorf("Error renaming the unsafe name: %v\n", err)
+	}
+	if p, err := s.Get("recovered"); err != nil || p.ID != legacy.ID {
+		t.Errorf("unsafe name not renamed: %+v, %v\n", p, err)
+	}
+	if err := s.Delete(legacy.ID); err != nil || s.Exists("recovered") {
+		t.Errorf("Error deleting the renamed project: %v\n", err)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("the directory outside was moved: %v\n", err)
+	}
+	teardown(t)
+}
+
+func TestSQLStoreMigrate(t *testing.T) {
+	setup(t)
+	writeLegacyProject(t, "legacy")
+	// a database created before IDs existed.
+	db, err := sql.Open("sqlite", filepath.Join(PrjDir, prjDBName))
+	if err != nil {
+		t.Fatalf("Error opening: %v\n", err)
+	}
+	tx, err := db.Begin()
+	if err == nil {
+		err = migrations[0](tx, PrjDir)
+	}
+	if err == nil {
+		_, err = tx.Exec(`INSERT INTO projects (name, creation_date) VALUES ('legacy', '2016-01-01T00:00:00Z');
+			PRAGMA user_version = 1`)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	db.Close()
+	if err != nil {
+		t.Fatalf("Error creating legacy database: %v\n", err)
+	}
+	s, err := OpenSQLStore(PrjDir)
+	if err != nil {
+		t.Fatalf("Error migrating: %v\n", err)
+	}
+	checkMigrated(t, s, s.Path, "legacy")
+	s.Close()
+	teardown(t)
+}
+
+func TestSQLStoreImportLegacy(t *testing.T) {
+	setup(t)
+	writeLegacyProject(t, "legacy")
+	index := `[{"Name":"legacy","Description":"old"}]`
+	err := ioutil.WriteFile(filepath.Join(PrjDir, prjIndexName), []byte(index), 0664)
+	if err != nil {
+		t.Fatalf("Error writing index: %v\n", err)
+	}
+	s, err := OpenSQLStore(PrjDir)
+	if err != nil {
+		t.Fatalf("Error opening: %v\n", err)
+	}
+	checkMigrated(t, s, s.Path, "legacy")
+	s.Close()
+	teardown(t)
+}
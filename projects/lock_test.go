@@ -0,0 +1,129 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package projects
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+const workers = 8
+
+// hammer saves and deletes projects, and adds members to a shared one, from
+// a goroutine for every store.
+// When the stores are different instances on the same directory they act
+// like separate processes would.
+func hammer(t *testing.T, stores []Store) {
+	const perWorker = 10
+	if err := stores[0].Save(Project{Name: "members", Members: []Member{{User: "owner", Role: Owner}}}); err != nil {
+		t.Fatalf("Error saving: %v\n", err)
+	}
+	members, _ := stores[0].Get("members")
+	var wg sync.WaitGroup
+	for w, s := range stores {
+		wg.Add(1)
+		go func(w int, s Store) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				name := fmt.Sprintf("p-%v-%v", w, i)
+				if err := s.Save(Project{Name: name}); err != nil {
+					t.Errorf("Error saving %v: %v\n", name, err)
+				}
+				// everybody tries to create the same one too.
+				s.Save(Project{Name: "shared"})
+				user := fmt.Sprintf("u-%v-%v", w, i)
+				if err := s.SetMember(members.ID, user, Viewer); err != nil {
+					t.Errorf("Error adding %v: %v\n", user, err)
+				}
+				if i%2 == 0 {
+					p, _ := s.Get(name)
+					if err := s.Delete(p.ID); err != nil {
+						t.Errorf("Error deleting %v: %v\n", name, err)
+					}
+				}
+			}
+		}(w, s)
+	}
+	wg.Wait()
+	res := stores[0].All()
+	expected := len(stores)*perWorker/2 + 2
+	if len(res) != expected {
+		t.Errorf("Expected %v projects, but found %v", expected, len(res))
+	}
+	members, _ = stores[0].Get("members")
+	if len(members.Members) != len(stores)*perWorker+1 {
+		t.Errorf("Expected %v members, but found %v", len(stores)*perWorker+1, len(members.Members))
+	}
+	seen := make(map[string]bool)
+	for _, p := range res {
+		if seen[p.Name] {
+			t.Errorf("duplicated project %v", p.Name)
+		}
+		seen[p.Name] = true
+	}
+}
+
+func TestFileStoreConcurrent(t *testing.T) {
+	setup(t)
+	var stores []Store
+	for i := 0; i < workers; i++ {
+		stores = append(stores, NewFileStore(PrjDir))
+	}
+	hammer(t, stores)
+	teardown(t)
+}
+
+func TestSQLStoreConcurrent(t *testing.T) {
+	setup(t)
+	var stores []Store
+	for i := 0; i < workers; i++ {
+		s, err := OpenSQLStore(PrjDir)
+		if err != nil {
+			t.Fatalf("Error opening: %v\n", err)
+		}
+		defer s.Close()
+		stores = append(stores, s)
+	}
+	hammer(t, stores)
+	teardown(t)
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	setup(t)
+	s := NewMemoryStore()
+	var stores []Store
+	for i := 0; i < workers; i++ {
+		stores = append(stores, s)
+	}
+	hammer(t, stores)
+	teardown(t)
+}
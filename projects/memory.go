@@ -0,0 +1,176 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package projects
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/scompo/data-management/utils"
+)
+
+// MemoryStore is a Store that keeps the projects in memory.
+// Nothing is written to disk, so it's useful for tests and throwaway
+// instances.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	projects []Project
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) index(name string) int {
+	return indexOf(s.projects, name)
+}
+
+// Save saves a Project.
+// Returns an error if something has gone wrong.
+func (s *MemoryStore) Save(p Project) error {
+	name, err := utils.NormalizeName(p.Name, reservedNames...)
+	if err != nil {
+		return err
+	}
+	p.Name = name
+	if len(p.Members) > 0 {
+		p.Members, err = checkMembers(p.Members)
+		if err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index(p.Name) >= 0 {
+		return existsError(p.Name)
+	}
+	p.ID, err = newID()
+	if err != nil {
+		return err
+	}
+	p.CreationDate = currentTime()
+	s.projects = append(s.projects, p)
+	return nil
+}
+
+// Update changes the name and the description of the existing project
+// with the ID p.ID.
+func (s *MemoryStore) Update(p Project) error {
+	name, err := utils.NormalizeName(p.Name, reservedNames...)
+	if err != nil {
+		return err
+	}
+	p.Name = name
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ind := indexOfID(s.projects, p.ID)
+	if ind < 0 {
+		return ErrNotFound
+	}
+	if other := s.index(p.Name); other >= 0 && other != ind {
+		return existsError(p.Name)
+	}
+	s.projects[ind].Name = p.Name
+	s.projects[ind].Description = p.Description
+	return nil
+}
+
+// SetMember changes the role of a user in an existing project.
+func (s *MemoryStore) SetMember(id, user string, role Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ind := indexOfID(s.projects, id)
+	if ind < 0 {
+		return ErrNotFound
+	}
+	members, err := withMember(s.projects[ind].Members, user, role)
+	if err != nil {
+		return err
+	}
+	s.projects[ind].Members = members
+	return nil
+}
+
+// Delete deletes a project by ID.
+func (s *MemoryStore) Delete(id string) error {
+	if !ValidID(id) {
+		return idError(id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ind := indexOfID(s.projects, id); ind >= 0 {
+		s.projects = append(s.projects[:ind], s.projects[ind+1:]...)
+	}
+	return nil
+}
+
+// All returns all the projects sorted by creation date.
+func (s *MemoryStore) All() []Project {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ps := make([]Project, len(s.projects))
+	copy(ps, s.projects)
+	sort.Stable(byCreationDate(ps))
+	return ps
+}
+
+// Get returns a project by name.
+func (s *MemoryStore) Get(name string) (Project, error) {
+	name, err := utils.NormalizeName(name, reservedNames...)
+	if err != nil {
+		return Project{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if ind := s.index(name); ind >= 0 {
+		return s.projects[ind], nil
+	}
+	return Project{}, ErrNotFound
+}
+
+// ByID returns a project by ID.
+func (s *MemoryStore) ByID(id string) (Project, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.projects {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return Project{}, ErrNotFound
+}
+
+// Exists checks if a project exists.
+func (s *MemoryStore) Exists(name string) bool {
+	_, err := s.Get(name)
+	return err == nil
+}
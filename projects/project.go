@@ -32,19 +32,16 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 package projects
 
 import (
-	"encoding/json"
 	"errors"
-	"os"
 	"path/filepath"
-	"sort"
 	"time"
 )
 
 // PrjDir is the directory where the projects are saved in.
+// It is used by the package level functions, which work on a FileStore
+// rooted in it.
 var PrjDir string
 
-var prjIndexName = "projects.json"
-
 type byCreationDate []Project
 
 func (p byCreationDate) Len() int {
@@ -60,130 +57,74 @@ func (p byCreationDate) Less(i, j int) bool {
 }
 
 // Project type definition
+// ID is assigned when the project is saved and never changes, the Name
+// and the Description can be changed with Update and the Members with
+// SetMember.
 type Project struct {
+	ID           string
 	Name         string
 	CreationDate time.Time
 	Description  string
+	Members      []Member `json:",omitempty"`
 }
 
 var currentTime = time.Now
 
+func defaultStore() *FileStore {
+	return NewFileStore(PrjDir)
+}
+
 // Save saves a Project.
 // Returns an error if something has gone wrong.
 func Save(p Project) error {
-	if Exists(p.Name) {
-		return errors.New("project name already existent: " + p.Name)
-	}
-	err := createProjectDir(p.Name)
-	if err != nil {
-		return err
-	}
-	p.CreationDate = currentTime()
-	persist(p)
-	return nil
+	return defaultStore().Save(p)
 }
 
-func persist(p Project) error {
-	projects, err := deserialize()
-	if err != nil {
-		return err
-	}
-	projects = append(projects, p)
-	return serialize(projects)
+// Update changes the name and the description of the existing project
+// with the ID p.ID.
+func Update(p Project) error {
+	return defaultStore().Update(p)
 }
 
-func deserialize() ([]Project, error) {
-	r, err := os.Open(filepath.Join(PrjDir, prjIndexName))
-	var data []Project
-	if err != nil {
-		if os.IsNotExist(err) {
-			return data, nil
-		}
-		return nil, err
-	}
-	dec := json.NewDecoder(r)
-	err = dec.Decode(&data)
-	return data, err
+// SetMember changes the role of a user in an existing project.
+func SetMember(id, user string, role Role) error {
+	return defaultStore().SetMember(id, user, role)
 }
 
-func serialize(prjs []Project) error {
-	w, err := os.Create(filepath.Join(PrjDir, prjIndexName))
-	if err != nil {
-		return err
-	}
-	enc := json.NewEncoder(w)
-	return enc.Encode(prjs)
-}
-
-// GetProjectPath returns the base path for a project.
-func GetProjectPath(name string) string {
-	return filepath.Join(PrjDir, name)
-}
-
-func createProjectDir(name string) error {
-	return os.MkdirAll(GetProjectPath(name), 0775)
-}
-
-func deleteProjectDir(name string) error {
-	return os.RemoveAll(GetProjectPath(name))
+// GetProjectPath returns the base path for a project, given its ID.
+func GetProjectPath(id string) string {
+	return filepath.Join(PrjDir, id)
 }
 
 // Delete deletes a project by name.
 func Delete(name string) error {
-	if Exists(name) {
-		ps, err := deserialize()
-		if err != nil {
-			return err
-		}
-		ind := -1
-		for i, v := range ps {
-			if v.Name == name {
-				ind = i
-				break
-			}
-		}
-		ps = append(ps[:ind], ps[ind+1:]...)
-		err = serialize(ps)
-		if err != nil {
-			return err
-		}
-		return deleteProjectDir(name)
+	s := defaultStore()
+	p, err := s.Get(name)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
 	}
-	return nil
+	return s.Delete(p.ID)
 }
 
 // All returns all the projects sorted by creation date.
 func All() []Project {
-	ps, err := deserialize()
-	if err != nil {
-		ps = make([]Project, 0)
-	} else {
-		sort.Sort(byCreationDate(ps))
-	}
-	return ps
+	return defaultStore().All()
 }
 
 // Get returns a project by name.
 func Get(name string) (Project, error) {
-	if !Exists(name) {
-		return Project{}, errors.New("not present")
-	}
-	prjs := All()
-	for _, prj := range prjs {
-		if prj.Name == name {
-			return prj, nil
-		}
-	}
-	return Project{}, errors.New("should not get here")
+	return defaultStore().Get(name)
+}
+
+// ByID returns a project by ID.
+func ByID(id string) (Project, error) {
+	return defaultStore().ByID(id)
 }
 
 // Exists checks if a project exists.
 func Exists(name string) bool {
-	prjs := All()
-	for _, prj := range prjs {
-		if prj.Name == name {
-			return true
-		}
-	}
-	return false
+	return defaultStore().Exists(name)
 }
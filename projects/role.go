@@ -0,0 +1,129 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package projects
+
+import (
+	"sort"
+)
+
+// Role is what a member can do in a project.
+type Role string
+
+const (
+	// Viewer sees the content of the project.
+	Viewer Role = "viewer"
+	// Editor changes the content of the project too.
+	Editor Role = "editor"
+	// Owner manages the project itself too: its name, its members and
+	// its deletion.
+	Owner Role = "owner"
+)
+
+// Roles are the roles, from the one that can do less to the one that can
+// do more.
+var Roles = []Role{Viewer, Editor, Owner}
+
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Can reports if the role r can do what the role required can.
+func (r Role) Can(required Role) bool {
+	return r.rank() > 0 && r.rank() >= required.rank()
+}
+
+// Member is a user with a role in a project.
+type Member struct {
+	User string
+	Role Role
+}
+
+// Role returns the role of the user name in p, empty if not a member.
+// Nobody can access the projects without members.
+func (p Project) Role(name string) Role {
+	for _, m := range p.Members {
+		if m.User == name {
+			return m.Role
+		}
+	}
+	return ""
+}
+
+// withMember returns the members after giving the user the role, or
+// removing the user if the role is empty, checked as by checkMembers.
+func withMember(members []Member, user string, role Role) ([]Member, error) {
+	if user == "" {
+		return nil, &ValidationError{Field: "Members", Value: user, Reason: "the user can't be empty"}
+	}
+	changed := make([]Member, 0, len(members)+1)
+	for _, m := range members {
+		if m.User != user {
+			changed = append(changed, m)
+		}
+	}
+	if role != "" {
+		changed = append(changed, Member{User: user, Role: role})
+	}
+	return checkMembers(changed)
+}
+
+// checkMembers returns the members sorted by user, checking that every user
+// has a known role only once and that someone owns the project.
+func checkMembers(members []Member) ([]Member, error) {
+	invalid := func(value, reason string) ([]Member, error) {
+		return nil, &ValidationError{Field: "Members", Value: value, Reason: reason}
+	}
+	sorted := append([]Member(nil), members...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].User < sorted[j].User
+	})
+	owned := false
+	for i, m := range sorted {
+		switch {
+		case m.User == "":
+			return invalid(m.User, "the user can't be empty")
+		case m.Role.rank() == 0:
+			return invalid(string(m.Role), "unknown role")
+		case i > 0 && sorted[i-1].User == m.User:
+			return invalid(m.User, "member more than once")
+		}
+		owned = owned || m.Role == Owner
+	}
+	if !owned {
+		return invalid("", "the project needs an owner")
+	}
+	return sorted, nil
+}
@@ -0,0 +1,514 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package projects
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/scompo/data-management/blobs"
+	"github.com/scompo/data-management/utils"
+	// pure go sqlite driver, registered as "sqlite".
+	_ "modernc.org/sqlite"
+)
+
+var prjDBName = "projects.db"
+
+// migration changes the database schema in tx, dir is where the store keeps
+// the projects directories.
+type migration func(tx *sql.Tx, dir string) error
+
+func execMigration(query string) migration {
+	return func(tx *sql.Tx, dir string) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// migrations are applied in order, the database user_version records how
+// many of them have been already applied.
+var migrations = []migration{
+	execMigration(`CREATE TABLE projects (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		creation_date TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT ''
+	);
+	CREATE UNIQUE INDEX projects_name ON projects(name);`),
+	addProjectIDs,
+	execMigration(`CREATE TABLE project_members (
+		project_id TEXT NOT NULL,
+		user_name TEXT NOT NULL,
+		role TEXT NOT NULL,
+		PRIMARY KEY (project_id, user_name)
+	);`),
+}
+
+// addProjectIDs gives an ID to the projects saved before IDs existed.
+func addProjectIDs(tx *sql.Tx, dir string) error {
+	_, err := tx.Exec("ALTER TABLE projects ADD COLUMN project_id TEXT")
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query("SELECT name FROM projects")
+	if err != nil {
+		return err
+	}
+	var ps []Project
+	for rows.Next() {
+		var p Project
+		err = rows.Scan(&p.Name)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		ps = append(ps, p)
+	}
+	rows.Close()
+	for _, p := range ps {
+		err = assignID(dir, &p)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE projects SET project_id = ? WHERE name = ?", p.ID, p.Name)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("CREATE UNIQUE INDEX projects_project_id ON projects(project_id)")
+	return err
+}
+
+// SQLStore is a Store that keeps the projects metadata in an embedded
+// sqlite database, and a directory for every project, named after its ID,
+// all inside Dir.
+type SQLStore struct {
+	Dir string
+	db  *sql.DB
+}
+
+// OpenSQLStore opens the database inside dir, creating it if needed.
+// On first start an existing projects.json index is imported in the
+// database and renamed to projects.json.imported.
+func OpenSQLStore(dir string) (*SQLStore, error) {
+	// other processes may be writing to the same database.
+	dsn := filepath.Join(dir, prjDBName) + "?_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLStore{Dir: dir, db: db}
+	err = s.migrate()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the underlying database.
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLStore) migrate() error {
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	var version int
+	err = s.db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+	if version == len(migrations) {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, m := range migrations[version:] {
+		err = m(tx, s.Dir)
+		if err != nil {
+			return err
+		}
+	}
+	imported := false
+	if version == 0 {
+		imported, err = importIndex(tx, s.Dir)
+		if err != nil {
+			return err
+		}
+	}
+	// PRAGMA does not support placeholders.
+	_, err = tx.Exec("PRAGMA user_version = " + strconv.Itoa(len(migrations)))
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil || !imported {
+		return err
+	}
+	// the json index is moved out of the way once it's in the database,
+	// so that it's not mistaken for live data.
+	path := filepath.Join(s.Dir, prjIndexName)
+	return os.Rename(path, path+".imported")
+}
+
+// importIndex copies the projects from the json index in dir into the
+// database, giving an ID to the ones without.
+// Returns true if there was an index to import.
+func importIndex(tx *sql.Tx, dir string) (bool, error) {
+	r, err := os.Open(filepath.Join(dir, prjIndexName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer r.Close()
+	var prjs []Project
+	err = json.NewDecoder(r).Decode(&prjs)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range prjs {
+		if p.ID == "" {
+			err = assignID(dir, &p)
+			if err != nil {
+				return false, err
+			}
+		}
+		err = insert(tx, p)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insert(db execer, p Project) error {
+	_, err := db.Exec(
+		"INSERT INTO projects (project_id, name, creation_date, description) VALUES (?, ?, ?, ?)",
+		p.ID, p.Name, p.CreationDate.Format(time.RFC3339Nano), p.Description)
+	if err != nil {
+		return err
+	}
+	return insertMembers(db, p.ID, p.Members)
+}
+
+func insertMembers(db execer, id string, members []Member) error {
+	for _, m := range members {
+		_, err := db.Exec(
+			"INSERT INTO project_members (project_id, user_name, role) VALUES (?, ?, ?)",
+			id, m.User, string(m.Role))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Path returns the base path for a project, given its ID.
+func (s *SQLStore) Path(id string) string {
+	return filepath.Join(s.Dir, id)
+}
+
+// Save saves a Project.
+// Returns an error if something has gone wrong.
+func (s *SQLStore) Save(p Project) error {
+	name, err := utils.NormalizeName(p.Name, reservedNames...)
+	if err != nil {
+		return err
+	}
+	p.Name = name
+	if len(p.Members) > 0 {
+		p.Members, err = checkMembers(p.Members)
+		if err != nil {
+			return err
+		}
+	}
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if s.Exists(p.Name) {
+		return existsError(p.Name)
+	}
+	p.ID, err = newID()
+	if err != nil {
+		return err
+	}
+	p.CreationDate = currentTime()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = insert(tx, p)
+	if err != nil {
+		return err
+	}
+	// the directory is made only for the projects inserted, and removed if
+	// the insert is not committed.
+	err = os.MkdirAll(s.Path(p.ID), 0775)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		os.RemoveAll(s.Path(p.ID))
+	}
+	return err
+}
+
+// Update changes the name and the description of the existing project
+// with the ID p.ID.
+// Projects saved with names no longer valid can be renamed too.
+func (s *SQLStore) Update(p Project) error {
+	name, err := utils.NormalizeName(p.Name, reservedNames...)
+	if err != nil {
+		return err
+	}
+	p.Name = name
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	_, err = s.ByID(p.ID)
+	if err != nil {
+		return err
+	}
+	if other, err := s.Get(p.Name); err == nil && other.ID != p.ID {
+		return existsError(p.Name)
+	}
+	_, err = s.db.Exec(
+		"UPDATE projects SET name = ?, description = ? WHERE project_id = ?", p.Name, p.Description, p.ID)
+	return err
+}
+
+// SetMember changes the role of a user in an existing project.
+func (s *SQLStore) SetMember(id, user string, role Role) error {
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	p, err := s.ByID(id)
+	if err != nil {
+		return err
+	}
+	members, err := withMember(p.Members, user, role)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("DELETE FROM project_members WHERE project_id = ?", id)
+	if err != nil {
+		return err
+	}
+	err = insertMembers(tx, id, members)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete deletes a project by ID.
+// Projects saved with names no longer valid can be deleted too.
+func (s *SQLStore) Delete(id string) error {
+	if !ValidID(id) {
+		return idError(id)
+	}
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	p, err := s.ByID(id)
+	if err != nil {
+		// nothing to delete.
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("DELETE FROM projects WHERE project_id = ?", p.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM project_members WHERE project_id = ?", p.ID)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(s.Path(p.ID))
+	if err != nil {
+		return err
+	}
+	return blobs.NewStore(s.Dir).ReleaseProject(p.ID)
+}
+
+// All returns all the projects sorted by creation date.
+func (s *SQLStore) All() []Project {
+	ps := make([]Project, 0)
+	rows, err := s.db.Query(
+		"SELECT project_id, name, creation_date, description FROM projects ORDER BY id")
+	if err != nil {
+		return ps
+	}
+	defer rows.Close()
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			return make([]Project, 0)
+		}
+		ps = append(ps, p)
+	}
+	if rows.Err() != nil {
+		return make([]Project, 0)
+	}
+	members, err := s.members("")
+	if err != nil {
+		return make([]Project, 0)
+	}
+	for i := range ps {
+		ps[i].Members = members[ps[i].ID]
+	}
+	sort.Stable(byCreationDate(ps))
+	return ps
+}
+
+// members returns the members of the project with the ID id, or of all
+// the projects if id is empty, by project ID.
+func (s *SQLStore) members(id string) (map[string][]Member, error) {
+	rows, err := s.db.Query(
+		"SELECT project_id, user_name, role FROM project_members WHERE ? = '' OR project_id = ? ORDER BY user_name",
+		id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := make(map[string][]Member)
+	for rows.Next() {
+		var prj string
+		var m Member
+		err = rows.Scan(&prj, &m.User, &m.Role)
+		if err != nil {
+			return nil, err
+		}
+		members[prj] = append(members[prj], m)
+	}
+	return members, rows.Err()
+}
+
+// withMembers returns p with its members.
+func (s *SQLStore) withMembers(p Project, err error) (Project, error) {
+	if err != nil {
+		return p, err
+	}
+	members, err := s.members(p.ID)
+	if err != nil {
+		return Project{}, err
+	}
+	p.Members = members[p.ID]
+	return p, nil
+}
+
+// Get returns a project by name.
+func (s *SQLStore) Get(name string) (Project, error) {
+	name, err := utils.NormalizeName(name, reservedNames...)
+	if err != nil {
+		return Project{}, err
+	}
+	row := s.db.QueryRow(
+		"SELECT project_id, name, creation_date, description FROM projects WHERE name = ?", name)
+	p, err := scanProject(row)
+	if err == sql.ErrNoRows {
+		return Project{}, ErrNotFound
+	}
+	return s.withMembers(p, err)
+}
+
+// ByID returns a project by ID.
+func (s *SQLStore) ByID(id string) (Project, error) {
+	row := s.db.QueryRow(
+		"SELECT project_id, name, creation_date, description FROM projects WHERE project_id = ?", id)
+	p, err := scanProject(row)
+	if err == sql.ErrNoRows {
+		return Project{}, ErrNotFound
+	}
+	return s.withMembers(p, err)
+}
+
+// Exists checks if a project exists.
+func (s *SQLStore) Exists(name string) bool {
+	_, err := s.Get(name)
+	return err == nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProject(row scanner) (Project, error) {
+	var p Project
+	var created string
+	err := row.Scan(&p.ID, &p.Name, &created, &p.Description)
+	if err != nil {
+		return Project{}, err
+	}
+	p.CreationDate, err = time.Parse(time.RFC3339Nano, created)
+	return p, err
+}
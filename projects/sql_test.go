@@ -0,0 +1,117 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package projects
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLStore(t *testing.T) {
+	setup(t)
+	s, err := OpenSQLStore(PrjDir)
+	if err != nil {
+		t.Fatalf("Error opening: %v\n", err)
+	}
+	testStore(t, s)
+	s.Close()
+	s, err = OpenSQLStore(PrjDir)
+	if err != nil {
+		t.Fatalf("Error reopening: %v\n", err)
+	}
+	if !s.Exists("testName2") {
+		t.Errorf("project not persisted across restarts")
+	}
+	testDirectories(t, s, s.Path)
+	testMembers(t, s)
+	s.Close()
+	teardown(t)
+}
+
+func TestSQLStoreFailedSave(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+	s, err := OpenSQLStore(PrjDir)
+	if err != nil {
+		t.Fatalf("Error opening: %v\n", err)
+	}
+	defer s.Close()
+	before, _ := ioutil.ReadDir(PrjDir)
+	_, err = s.db.Exec("CREATE TRIGGER fail BEFORE INSERT ON projects BEGIN SELECT RAISE(ABORT, 'fail'); END")
+	if err != nil {
+		t.Fatalf("Error creating the trigger: %v\n", err)
+	}
+	if err := s.Save(Project{Name: "failing"}); err == nil {
+		t.Errorf("Expected error saving")
+	}
+	if after, _ := ioutil.ReadDir(PrjDir); len(after) != len(before) {
+		t.Errorf("a failed save should not leave directories: %v, %v", len(before), len(after))
+	}
+}
+
+func TestSQLStoreImport(t *testing.T) {
+	setup(t)
+	err := Save(Project{Name: "old", Description: "from json"})
+	if err != nil {
+		t.Fatalf("Error saving: %v\n", err)
+	}
+	s, err := OpenSQLStore(PrjDir)
+	if err != nil {
+		t.Fatalf("Error opening: %v\n", err)
+	}
+	p, err := s.Get("old")
+	if err != nil {
+		t.Errorf("project not imported: %v\n", err)
+	}
+	if p.Description != "from json" || !testTime.Equal(p.CreationDate) {
+		t.Errorf("project imported wrongly: %+v\n", p)
+	}
+	if _, err := os.Stat(filepath.Join(PrjDir, prjIndexName)); !os.IsNotExist(err) {
+		t.Errorf("json index should have been moved: %v\n", err)
+	}
+	s.Close()
+	// a json index appearing later must not be imported again.
+	err = ioutil.WriteFile(filepath.Join(PrjDir, prjIndexName), []byte(`[{"Name":"new"}]`), 0664)
+	if err != nil {
+		t.Fatalf("Error writing index: %v\n", err)
+	}
+	s, err = OpenSQLStore(PrjDir)
+	if err != nil {
+		t.Fatalf("Error reopening: %v\n", err)
+	}
+	if s.Exists("new") {
+		t.Errorf("json index imported twice")
+	}
+	s.Close()
+	teardown(t)
+}
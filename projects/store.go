@@ -0,0 +1,76 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package projects
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when a project does not exist.
+var ErrNotFound = errors.New("project not found")
+
+// ErrExists is returned when a project name is already used.
+var ErrExists = errors.New("project name already existent")
+
+func existsError(name string) error {
+	return fmt.Errorf("%w: %v", ErrExists, name)
+}
+
+// idError is returned for the IDs that can't be of a project.
+func idError(id string) error {
+	return fmt.Errorf("%w: %v", ErrNotFound, id)
+}
+
+// Store is the interface implemented by the project storage backends.
+type Store interface {
+	// Save saves a new Project, giving it a new ID.
+	// Returns an error if a project with the same name already exists.
+	Save(p Project) error
+	// Update changes the name and the description of the existing project
+	// with the ID p.ID together: either both change or neither does.
+	Update(p Project) error
+	// SetMember gives the user the role in the existing project with the
+	// ID id, or removes the user if the role is empty: every user has a
+	// single role, and at least one is an owner.
+	SetMember(id, user string, role Role) error
+	// Delete deletes a project by ID.
+	// Deleting a project that does not exist is not an error.
+	Delete(id string) error
+	// All returns all the projects sorted by creation date.
+	All() []Project
+	// Get returns a project by name.
+	Get(name string) (Project, error)
+	// ByID returns a project by ID.
+	ByID(id string) (Project, error)
+	// Exists checks if a project exists.
+	Exists(name string) bool
+}
@@ -0,0 +1,250 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package projects
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scompo/data-management/blobs"
+)
+
+// testStore runs the behaviour every Store implementation must have.
+func testStore(t *testing.T, s Store) {
+	if res := s.All(); len(res) != 0 {
+		t.Errorf("Nothing should be saved, but found %v projects", len(res))
+	}
+	p := Project{
+		Name:        "testName",
+		Description: "test description",
+	}
+	p2 := Project{
+		Name:        "testName2",
+		Description: "test description2",
+	}
+	if err := s.Save(p); err != nil {
+		t.Errorf("Error saving: %v\n", err)
+	}
+	if err := s.Save(p2); err != nil {
+		t.Errorf("Error saving: %v\n", err)
+	}
+	if err := s.Save(p); !errors.Is(err, ErrExists) {
+		t.Errorf("no error for project name already existent: %v\n", err)
+	}
+	if !s.Exists(p.Name) {
+		t.Errorf("should exist!")
+	}
+	if s.Exists("not existent") {
+		t.Errorf("should not exist!")
+	}
+	pSaved, err := s.Get(p.Name)
+	if err != nil {
+		t.Errorf("Error getting: %v\n", err)
+	}
+	if p.Description != pSaved.Description {
+		t.Errorf("Expected description \"%v\", but was \"%v\"", p.Description, pSaved.Description)
+	}
+	if !testTime.Equal(pSaved.CreationDate) {
+		t.Errorf("Date should be updated to \"%v\", but was \"%v\"", testTime, pSaved.CreationDate)
+	}
+	if !ValidID(pSaved.ID) {
+		t.Errorf("ID not assigned: \"%v\"", pSaved.ID)
+	}
+	if pByID, err := s.ByID(pSaved.ID); err != nil || pByID.Name != p.Name {
+		t.Errorf("Error getting by ID: %+v, %v\n", pByID, err)
+	}
+	if _, err = s.ByID("../" + pSaved.ID); err == nil {
+		t.Errorf("Expected error for ID not existent\n")
+	}
+	if _, err = s.Get("not existent"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for name not existent: %v\n", err)
+	}
+	res := s.All()
+	if len(res) != 2 {
+		t.Errorf("Saved 2 projects, but found %v", len(res))
+	} else if p.Name != res[0].Name || p2.Name != res[1].Name {
+		t.Errorf("not in order")
+	}
+	if err = s.Delete(pSaved.ID); err != nil {
+		t.Errorf("Error deleting: %v\n", err)
+	}
+	if s.Exists(p.Name) {
+		t.Errorf("not deleted!")
+	}
+	if err = s.Delete(pSaved.ID); err != nil {
+		t.Errorf("should not error if project not existent: %v\n", err)
+	}
+}
+
+// testUpdate checks Update on a Store.
+func testUpdate(t *testing.T, s Store) {
+	for _, name := range []string{"first", "second"} {
+		if err := s.Save(Project{Name: name, Description: "old"}); err != nil {
+			t.Fatalf("Error saving: %v\n", err)
+		}
+	}
+	first, _ := s.Get("first")
+	if err := s.Update(Project{ID: first.ID, Name: "first", Description: "new"}); err != nil {
+		t.Errorf("Error updating: %v\n", err)
+	}
+	if p, _ := s.Get("first"); p.Description != "new" || !testTime.Equal(p.CreationDate) {
+		t.Errorf("not updated correctly: %+v\n", p)
+	}
+	if err := s.Update(Project{ID: "not existent", Name: "first"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error updating a project not existent\n")
+	}
+	// the name and the description change together, or not at all.
+	for _, name := range []string{"second", "../first"} {
+		if err := s.Update(Project{ID: first.ID, Name: name, Description: "lost"}); err == nil {
+			t.Errorf("Expected error updating the name to \"%v\"", name)
+		}
+	}
+	if p, _ := s.Get("first"); p.Description != "new" {
+		t.Errorf("description changed by a failed update: %+v\n", p)
+	}
+	if err := s.Update(Project{ID: first.ID, Name: "fourth", Description: "both"}); err != nil {
+		t.Errorf("Error updating: %v\n", err)
+	}
+	if p, err := s.Get("fourth"); err != nil || p.ID != first.ID || p.Description != "both" || s.Exists("first") {
+		t.Errorf("name and description not updated together: %+v, %v\n", p, err)
+	}
+	if err := s.Update(Project{ID: first.ID, Name: "second", Description: "new"}); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected error renaming to a name already existent\n")
+	}
+	if err := s.Update(Project{ID: first.ID, Name: "third", Description: "new"}); err != nil {
+		t.Errorf("Error renaming: %v\n", err)
+	}
+	if s.Exists("first") {
+		t.Errorf("old name still present")
+	}
+	if p, err := s.Get("third"); err != nil || p.Description != "new" || p.ID != first.ID {
+		t.Errorf("not renamed correctly: %+v, %v\n", p, err)
+	}
+}
+
+// testDirectories checks that the directories of the projects saved by
+// testStore are named after their IDs.
+func testDirectories(t *testing.T, s Store, path func(string) string) {
+	p, _ := s.Get("testName2")
+	if _, err := os.Stat(path(p.ID)); err != nil {
+		t.Errorf("project directory not created: %v\n", err)
+	}
+	bs := blobs.NewStore(filepath.Dir(path(p.ID)))
+	own, _, _ := bs.Put(blobs.Ref{Project: p.ID, Name: "own"}, strings.NewReader("own"))
+	shared, _, _ := bs.Put(blobs.Ref{Project: p.ID, Name: "shared"}, strings.NewReader("shared"))
+	bs.Put(blobs.Ref{Project: "other", Name: "shared"}, strings.NewReader("shared"))
+	if err := s.Delete(p.ID); err != nil {
+		t.Errorf("Error deleting: %v\n", err)
+	}
+	if _, err := os.Stat(path(p.ID)); !os.IsNotExist(err) {
+		t.Errorf("project directory not deleted: %v\n", err)
+	}
+	if _, err := bs.Open(own); !errors.Is(err, blobs.ErrNotFound) {
+		t.Errorf("blob used only by the project not deleted: %v\n", err)
+	}
+	if refs, err := bs.Refs(shared); err != nil || len(refs) != 1 {
+		t.Errorf("shared blob should be kept with 1 reference: %+v, %v\n", refs, err)
+	}
+	testUpdate(t, s)
+	p, _ = s.Get("third")
+	if _, err := os.Stat(path(p.ID)); err != nil {
+		t.Errorf("project directory should not change on rename: %v\n", err)
+	}
+}
+
+// testMembers checks the members saved by a Store.
+func testMembers(t *testing.T, s Store) {
+	owned := Project{Name: "owned", Members: []Member{{User: "mauro", Role: Owner}}}
+	if err := s.Save(owned); err != nil {
+		t.Fatalf("Error saving: %v\n", err)
+	}
+	p, _ := s.Get("owned")
+	if len(p.Members) != 1 || p.Role("mauro") != Owner || p.Role("other") != "" {
+		t.Errorf("members not saved: %+v\n", p)
+	}
+	id := p.ID
+	for _, m := range []Member{{User: "viewer", Role: Viewer}, {User: "editor", Role: Owner}, {User: "editor", Role: Editor}} {
+		if err := s.SetMember(id, m.User, m.Role); err != nil {
+			t.Errorf("Error setting the member %v: %v\n", m, err)
+		}
+	}
+	p, _ = s.Get("owned")
+	if len(p.Members) != 3 || p.Members[0].User != "editor" || p.Role("editor") != Editor || p.Role("viewer") != Viewer {
+		t.Errorf("members not set: %+v\n", p)
+	}
+	if all := s.All(); len(all) == 0 || len(all[len(all)-1].Members) != 3 {
+		t.Errorf("members not listed: %+v\n", all)
+	}
+	if err := s.SetMember(id, "viewer", ""); err != nil {
+		t.Errorf("Error removing the member: %v\n", err)
+	}
+	if p, _ := s.Get("owned"); len(p.Members) != 2 || p.Role("viewer") != "" {
+		t.Errorf("member not removed: %+v\n", p)
+	}
+	var verr *ValidationError
+	for _, m := range []Member{{User: "mauro", Role: Viewer}, {User: "mauro", Role: ""}, {User: "mauro", Role: "admin"}, {User: "", Role: Owner}} {
+		if err := s.SetMember(id, m.User, m.Role); !errors.As(err, &verr) {
+			t.Errorf("Expected validation error for %v: %v\n", m, err)
+		}
+	}
+	if p, _ := s.Get("owned"); len(p.Members) != 2 || p.Role("mauro") != Owner {
+		t.Errorf("members changed by a failed change: %+v\n", p)
+	}
+	if err := s.SetMember("not existent", "mauro", Owner); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for project not existent: %v\n", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	setup(t)
+	testStore(t, NewMemoryStore())
+	testUpdate(t, NewMemoryStore())
+	testMembers(t, NewMemoryStore())
+	teardown(t)
+}
+
+func TestFileStore(t *testing.T) {
+	setup(t)
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatalf("error setting test directory")
+	}
+	defer os.RemoveAll(dir)
+	s := NewFileStore(dir)
+	testStore(t, s)
+	testDirectories(t, s, s.Path)
+	testMembers(t, s)
+	teardown(t)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package projects
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/scompo/data-management/utils"
+)
+
+func TestReservedNames(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+	for _, name := range []string{"projects.json", "Projects.DB", "projects.json.bak"} {
+		for _, s := range []Store{NewFileStore(PrjDir), NewMemoryStore()} {
+			var verr *utils.ValidationError
+			if err := s.Save(Project{Name: name}); !errors.As(err, &verr) {
+				t.Errorf("\"%v\" should not be valid, got %v\n", name, err)
+			}
+		}
+	}
+}
+
+func TestPathTraversal(t *testing.T) {
+	setup(t)
+	// something outside the projects directory that must survive.
+	outside, err := ioutil.TempDir("", "outside")
+	if err != nil {
+		t.Fatalf("error setting test directory")
+	}
+	defer os.RemoveAll(outside)
+	rel, err := filepath.Rel(PrjDir, outside)
+	if err != nil {
+		t.Fatalf("error computing relative path: %v\n", err)
+	}
+	for _, s := range []Store{NewFileStore(PrjDir), NewMemoryStore()} {
+		if err := s.Save(Project{Name: rel}); err == nil {
+			t.Errorf("should not save \"%v\"", rel)
+		}
+		if err := s.Delete(rel); err == nil {
+			t.Errorf("should not delete \"%v\"", rel)
+		}
+		if _, err := s.Get(""); err == nil {
+			t.Errorf("should not get an empty name")
+		}
+		// decomposed and composed forms are the same name.
+		if err := s.Save(Project{Name: "cafe\u0301"}); err != nil {
+			t.Errorf("Error saving: %v\n", err)
+		}
+		if !s.Exists("caf\u00e9") {
+			t.Errorf("name not normalized")
+		}
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("directory outside the projects touched: %v\n", err)
+	}
+	teardown(t)
+}
@@ -0,0 +1,207 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+// Package queries contains the queries saved in a project, to run them
+// again or to filter the exports of its datasets.
+package queries
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/scompo/data-management/query"
+	"github.com/scompo/data-management/utils"
+)
+
+var fileName = "queries.json"
+
+// ErrNotFound is returned when a saved query does not exist.
+var ErrNotFound = errors.New("query not found")
+
+// Query is a query saved with a name.
+type Query struct {
+	Name    string
+	Text    string
+	Created time.Time
+	Updated time.Time
+}
+
+// Dataset returns the name of the dataset the query reads.
+func (q Query) Dataset() string {
+	parsed, err := query.Parse(q.Text)
+	if err != nil {
+		return ""
+	}
+	return parsed.From
+}
+
+var currentTime = time.Now
+
+// ValidationError is returned when a query field is not acceptable.
+type ValidationError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid query " + e.Field + " \"" + e.Value + "\": " + e.Reason
+}
+
+// Store saves the queries of a project in a file inside Dir.
+type Store struct {
+	Dir string
+}
+
+// NewStore returns the Store for the queries of the project in projectDir,
+// the directory named after its ID.
+func NewStore(projectDir string) *Store {
+	return &Store{Dir: projectDir}
+}
+
+// lock serializes the changes to the saved queries of the project, between
+// goroutines and between processes sharing the directory.
+// The returned function releases it.
+func (s *Store) lock() (func(), error) {
+	return utils.LockDir(s.Dir)
+}
+
+func (s *Store) read() ([]Query, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.Dir, fileName))
+	if os.IsNotExist(err) {
+		return []Query{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var qs []Query
+	err = json.Unmarshal(data, &qs)
+	return qs, err
+}
+
+func (s *Store) write(qs []Query) error {
+	sort.Slice(qs, func(i, j int) bool {
+		return qs[i].Name < qs[j].Name
+	})
+	data, err := json.Marshal(qs)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(s.Dir, fileName), data)
+}
+
+func indexOf(qs []Query, name string) int {
+	for i, q := range qs {
+		if q.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Save saves the query text as name, replacing the one with the same name.
+// The text has to be a valid query.
+func (s *Store) Save(name, text string) (Query, error) {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return Query{}, err
+	}
+	_, err = query.Parse(text)
+	if err != nil {
+		return Query{}, &ValidationError{Field: "Text", Value: text, Reason: err.Error()}
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return Query{}, err
+	}
+	defer unlock()
+	qs, err := s.read()
+	if err != nil {
+		return Query{}, err
+	}
+	now := currentTime()
+	q := Query{Name: name, Text: text, Created: now, Updated: now}
+	if i := indexOf(qs, name); i >= 0 {
+		q.Created = qs[i].Created
+		qs = append(qs[:i], qs[i+1:]...)
+	}
+	return q, s.write(append(qs, q))
+}
+
+// All returns all the saved queries sorted by name.
+func (s *Store) All() ([]Query, error) {
+	return s.read()
+}
+
+// Get returns a saved query by name.
+func (s *Store) Get(name string) (Query, error) {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return Query{}, err
+	}
+	qs, err := s.read()
+	if err != nil {
+		return Query{}, err
+	}
+	i := indexOf(qs, name)
+	if i < 0 {
+		return Query{}, fmt.Errorf("%w: %v", ErrNotFound, name)
+	}
+	return qs[i], nil
+}
+
+// Delete deletes a saved query by name.
+// Deleting a query that does not exist is not an error.
+func (s *Store) Delete(name string) error {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	qs, err := s.read()
+	if err != nil {
+		return err
+	}
+	i := indexOf(qs, name)
+	if i < 0 {
+		return nil
+	}
+	return s.write(append(qs[:i], qs[i+1:]...))
+}
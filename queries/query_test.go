@@ -0,0 +1,105 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package queries
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/scompo/data-management/utils"
+)
+
+var testTime = time.Now()
+
+func setup(t *testing.T) *Store {
+	currentTime = func() time.Time {
+		return testTime
+	}
+	t.Cleanup(func() {
+		currentTime = time.Now
+	})
+	return NewStore(t.TempDir())
+}
+
+func TestSave(t *testing.T) {
+	s := setup(t)
+
+	q, err := s.Save("north", `select * from "sales data" where region = 'north'`)
+	if err != nil {
+		t.Fatalf("Error saving: %v\n", err)
+	}
+	if q.Dataset() != "sales data" || !testTime.Equal(q.Created) {
+		t.Errorf("wrong query saved: %+v", q)
+	}
+	later := testTime.Add(time.Hour)
+	currentTime = func() time.Time {
+		return later
+	}
+	if _, err := s.Save("north", "select id from sales"); err != nil {
+		t.Errorf("Error replacing: %v\n", err)
+	}
+	saved, err := s.Get("north")
+	if err != nil || saved.Text != "select id from sales" || !testTime.Equal(saved.Created) || !later.Equal(saved.Updated) {
+		t.Errorf("query not replaced correctly: %+v, %v", saved, err)
+	}
+	var verr *ValidationError
+	if _, err := s.Save("broken", "select from"); !errors.As(err, &verr) {
+		t.Errorf("Expected validation error for the text: %v\n", err)
+	}
+	var nerr *utils.ValidationError
+	if _, err := s.Save("../escape", "select id from sales"); !errors.As(err, &nerr) {
+		t.Errorf("Expected validation error for the name: %v\n", err)
+	}
+	if _, err := s.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for query not existent: %v\n", err)
+	}
+}
+
+func TestAllDelete(t *testing.T) {
+	s := setup(t)
+
+	for _, name := range []string{"b", "a", "c"} {
+		if _, err := s.Save(name, "select * from "+name); err != nil {
+			t.Fatalf("Error saving: %v\n", err)
+		}
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Errorf("Error deleting: %v\n", err)
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Errorf("should not error if query not existent: %v\n", err)
+	}
+	qs, err := s.All()
+	if err != nil || len(qs) != 2 || qs[0].Name != "a" || qs[1].Name != "c" {
+		t.Errorf("Expected queries a and c, but found %+v, %v", qs, err)
+	}
+}
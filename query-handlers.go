@@ -0,0 +1,379 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/scompo/data-management/datasets"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/queries"
+	"github.com/scompo/data-management/query"
+	"github.com/scompo/data-management/utils"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// queryPageRows is the maximum number of rows shown on the query page.
+const queryPageRows = 1000
+
+// queryURL returns the path of the query page of prj, running src.
+func queryURL(prj projects.Project, src string) string {
+	u := projectURL(prj) + "/query"
+	if src != "" {
+		u += "?" + url.Values{"q": {src}}.Encode()
+	}
+	return u
+}
+
+// datasetQuery returns the query reading all the rows of the dataset name.
+func datasetQuery(name string) string {
+	return `SELECT * FROM "` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// runQuery runs the query src over a dataset of prj, the returned function
+// closes the dataset after the rows have been read.
+func (a *app) runQuery(prj projects.Project, src string) (*query.Rows, func() error, error) {
+	q, err := query.Parse(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := a.datasets(prj).Open(q.From)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := query.Run(q, r.Dataset.Columns, r)
+	if err != nil {
+		r.Close()
+		return nil, nil, err
+	}
+	return rows, r.Close, nil
+}
+
+// queryHandler shows the query page of a project, running the query in the
+// q parameter. Only the first queryPageRows rows are shown.
+func (a *app) queryHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, err := a.pathProject(r, projects.Viewer)
+	if err != nil {
+		return err
+	}
+	return a.renderQueryPage(w, r, prj, r.URL.Query().Get("q"), r.URL.Query().Has("q"), nil)
+}
+
+// renderQueryPage renders the query page of prj with the query src, running
+// it if run. errs are the validation errors of the form saving it.
+func (a *app) renderQueryPage(w http.ResponseWriter, r *http.Request, prj projects.Project, src string, run bool, errs map[string]string) error {
+	ds, err := a.datasets(prj).All()
+	if err != nil {
+		return err
+	}
+	saved, err := a.queries(prj).All()
+	if err != nil {
+		return err
+	}
+	if src == "" && len(ds) > 0 {
+		src = datasetQuery(ds[0].Name) + " LIMIT 100"
+	}
+	var columns []string
+	var rows [][]string
+	more := false
+	var qerr error
+	if run {
+		columns, rows, more, qerr = a.queryPage(prj, src)
+		if qerr != nil && !queryFailed(qerr) {
+			return qerr
+		}
+		if qerr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+	t, err := prepareAppTemplate(r, "templates/datasets/query.html")
+	if err != nil {
+		return err
+	}
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage": WebPage{
+			Title:       appName,
+			PageName:    "Query",
+			Breadcrumbs: projectCrumbs(prj),
+		},
+		"Project":  prj,
+		"Datasets": ds,
+		"Saved":    savedQueries(prj, saved),
+		"Query":    src,
+		"Error":    qerr,
+		"Ran":      run,
+		"Columns":  columns,
+		"Rows":     rows,
+		"More":     more,
+		"MaxRows":  queryPageRows,
+		"Exports":  exportLinks(projectURL(prj)+"/query/export", url.Values{"q": {src}}),
+		"Errors":   errs,
+	})
+}
+
+// queryPage returns the first queryPageRows results of src as text, and
+// whether there are more.
+func (a *app) queryPage(prj projects.Project, src string) ([]string, [][]string, bool, error) {
+	rows, closeData, err := a.runQuery(prj, src)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer closeData()
+	cells := make([][]string, 0)
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			return rows.Columns, cells, false, nil
+		}
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if len(cells) == queryPageRows {
+			return rows.Columns, cells, true, nil
+		}
+		text := make([]string, len(row))
+		for i, v := range row {
+			text[i] = query.Format(v)
+		}
+		cells = append(cells, text)
+	}
+}
+
+// queryFailed tells whether err is the fault of the query, to show on the
+// query page.
+func queryFailed(err error) bool {
+	var qerr *query.Error
+	var dverr *datasets.ValidationError
+	return errors.As(err, &qerr) || errors.As(err, &dverr) || errors.Is(err, datasets.ErrNotFound)
+}
+
+// apiQuery is the body of a query request to the json API.
+type apiQuery struct {
+	Query string `json:"query"`
+}
+
+// apiValue returns the json value of a result of a query, dates are text
+// and numbers json can't hold are null.
+func apiValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Time:
+		return query.Format(v)
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil
+		}
+	}
+	return v
+}
+
+// apiQueryHandler runs the query in the q parameter, or in the body of a
+// POST, over a dataset of a project. The rows are written as they are
+// computed:
+//
+//	{"columns": ["a", "b"], "rows": [[1, "x"], [2, "y"]]}
+//
+// A row failing after the answer has started ends the rows, the error is
+// in the error field as in the error answers:
+//
+//	{"columns": ["a"], "rows": [[1]], "error": {"status": 400, "error": "..."}}
+func (a *app) apiQueryHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, err := a.apiPathProject(r)
+	if err == nil {
+		err = authorize(r, prj, projects.Viewer)
+	}
+	if err != nil {
+		return err
+	}
+	var src string
+	switch r.Method {
+	case "GET":
+		src = r.URL.Query().Get("q")
+	case "POST":
+		var req apiQuery
+		err = decodeJSON(r, &req)
+		if err != nil {
+			return err
+		}
+		src = req.Query
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		return utils.MethodNotAllowed(r.Method)
+	}
+	rows, closeData, err := a.runQuery(prj, src)
+	if err != nil {
+		return err
+	}
+	defer closeData()
+	// the first row is computed before answering, to report the errors of
+	// queries failing at once.
+	row, err := rows.Next()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if err == io.EOF {
+		row, err = nil, nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	columns, _ := json.Marshal(rows.Columns)
+	_, werr := io.WriteString(w, `{"columns":`+string(columns)+`,"rows":[`)
+	for n := 0; row != nil && werr == nil; n++ {
+		values := make([]interface{}, len(row))
+		for i, v := range row {
+			values[i] = apiValue(v)
+		}
+		var data []byte
+		data, err = json.Marshal(values)
+		if err != nil {
+			break
+		}
+		if n > 0 {
+			data = append([]byte(","), data...)
+		}
+		_, werr = w.Write(data)
+		row, err = rows.Next()
+		if err == io.EOF {
+			row, err = nil, nil
+		}
+		if err != nil {
+			break
+		}
+	}
+	if werr != nil {
+		// the client has gone, nobody reads the rest.
+		return nil
+	}
+	end := "]}\n"
+	if err != nil {
+		status, message := utils.StatusOf(httpError(err))
+		body, _ := json.Marshal(utils.ErrorBody{Status: status, Error: message})
+		end = `],"error":` + string(body) + "}\n"
+	}
+	io.WriteString(w, end)
+	return nil
+}
+
+// queries returns the store of the saved queries of prj.
+func (a *app) queries(prj projects.Project) *queries.Store {
+	return queries.NewStore(filepath.Join(a.dir, prj.ID))
+}
+
+// savedQuery is a saved query shown on the query page.
+type savedQuery struct {
+	queries.Query
+	RunURL    string
+	DeleteURL string
+}
+
+func savedQueries(prj projects.Project, qs []queries.Query) []savedQuery {
+	saved := make([]savedQuery, len(qs))
+	for i, q := range qs {
+		saved[i] = savedQuery{
+			Query:     q,
+			RunURL:    queryURL(prj, q.Text),
+			DeleteURL: projectURL(prj) + "/queries/" + url.PathEscape(q.Name) + "/delete",
+		}
+	}
+	return saved
+}
+
+// saveQueryHandler saves the query Text as Name, replacing the saved query
+// with the same name.
+func (a *app) saveQueryHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	prj, err := a.pathProject(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	text := r.PostFormValue("Text")
+	_, err = a.queries(prj).Save(r.PostFormValue("Name"), text)
+	if errs, ok := formErrors(err); ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return a.renderQueryPage(w, r, prj, text, false, errs)
+	}
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, queryURL(prj, text), http.StatusSeeOther)
+	return nil
+}
+
+// deleteQueryHandler asks for confirmation on GET, the saved query is
+// deleted only by POST or DELETE.
+func (a *app) deleteQueryHandler(w http.ResponseWriter, r *http.Request) error {
+	prj, err := a.pathProject(r, projects.Editor)
+	if err != nil {
+		return err
+	}
+	q, err := a.queries(prj).Get(r.PathValue("name"))
+	if err != nil {
+		return err
+	}
+	switch r.Method {
+	case "POST", "DELETE":
+		err = a.queries(prj).Delete(q.Name)
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, queryURL(prj, ""), http.StatusSeeOther)
+		return nil
+	case "GET":
+		t, err := prepareAppTemplate(r, "templates/datasets/delete-query.html")
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, map[string]interface{}{
+			"WebPage": WebPage{
+				Title:       appName,
+				PageName:    "Delete Query",
+				Breadcrumbs: append(projectCrumbs(prj), Breadcrumb{Name: "Query", URL: queryURL(prj, "")}),
+			},
+			"Project": prj,
+			"Query":   q,
+		})
+	default:
+		return utils.MethodNotAllowed(r.Method)
+	}
+}
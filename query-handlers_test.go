@@ -0,0 +1,78 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/scompo/data-management/datasets"
+	"github.com/scompo/data-management/projects"
+	"github.com/scompo/data-management/utils"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestQueryFailingRow(t *testing.T) {
+	a := newApp(projects.NewMemoryStore(), t.TempDir())
+	h := loggedIn(t, a, "mauro")
+	if err := a.projects.Save(ownedProject(withUser(httptest.NewRequest("GET", "/", nil), "mauro"), projects.Project{Name: "x"})); err != nil {
+		t.Fatalf("Error saving: %v\n", err)
+	}
+	prj, _ := a.projects.Get("x")
+	if _, err := a.datasets(prj).Import("nums", "", strings.NewReader("a,b\n1,1\n1,0\n"), datasets.Options{}); err != nil {
+		t.Fatalf("Error importing: %v\n", err)
+	}
+	q := url.Values{"q": {"SELECT a / b FROM nums"}}.Encode()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/projects/"+prj.ID+"/query?"+q, nil))
+	var res struct {
+		Rows  [][]interface{}
+		Error *utils.ErrorBody
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil || len(res.Rows) != 1 || res.Error == nil || res.Error.Status != http.StatusBadRequest {
+		t.Errorf("the failing row should end the rows with an error: %+v, %v", res, err)
+	}
+}
+
+func TestAPIValue(t *testing.T) {
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if res := apiValue(v); res != nil {
+			t.Errorf("%v should be null, got %v", v, res)
+		}
+	}
+	if res := apiValue(1.5); res != 1.5 {
+		t.Errorf("Expected 1.5, got %v", res)
+	}
+}
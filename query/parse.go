@@ -0,0 +1,563 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Query is a parsed query:
+//
+//	SELECT items FROM dataset [WHERE expr] [GROUP BY exprs]
+//	[ORDER BY expr [ASC|DESC], ...] [LIMIT n]
+type Query struct {
+	// Select are the items to compute for every result row, empty for
+	// SELECT *.
+	Select  []Item
+	From    string
+	Where   Expr
+	GroupBy []Expr
+	OrderBy []Order
+	// Limit is the maximum number of rows, -1 for no limit.
+	Limit int
+}
+
+// Item is a result column: the value of Expr, called Name.
+type Item struct {
+	Expr Expr
+	Name string
+}
+
+// Order is a sorting key of the results.
+type Order struct {
+	Expr Expr
+	Desc bool
+}
+
+// Expr is an expression in a query.
+type Expr interface {
+	String() string
+}
+
+// Column is the value of a column of the dataset, or of a result column
+// by name in ORDER BY.
+type Column struct {
+	Name string
+}
+
+// Literal is a constant value.
+type Literal struct {
+	Value interface{}
+}
+
+// Binary is an operation between two values: arithmetic, comparison,
+// AND, OR or LIKE.
+type Binary struct {
+	Op          string
+	Left, Right Expr
+}
+
+// Unary is NOT or the negation of a number.
+type Unary struct {
+	Op string
+	X  Expr
+}
+
+// IsNull tells whether X has no value, or has one with Not.
+type IsNull struct {
+	X   Expr
+	Not bool
+}
+
+// In tells whether X is one of List, or is not with Not.
+type In struct {
+	X    Expr
+	List []Expr
+	Not  bool
+}
+
+// Call is an aggregate function over the rows of a group: COUNT, SUM, AVG,
+// MIN or MAX. Arg is nil for COUNT(*).
+type Call struct {
+	Func string
+	Arg  Expr
+}
+
+func (c *Column) String() string {
+	return quoteIdent(c.Name)
+}
+
+func (l *Literal) String() string {
+	switch v := l.Value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	return Format(l.Value)
+}
+
+func (b *Binary) String() string {
+	return b.Left.String() + " " + b.Op + " " + b.Right.String()
+}
+
+func (u *Unary) String() string {
+	if u.Op == "NOT" {
+		return "NOT " + u.X.String()
+	}
+	return u.Op + u.X.String()
+}
+
+func (n *IsNull) String() string {
+	if n.Not {
+		return n.X.String() + " IS NOT NULL"
+	}
+	return n.X.String() + " IS NULL"
+}
+
+func (in *In) String() string {
+	items := make([]string, len(in.List))
+	for i, e := range in.List {
+		items[i] = e.String()
+	}
+	op := " IN ("
+	if in.Not {
+		op = " NOT IN ("
+	}
+	return in.X.String() + op + strings.Join(items, ", ") + ")"
+}
+
+func (c *Call) String() string {
+	if c.Arg == nil {
+		return c.Func + "(*)"
+	}
+	return c.Func + "(" + c.Arg.String() + ")"
+}
+
+// quoteIdent quotes name when it is not a plain identifier.
+func quoteIdent(name string) string {
+	toks, err := lex(name)
+	if err == nil && len(toks) == 2 && toks[0].kind == tokIdent && toks[0].text == name {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// aggregates are the functions that can be called.
+var aggregates = map[string]bool{"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+// Parse parses the text of a query. Keywords and function names are not
+// case sensitive, names with spaces or other symbols are quoted with double
+// quotes or backticks and strings with single quotes.
+func Parse(src string) (*Query, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	q, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected %v", p.describe())
+	}
+	return q, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// is tells whether the next token is the keyword or operator s.
+func (p *parser) is(s string) bool {
+	t := p.peek()
+	return (t.kind == tokKeyword || t.kind == tokOp) && t.text == s
+}
+
+// accept skips the next token if it is s.
+func (p *parser) accept(s string) bool {
+	if p.is(s) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return p.errorf("expected %v, found %v", s, p.describe())
+	}
+	return nil
+}
+
+func (p *parser) describe() string {
+	t := p.peek()
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return "'" + t.text + "'"
+	}
+	return t.text
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &Error{Pos: p.peek().pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) query() (*Query, error) {
+	q := &Query{Limit: -1}
+	err := p.expect("SELECT")
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("*") {
+		for {
+			item, err := p.item()
+			if err != nil {
+				return nil, err
+			}
+			q.Select = append(q.Select, item)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	err = p.expect("FROM")
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokIdent {
+		return nil, p.errorf("expected a dataset name, found %v", p.describe())
+	}
+	q.From = p.next().text
+	if p.accept("WHERE") {
+		q.Where, err = p.expr()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("GROUP") {
+		err = p.expect("BY")
+		if err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			q.GroupBy = append(q.GroupBy, e)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("ORDER") {
+		err = p.expect("BY")
+		if err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			o := Order{Expr: e}
+			if p.accept("DESC") {
+				o.Desc = true
+			} else {
+				p.accept("ASC")
+			}
+			q.OrderBy = append(q.OrderBy, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("LIMIT") {
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != tokNumber || err != nil || n < 0 {
+			return nil, &Error{Pos: t.pos, Msg: "expected the number of rows after LIMIT"}
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+func (p *parser) item() (Item, error) {
+	start := p.peek().pos
+	e, err := p.expr()
+	if err != nil {
+		return Item{}, err
+	}
+	item := Item{Expr: e, Name: e.String()}
+	if c, ok := e.(*Column); ok {
+		item.Name = c.Name
+	}
+	if p.accept("AS") {
+		if p.peek().kind != tokIdent {
+			return Item{}, p.errorf("expected a name after AS, found %v", p.describe())
+		}
+		item.Name = p.next().text
+	} else if p.peek().kind == tokIdent {
+		item.Name = p.next().text
+	}
+	if item.Name == "" {
+		return Item{}, &Error{Pos: start, Msg: "empty column name"}
+	}
+	return item, nil
+}
+
+// expr parses an expression, from the operators that bind the least:
+// OR, AND, NOT, comparisons, + and -, * / and %, unary minus.
+func (p *parser) expr() (Expr, error) {
+	return p.or()
+}
+
+func (p *parser) or() (Expr, error) {
+	left, err := p.and()
+	for err == nil && p.accept("OR") {
+		var right Expr
+		right, err = p.and()
+		left = &Binary{Op: "OR", Left: left, Right: right}
+	}
+	return left, err
+}
+
+func (p *parser) and() (Expr, error) {
+	left, err := p.not()
+	for err == nil && p.accept("AND") {
+		var right Expr
+		right, err = p.not()
+		left = &Binary{Op: "AND", Left: left, Right: right}
+	}
+	return left, err
+}
+
+func (p *parser) not() (Expr, error) {
+	if p.accept("NOT") {
+		x, err := p.not()
+		return &Unary{Op: "NOT", X: x}, err
+	}
+	return p.comparison()
+}
+
+var comparisons = map[string]bool{"=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true}
+
+func (p *parser) comparison() (Expr, error) {
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == tokOp && comparisons[t.text]:
+		p.next()
+		right, err := p.sum()
+		op := t.text
+		if op == "<>" {
+			op = "!="
+		}
+		return &Binary{Op: op, Left: left, Right: right}, err
+	case p.accept("IS"):
+		not := p.accept("NOT")
+		err = p.expect("NULL")
+		return &IsNull{X: left, Not: not}, err
+	}
+	not := p.accept("NOT")
+	switch {
+	case p.accept("LIKE"):
+		var right Expr
+		right, err = p.sum()
+		var e Expr = &Binary{Op: "LIKE", Left: left, Right: right}
+		if not {
+			e = &Unary{Op: "NOT", X: e}
+		}
+		return e, err
+	case p.accept("IN"):
+		err = p.expect("(")
+		if err != nil {
+			return nil, err
+		}
+		in := &In{X: left, Not: not}
+		for {
+			e, err := p.sum()
+			if err != nil {
+				return nil, err
+			}
+			in.List = append(in.List, e)
+			if !p.accept(",") {
+				break
+			}
+		}
+		return in, p.expect(")")
+	case not:
+		return nil, p.errorf("expected LIKE or IN after NOT, found %v", p.describe())
+	}
+	return left, nil
+}
+
+func (p *parser) sum() (Expr, error) {
+	left, err := p.product()
+	for err == nil && (p.is("+") || p.is("-")) {
+		op := p.next().text
+		var right Expr
+		right, err = p.product()
+		left = &Binary{Op: op, Left: left, Right: right}
+	}
+	return left, err
+}
+
+func (p *parser) product() (Expr, error) {
+	left, err := p.unary()
+	for err == nil && (p.is("*") || p.is("/") || p.is("%")) {
+		op := p.next().text
+		var right Expr
+		right, err = p.unary()
+		left = &Binary{Op: op, Left: left, Right: right}
+	}
+	return left, err
+}
+
+func (p *parser) unary() (Expr, error) {
+	if p.accept("-") {
+		x, err := p.unary()
+		return &Unary{Op: "-", X: x}, err
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Expr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokNumber:
+		p.next()
+		if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &Literal{Value: n}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &Error{Pos: t.pos, Msg: "invalid number " + t.text}
+		}
+		return &Literal{Value: f}, nil
+	case t.kind == tokString:
+		p.next()
+		return &Literal{Value: t.text}, nil
+	case p.accept("TRUE"):
+		return &Literal{Value: true}, nil
+	case p.accept("FALSE"):
+		return &Literal{Value: false}, nil
+	case p.accept("NULL"):
+		return &Literal{}, nil
+	case p.accept("("):
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	case t.kind == tokIdent:
+		p.next()
+		if !p.accept("(") {
+			return &Column{Name: t.text}, nil
+		}
+		name := strings.ToUpper(t.text)
+		if !aggregates[name] {
+			return nil, &Error{Pos: t.pos, Msg: "unknown function " + t.text}
+		}
+		c := &Call{Func: name}
+		if name == "COUNT" && p.accept("*") {
+			return c, p.expect(")")
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if hasAggregate(arg) {
+			return nil, &Error{Pos: t.pos, Msg: "aggregate functions can't be nested"}
+		}
+		c.Arg = arg
+		return c, p.expect(")")
+	}
+	return nil, p.errorf("expected a value, found %v", p.describe())
+}
+
+// hasAggregate tells whether e calls an aggregate function.
+func hasAggregate(e Expr) bool {
+	found := false
+	walk(e, func(e Expr) {
+		if _, ok := e.(*Call); ok {
+			found = true
+		}
+	})
+	return found
+}
+
+// walk calls fn for e and all the expressions inside it.
+func walk(e Expr, fn func(Expr)) {
+	if e == nil {
+		return
+	}
+	fn(e)
+	switch e := e.(type) {
+	case *Binary:
+		walk(e.Left, fn)
+		walk(e.Right, fn)
+	case *Unary:
+		walk(e.X, fn)
+	case *IsNull:
+		walk(e.X, fn)
+	case *In:
+		walk(e.X, fn)
+		for _, x := range e.List {
+			walk(x, fn)
+		}
+	case *Call:
+		walk(e.Arg, fn)
+	}
+}
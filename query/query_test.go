@@ -0,0 +1,209 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package query
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/scompo/data-management/datasets"
+)
+
+var testColumns = []datasets.Column{
+	{Name: "id", Type: datasets.Int},
+	{Name: "region", Type: datasets.String},
+	{Name: "amount", Type: datasets.Float},
+	{Name: "day", Type: datasets.Date},
+	{Name: "paid", Type: datasets.Bool},
+}
+
+const testData = `1,north,10.5,2020-01-01,true
+2,south,20,2020-01-02,false
+3,north,5,2020-02-01,true
+4,east,,2020-02-03,
+5,south,7.5,2020-03-01,yes
+`
+
+// run runs src over the test data and returns the columns and rows as text.
+func run(t *testing.T, src string) ([]string, [][]string, error) {
+	q, err := Parse(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := Run(q, testColumns, csv.NewReader(strings.NewReader(testData)))
+	if err != nil {
+		return nil, nil, err
+	}
+	var result [][]string
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			return rows.Columns, result, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		text := make([]string, len(row))
+		for i, v := range row {
+			text[i] = Format(v)
+		}
+		result = append(result, text)
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		query   string
+		columns string
+		rows    string
+	}{
+		{"select * from sales limit 1", "id,region,amount,day,paid", "1,north,10.5,2020-01-01,true"},
+		{"SELECT id FROM sales WHERE region = 'north' AND amount > 6", "id", "1"},
+		{"select id, amount * 2 as double from sales where amount is null or not paid", "id,double", "2,40;4,"},
+		{"select id from sales where day >= '2020-02-01' and region in ('east', 'south')", "id", "4;5"},
+		{"select id from sales where region like 'no%' order by id desc", "id", "3;1"},
+		{"select id from sales where region not in ('north') order by amount desc limit 2", "id", "2;5"},
+		{"select region, count(*) n, sum(amount), avg(amount) from sales group by region order by n desc, region",
+			"region,n,SUM(amount),AVG(amount)", "north,2,15.5,7.75;south,2,27.5,13.75;east,1,,"},
+		{"select count(*), count(amount), min(day), max(id) from sales", "COUNT(*),COUNT(amount),MIN(day),MAX(id)", "5,4,2020-01-01,5"},
+		{"select count(*) from sales where id > 10", "COUNT(*)", "0"},
+		{"select region from sales group by region having", "", ""},
+		{`select "id" + 1 as "next id", -id from sales order by "next id" desc limit 1`, "next id,-id", "6,-5"},
+		{"select id / 2, id % 2 from sales limit 1", "id / 2,id % 2", "0.5,1"},
+	}
+	for _, test := range tests {
+		columns, rows, err := run(t, test.query)
+		if test.columns == "" {
+			if err == nil {
+				t.Errorf("Expected error for %v", test.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Error running %v: %v\n", test.query, err)
+			continue
+		}
+		text := make([]string, len(rows))
+		for i, row := range rows {
+			text[i] = strings.Join(row, ",")
+		}
+		if strings.Join(columns, ",") != test.columns || strings.Join(text, ";") != test.rows {
+			t.Errorf("%v: expected %v %v, but was %v %v", test.query, test.columns, test.rows, columns, text)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, src := range []string{
+		"select",
+		"select id sales",
+		"select id from sales where",
+		"select id from sales limit -1",
+		"select 'id from sales",
+		"select unknown(id) from sales",
+		"select sum(count(*)) from sales",
+		"select missing from sales",
+		"select id from sales where count(*) > 1",
+		"select * from sales group by region",
+		"select id from sales where region",
+		"select id from sales where region > 1",
+		"select region + 1 from sales",
+		"select sum(region) from sales",
+		"select id / 0 from sales",
+	} {
+		_, _, err := run(t, src)
+		var qerr *Error
+		if !errors.As(err, &qerr) {
+			t.Errorf("Expected query error for %v, but was %v", src, err)
+		}
+	}
+	_, err := Parse("select id from sales where ) ")
+	var qerr *Error
+	if !errors.As(err, &qerr) || qerr.Pos != 27 {
+		t.Errorf("Expected error at position 27, but was %v", err)
+	}
+}
+
+// countingSource counts the rows read.
+type countingSource struct {
+	Source
+	read int
+}
+
+func (s *countingSource) Read() ([]string, error) {
+	s.read++
+	return s.Source.Read()
+}
+
+func TestStreaming(t *testing.T) {
+	q, err := Parse("select id from sales limit 2")
+	if err != nil {
+		t.Fatalf("Error parsing: %v\n", err)
+	}
+	src := &countingSource{Source: csv.NewReader(strings.NewReader(testData))}
+	rows, err := Run(q, testColumns, src)
+	if err != nil {
+		t.Fatalf("Error running: %v\n", err)
+	}
+	if src.read != 0 {
+		t.Errorf("rows read before asking for results: %v", src.read)
+	}
+	for i := 0; i < 3; i++ {
+		rows.Next()
+	}
+	if src.read != 2 {
+		t.Errorf("Expected 2 rows read, but were %v", src.read)
+	}
+}
+
+func TestSortedError(t *testing.T) {
+	q, err := Parse("select 10 / (id - 3) from sales order by id")
+	if err != nil {
+		t.Fatalf("Error parsing: %v\n", err)
+	}
+	rows, err := Run(q, testColumns, csv.NewReader(strings.NewReader(testData)))
+	if err != nil {
+		t.Fatalf("Error running: %v\n", err)
+	}
+	_, first := rows.Next()
+	var qerr *Error
+	if !errors.As(first, &qerr) {
+		t.Fatalf("Expected query error, but was %v", first)
+	}
+	for i := 0; i < 3; i++ {
+		if row, err := rows.Next(); err != first {
+			t.Errorf("Expected the first error again, but was %v %v", row, err)
+		}
+	}
+}
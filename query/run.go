@@ -0,0 +1,718 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package query
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/scompo/data-management/datasets"
+)
+
+// Source is where the rows of a dataset are read from, like a
+// datasets.Reader. Read returns io.EOF after the last row.
+type Source interface {
+	Read() ([]string, error)
+}
+
+// Rows are the results of a query, computed while they are read.
+type Rows struct {
+	// Columns are the names of the result columns.
+	Columns []string
+	next    func() ([]interface{}, error)
+	// returned is the number of rows returned so far.
+	returned int
+	limit    int
+}
+
+// Next returns the next result row, io.EOF when there are no more.
+func (r *Rows) Next() ([]interface{}, error) {
+	if r.limit >= 0 && r.returned >= r.limit {
+		return nil, io.EOF
+	}
+	row, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	r.returned++
+	return row, nil
+}
+
+// env holds the values an expression is evaluated with.
+type env struct {
+	// row is the typed row of the dataset, the first of the group when
+	// aggregating.
+	row []interface{}
+	// aggs are the results of the aggregate functions of the group.
+	aggs []interface{}
+	// result is the result row, for ORDER BY.
+	result []interface{}
+}
+
+// eval is a compiled expression.
+type eval func(e *env) (interface{}, error)
+
+// planner compiles the expressions of a query for the columns of a
+// dataset.
+type planner struct {
+	columns []datasets.Column
+	// items are the names of the result columns, when ORDER BY can use
+	// them.
+	items []string
+	// calls are the aggregate functions found, when they are allowed.
+	calls []aggregate
+	// aggregate allows the aggregate functions.
+	aggregate bool
+}
+
+// aggregate is an aggregate function and its compiled argument, nil for
+// COUNT(*).
+type aggregate struct {
+	call *Call
+	arg  eval
+}
+
+func (p *planner) column(name string) (int, error) {
+	for i, c := range p.columns {
+		if c.Name == name {
+			return i, nil
+		}
+	}
+	for i, c := range p.columns {
+		if strings.EqualFold(c.Name, name) {
+			return i, nil
+		}
+	}
+	return 0, &Error{Pos: -1, Msg: "unknown column " + quoteIdent(name)}
+}
+
+func (p *planner) compile(x Expr) (eval, error) {
+	switch x := x.(type) {
+	case *Column:
+		for i, name := range p.items {
+			if name == x.Name {
+				return func(e *env) (interface{}, error) {
+					return e.result[i], nil
+				}, nil
+			}
+		}
+		i, err := p.column(x.Name)
+		if err != nil {
+			return nil, err
+		}
+		return func(e *env) (interface{}, error) {
+			return e.row[i], nil
+		}, nil
+	case *Literal:
+		return func(e *env) (interface{}, error) {
+			return x.Value, nil
+		}, nil
+	case *Call:
+		if !p.aggregate {
+			return nil, &Error{Pos: -1, Msg: x.String() + " can't be used here"}
+		}
+		// the argument is a value of the rows, like in WHERE.
+		var arg eval
+		if x.Arg != nil {
+			var err error
+			arg, err = (&planner{columns: p.columns}).compile(x.Arg)
+			if err != nil {
+				return nil, err
+			}
+		}
+		i := len(p.calls)
+		p.calls = append(p.calls, aggregate{call: x, arg: arg})
+		return func(e *env) (interface{}, error) {
+			return e.aggs[i], nil
+		}, nil
+	case *Unary:
+		arg, err := p.compile(x.X)
+		if err != nil {
+			return nil, err
+		}
+		if x.Op == "NOT" {
+			return func(e *env) (interface{}, error) {
+				v, err := arg(e)
+				if err != nil {
+					return nil, err
+				}
+				v, err = boolean(v)
+				if v == nil || err != nil {
+					return nil, err
+				}
+				return !v.(bool), nil
+			}, nil
+		}
+		return func(e *env) (interface{}, error) {
+			v, err := arg(e)
+			if err != nil {
+				return nil, err
+			}
+			return arithmetic("-", int64(0), v)
+		}, nil
+	case *IsNull:
+		arg, err := p.compile(x.X)
+		if err != nil {
+			return nil, err
+		}
+		return func(e *env) (interface{}, error) {
+			v, err := arg(e)
+			return (v == nil) != x.Not, err
+		}, nil
+	case *In:
+		return p.compileIn(x)
+	case *Binary:
+		return p.compileBinary(x)
+	}
+	return nil, fmt.Errorf("unknown expression %T", x)
+}
+
+func (p *planner) compileIn(x *In) (eval, error) {
+	arg, err := p.compile(x.X)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]eval, len(x.List))
+	for i, item := range x.List {
+		list[i], err = p.compile(item)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return func(e *env) (interface{}, error) {
+		v, err := arg(e)
+		if v == nil || err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			w, err := item(e)
+			if err != nil {
+				return nil, err
+			}
+			if w == nil {
+				continue
+			}
+			c, err := compare(v, w)
+			if err != nil {
+				return nil, err
+			}
+			if c == 0 {
+				return !x.Not, nil
+			}
+		}
+		return x.Not, nil
+	}, nil
+}
+
+func (p *planner) compileBinary(x *Binary) (eval, error) {
+	left, err := p.compile(x.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := p.compile(x.Right)
+	if err != nil {
+		return nil, err
+	}
+	switch x.Op {
+	case "AND", "OR":
+		// false AND unknown is false, true OR unknown is true.
+		decisive := x.Op == "OR"
+		return func(e *env) (interface{}, error) {
+			var result interface{} = !decisive
+			for _, operand := range []eval{left, right} {
+				v, err := operand(e)
+				if err != nil {
+					return nil, err
+				}
+				v, err = boolean(v)
+				if err != nil {
+					return nil, err
+				}
+				if v == nil {
+					result = nil
+				} else if v.(bool) == decisive {
+					return decisive, nil
+				}
+			}
+			return result, nil
+		}, nil
+	case "LIKE":
+		var last string
+		var re func(s string) bool
+		return func(e *env) (interface{}, error) {
+			v, err := left(e)
+			if v == nil || err != nil {
+				return nil, err
+			}
+			pattern, err := right(e)
+			if pattern == nil || err != nil {
+				return nil, err
+			}
+			if re == nil || Format(pattern) != last {
+				last = Format(pattern)
+				compiled, err := likePattern(last)
+				if err != nil {
+					return nil, err
+				}
+				re = compiled.MatchString
+			}
+			return re(Format(v)), nil
+		}, nil
+	case "+", "-", "*", "/", "%":
+		return func(e *env) (interface{}, error) {
+			a, err := left(e)
+			if err != nil {
+				return nil, err
+			}
+			b, err := right(e)
+			if err != nil {
+				return nil, err
+			}
+			return arithmetic(x.Op, a, b)
+		}, nil
+	}
+	return func(e *env) (interface{}, error) {
+		a, err := left(e)
+		if err != nil {
+			return nil, err
+		}
+		b, err := right(e)
+		if a == nil || b == nil || err != nil {
+			return nil, err
+		}
+		c, err := compare(a, b)
+		if err != nil {
+			return nil, err
+		}
+		switch x.Op {
+		case "=":
+			return c == 0, nil
+		case "!=":
+			return c != 0, nil
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	}, nil
+}
+
+// accumulator computes an aggregate function over the rows of a group.
+type accumulator struct {
+	aggregate
+	count int64
+	sum   float64
+	isum  int64
+	float bool
+	best  interface{}
+}
+
+func (a *accumulator) add(e *env) error {
+	if a.arg == nil {
+		a.count++
+		return nil
+	}
+	v, err := a.arg(e)
+	if v == nil || err != nil {
+		return err
+	}
+	a.count++
+	switch a.call.Func {
+	case "SUM", "AVG":
+		switch n := v.(type) {
+		case int64:
+			a.isum += n
+		case float64:
+			a.sum += n
+			a.float = true
+		default:
+			return errorf("%v needs numbers, found %v %v", a.call, typeName(v), Format(v))
+		}
+	case "MIN", "MAX":
+		if a.best == nil {
+			a.best = v
+			return nil
+		}
+		c, err := compare(v, a.best)
+		if err != nil {
+			return err
+		}
+		if (c < 0) == (a.call.Func == "MIN") && c != 0 {
+			a.best = v
+		}
+	}
+	return nil
+}
+
+func (a *accumulator) result() interface{} {
+	switch a.call.Func {
+	case "COUNT":
+		return a.count
+	case "SUM":
+		if a.count == 0 {
+			return nil
+		}
+		if a.float {
+			return a.sum + float64(a.isum)
+		}
+		return a.isum
+	case "AVG":
+		if a.count == 0 {
+			return nil
+		}
+		return (a.sum + float64(a.isum)) / float64(a.count)
+	}
+	return a.best
+}
+
+// group are the rows of the dataset with the same GROUP BY values.
+type group struct {
+	env  env
+	accs []*accumulator
+}
+
+// Run runs q over the rows of src, a dataset with columns. The rows are
+// read from src as the results are read, but for GROUP BY and ORDER BY
+// that need all of them; even then only the groups, or the LIMIT rows
+// being sorted, are kept in memory.
+func Run(q *Query, columns []datasets.Column, src Source) (*Rows, error) {
+	p := &planner{columns: columns}
+	var where eval
+	var err error
+	if q.Where != nil {
+		where, err = p.compile(q.Where)
+		if err != nil {
+			return nil, err
+		}
+	}
+	items := q.Select
+	if len(items) == 0 {
+		if len(q.GroupBy) > 0 {
+			return nil, &Error{Pos: -1, Msg: "SELECT * can't be used with GROUP BY"}
+		}
+		for _, c := range columns {
+			items = append(items, Item{Expr: &Column{Name: c.Name}, Name: c.Name})
+		}
+	}
+	keys := make([]eval, len(q.GroupBy))
+	for i, x := range q.GroupBy {
+		keys[i], err = p.compile(x)
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.aggregate = true
+	selects := make([]eval, len(items))
+	names := make([]string, len(items))
+	for i, item := range items {
+		selects[i], err = p.compile(item.Expr)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = item.Name
+	}
+	p.items = names
+	orders := make([]eval, len(q.OrderBy))
+	for i, o := range q.OrderBy {
+		orders[i], err = p.compile(o.Expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	read := func() (*env, error) {
+		for {
+			record, err := src.Read()
+			if err != nil {
+				return nil, err
+			}
+			e := &env{row: typed(columns, record)}
+			if where == nil {
+				return e, nil
+			}
+			v, err := where(e)
+			if err != nil {
+				return nil, err
+			}
+			v, err = boolean(v)
+			if err != nil {
+				return nil, err
+			}
+			if v == true {
+				return e, nil
+			}
+		}
+	}
+	if len(keys) > 0 || len(p.calls) > 0 {
+		read = groups(read, p.calls, keys, len(columns))
+	}
+	next := func() ([]interface{}, error) {
+		e, err := read()
+		if err != nil {
+			return nil, err
+		}
+		return project(e, selects)
+	}
+	if len(orders) > 0 {
+		next = sorted(read, selects, orders, q.OrderBy, q.Limit)
+	}
+	return &Rows{Columns: names, next: next, limit: q.Limit}, nil
+}
+
+// typed returns the values of a row of the dataset with columns.
+func typed(columns []datasets.Column, record []string) []interface{} {
+	row := make([]interface{}, len(columns))
+	for i, c := range columns {
+		if i >= len(record) {
+			break
+		}
+		v, err := datasets.Parse(c.Type, record[i])
+		if err != nil {
+			v = record[i]
+		}
+		row[i] = v
+	}
+	return row
+}
+
+// project computes the result row of e.
+func project(e *env, selects []eval) ([]interface{}, error) {
+	e.result = make([]interface{}, len(selects))
+	for i, s := range selects {
+		v, err := s(e)
+		if err != nil {
+			return nil, err
+		}
+		e.result[i] = v
+	}
+	return e.result, nil
+}
+
+// groupKey returns a text telling apart the values of different groups.
+func groupKey(values []interface{}) string {
+	var b strings.Builder
+	for _, v := range values {
+		b.WriteString(typeName(v))
+		b.WriteByte(':')
+		b.WriteString(Format(v))
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// groups returns a function reading the groups of the rows from read, in
+// the order they are found. All the rows are read on the first call.
+// Without keys all the rows are a single group, even when there are none.
+func groups(read func() (*env, error), calls []aggregate, keys []eval, columns int) func() (*env, error) {
+	var found []*group
+	done := false
+	return func() (*env, error) {
+		if !done {
+			done = true
+			var err error
+			found, err = collectGroups(read, calls, keys)
+			if err != nil {
+				return nil, err
+			}
+			if len(found) == 0 && len(keys) == 0 {
+				found = append(found, newGroup(&env{row: make([]interface{}, columns)}, calls))
+			}
+		}
+		if len(found) == 0 {
+			return nil, io.EOF
+		}
+		g := found[0]
+		found = found[1:]
+		g.env.aggs = make([]interface{}, len(g.accs))
+		for i, acc := range g.accs {
+			g.env.aggs[i] = acc.result()
+		}
+		return &g.env, nil
+	}
+}
+
+func newGroup(e *env, calls []aggregate) *group {
+	g := &group{env: env{row: e.row}, accs: make([]*accumulator, len(calls))}
+	for i, c := range calls {
+		g.accs[i] = &accumulator{aggregate: c}
+	}
+	return g
+}
+
+func collectGroups(read func() (*env, error), calls []aggregate, keys []eval) ([]*group, error) {
+	var found []*group
+	byKey := make(map[string]*group)
+	values := make([]interface{}, len(keys))
+	for {
+		e, err := read()
+		if err == io.EOF {
+			return found, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, k := range keys {
+			values[i], err = k(e)
+			if err != nil {
+				return nil, err
+			}
+		}
+		key := groupKey(values)
+		g, ok := byKey[key]
+		if !ok {
+			g = newGroup(e, calls)
+			byKey[key] = g
+			found = append(found, g)
+		}
+		for _, acc := range g.accs {
+			err = acc.add(e)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// sortedRow is a result row with the values it is sorted by.
+type sortedRow struct {
+	result []interface{}
+	keys   []interface{}
+	// seq keeps the rows with the same keys in the order they were read.
+	seq int
+}
+
+// sortedRows are the rows being sorted, a heap with the last one on top.
+type sortedRows struct {
+	rows  []sortedRow
+	order []Order
+}
+
+func (s *sortedRows) less(a, b sortedRow) bool {
+	for i, o := range s.order {
+		c := order(a.keys[i], b.keys[i])
+		if o.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	return a.seq < b.seq
+}
+
+func (s *sortedRows) Len() int {
+	return len(s.rows)
+}
+
+func (s *sortedRows) Less(i, j int) bool {
+	return s.less(s.rows[j], s.rows[i])
+}
+
+func (s *sortedRows) Swap(i, j int) {
+	s.rows[i], s.rows[j] = s.rows[j], s.rows[i]
+}
+
+func (s *sortedRows) Push(x interface{}) {
+	s.rows = append(s.rows, x.(sortedRow))
+}
+
+func (s *sortedRows) Pop() interface{} {
+	last := s.rows[len(s.rows)-1]
+	s.rows = s.rows[:len(s.rows)-1]
+	return last
+}
+
+// sorted returns a function reading the result rows from read sorted by
+// orders. All the rows are read on the first call, keeping at most limit
+// of them when limit is not negative. When reading them fails every call
+// returns the first error.
+func sorted(read func() (*env, error), selects, orders []eval, order []Order, limit int) func() ([]interface{}, error) {
+	var s *sortedRows
+	var failed error
+	return func() ([]interface{}, error) {
+		if failed != nil {
+			return nil, failed
+		}
+		if s == nil {
+			rows, err := readSorted(read, selects, orders, order, limit)
+			if err != nil {
+				failed = err
+				return nil, err
+			}
+			s = rows
+		}
+		if len(s.rows) == 0 {
+			return nil, io.EOF
+		}
+		row := s.rows[0]
+		s.rows = s.rows[1:]
+		return row.result, nil
+	}
+}
+
+// readSorted reads all the rows from read for sorted, and sorts them.
+func readSorted(read func() (*env, error), selects, orders []eval, order []Order, limit int) (*sortedRows, error) {
+	s := &sortedRows{order: order}
+	for seq := 0; ; seq++ {
+		e, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := sortedRow{keys: make([]interface{}, len(orders)), seq: seq}
+		row.result, err = project(e, selects)
+		if err != nil {
+			return nil, err
+		}
+		for i, o := range orders {
+			row.keys[i], err = o(e)
+			if err != nil {
+				return nil, err
+			}
+		}
+		heap.Push(s, row)
+		if limit >= 0 && s.Len() > limit {
+			heap.Pop(s)
+		}
+	}
+	sort.Slice(s.rows, func(i, j int) bool {
+		return s.less(s.rows[i], s.rows[j])
+	})
+	return s, nil
+}
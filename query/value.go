@@ -0,0 +1,246 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package query
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scompo/data-management/datasets"
+)
+
+// The values in a query are the ones returned by datasets.Parse: nil,
+// int64, float64, bool, time.Time and string.
+
+// Format returns the text of a value, the empty string for nil.
+func Format(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		if v.Equal(v.Truncate(24*time.Hour)) && v.Location() == time.UTC {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// typeName returns the name of the type of v in the errors.
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "date"
+	}
+	return "string"
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// compare returns -1, 0 or 1 when a is less than, equal to or greater than
+// b, neither nil. Numbers compare with numbers and dates with dates, or
+// with strings holding a date.
+func compare(a, b interface{}) (int, error) {
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			return cmp(x < y, x > y), nil
+		}
+	}
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return cmp(x < y, x > y), nil
+		}
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+		if y, ok := b.(time.Time); ok {
+			if x, err := datasets.Parse(datasets.Date, x); err == nil {
+				return compare(x, y)
+			}
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			return cmp(!x && y, x && !y), nil
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return cmp(x.Before(y), x.After(y)), nil
+		}
+		if y, ok := b.(string); ok {
+			if y, err := datasets.Parse(datasets.Date, y); err == nil {
+				return compare(x, y)
+			}
+		}
+	}
+	return 0, errorf("can't compare %v %v with %v %v", typeName(a), Format(a), typeName(b), Format(b))
+}
+
+func cmp(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// typeRanks orders the values of different types when sorting.
+var typeRanks = map[string]int{"null": 0, "bool": 1, "int": 2, "float": 2, "date": 3, "string": 4}
+
+// order compares any two values for sorting: nil comes first, then the
+// values that can't be compared are sorted by type.
+func order(a, b interface{}) int {
+	if a != nil && b != nil {
+		if c, err := compare(a, b); err == nil {
+			return c
+		}
+	}
+	ra, rb := typeRanks[typeName(a)], typeRanks[typeName(b)]
+	if ra != rb {
+		return cmp(ra < rb, ra > rb)
+	}
+	return strings.Compare(Format(a), Format(b))
+}
+
+// arithmetic computes a op b, the result is nil if either is nil.
+// Integers stay integers but for the division.
+func arithmetic(op string, a, b interface{}) (interface{}, error) {
+	if a == nil || b == nil {
+		return nil, nil
+	}
+	x, xok := a.(int64)
+	y, yok := b.(int64)
+	if xok && yok && op != "/" {
+		switch op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "%":
+			if y == 0 {
+				return nil, errDivision
+			}
+			return x % y, nil
+		}
+	}
+	f, fok := toFloat(a)
+	g, gok := toFloat(b)
+	if !fok || !gok {
+		return nil, errorf("can't compute %v %v %v %v %v", typeName(a), Format(a), op, typeName(b), Format(b))
+	}
+	switch op {
+	case "+":
+		return f + g, nil
+	case "-":
+		return f - g, nil
+	case "*":
+		return f * g, nil
+	case "/":
+		if g == 0 {
+			return nil, errDivision
+		}
+		return f / g, nil
+	}
+	if g == 0 {
+		return nil, errDivision
+	}
+	return math.Mod(f, g), nil
+}
+
+var errDivision = &Error{Pos: -1, Msg: "division by zero"}
+
+// errorf returns an Error found running a query.
+func errorf(format string, args ...interface{}) error {
+	return &Error{Pos: -1, Msg: fmt.Sprintf(format, args...)}
+}
+
+// boolean returns the value of v as a condition: true, false or nil for
+// unknown.
+func boolean(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case nil, bool:
+		return v, nil
+	}
+	return nil, errorf("expected a boolean, found %v %v", typeName(v), Format(v))
+}
+
+// likePattern returns the regular expression for a LIKE pattern, where %
+// is any text and _ any character.
+func likePattern(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,127 @@
+(function () {
+    var form = document.getElementById("dataset-edit-form");
+    var rows = document.getElementById("dataset-edit-rows");
+    var newRow = document.getElementById("dataset-edit-new");
+    var status = document.getElementById("dataset-edit-status");
+    var errorList = document.getElementById("dataset-edit-errors");
+    var existing = parseInt(form.dataset.rows, 10);
+
+    // the rows added are numbered after the existing ones, like the server
+    // does in its errors.
+    function addedRows() {
+        return Array.prototype.slice.call(rows.querySelectorAll("tr.grid-added"));
+    }
+
+    document.getElementById("dataset-edit-add").addEventListener("click", function () {
+        var tr = newRow.cloneNode(true);
+        tr.removeAttribute("id");
+        tr.hidden = false;
+        tr.className = "grid-added";
+        rows.appendChild(tr);
+        tr.querySelector("input[type=text]").focus();
+    });
+
+    rows.addEventListener("input", function (e) {
+        var input = e.target;
+        if (input.type === "text") {
+            input.classList.toggle("grid-changed", input.value !== input.defaultValue);
+        }
+    });
+
+    function edits() {
+        var body = {
+            version: parseInt(form.dataset.version, 10),
+            message: document.getElementById("input-edit-message").value,
+            cells: [],
+            delete: [],
+            add: []
+        };
+        rows.querySelectorAll("tr[data-row]").forEach(function (tr) {
+            var row = parseInt(tr.dataset.row, 10);
+            if (tr.querySelector(".grid-delete").checked) {
+                body.delete.push(row);
+                return;
+            }
+            tr.querySelectorAll("input[data-column]").forEach(function (input) {
+                if (input.value !== input.defaultValue) {
+                    body.cells.push({row: row, column: input.dataset.column, value: input.value});
+                }
+            });
+        });
+        addedRows().forEach(function (tr) {
+            if (tr.querySelector(".grid-delete").checked) {
+                return;
+            }
+            var values = {};
+            tr.querySelectorAll("input[data-column]").forEach(function (input) {
+                values[input.dataset.column] = input.value;
+            });
+            body.add.push(values);
+        });
+        return body;
+    }
+
+    // showErrors marks the cells of the rows breaking the schema.
+    function showErrors(errors) {
+        var added = addedRows().filter(function (tr) {
+            return !tr.querySelector(".grid-delete").checked;
+        });
+        errors.forEach(function (e) {
+            var li = document.createElement("li");
+            li.textContent = "Row " + e.row + ", " + e.column + " \"" + e.value + "\": " + e.reason;
+            errorList.appendChild(li);
+            var tr = e.row > existing ? added[e.row - existing - 1] : rows.querySelector("tr[data-row=\"" + e.row + "\"]");
+            if (!tr) {
+                return;
+            }
+            tr.querySelectorAll("input[data-column]").forEach(function (input) {
+                if (input.dataset.column === e.column) {
+                    input.classList.add("grid-error");
+                    input.title = e.reason;
+                }
+            });
+        });
+    }
+
+    form.addEventListener("submit", function (e) {
+        e.preventDefault();
+        status.textContent = "";
+        errorList.textContent = "";
+        form.querySelectorAll(".grid-error").forEach(function (input) {
+            input.classList.remove("grid-error");
+            input.title = "";
+        });
+        var body = edits();
+        if (body.cells.length + body.delete.length + body.add.length === 0) {
+            status.textContent = "Nothing to save.";
+            return;
+        }
+        fetch(form.dataset.action, {
+            method: "POST",
+            credentials: "same-origin",
+            headers: {
+                "Content-Type": "application/json",
+                "X-CSRF-Token": form.querySelector("input[name=csrf_token]").value
+            },
+            body: JSON.stringify(body)
+        }).then(function (res) {
+            return res.json().catch(function () {
+                return {error: res.statusText};
+            }).then(function (data) {
+                if (res.ok) {
+                    window.location.reload();
+                    return;
+                }
+                status.textContent = data.error;
+                if (res.status === 409) {
+                    status.textContent += ", reload the page to edit the new version.";
+                }
+                if (data.errors) {
+                    showErrors(data.errors);
+                }
+            });
+        }).catch(function (err) {
+            status.textContent = "Could not save the changes: " + err.message;
+        });
+    });
+})();
@@ -1,3 +1,4 @@
 var simplemde = new SimpleMDE({
-    element: document.getElementById("edit-page-text-area")
+    element: document.getElementById("edit-page-text-area"),
+    forceSync: true
 });
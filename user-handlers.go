@@ -0,0 +1,363 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/scompo/data-management/users"
+	"github.com/scompo/data-management/utils"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// sessionCookieName is the cookie holding the session of a browser where a
+// user logged in.
+const sessionCookieName = "session"
+
+type userKey struct{}
+
+// currentUser returns the name of the user logged in making r, empty if
+// r has not gone through requireUser.
+func currentUser(r *http.Request) string {
+	name, _ := r.Context().Value(userKey{}).(string)
+	return name
+}
+
+// withUser returns r made by the user name.
+func withUser(r *http.Request, name string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, name))
+}
+
+// publicPath reports if the page at path can be seen without logging in.
+func publicPath(path string) bool {
+	return path == "/login" || strings.HasPrefix(path, "/static/")
+}
+
+// sessionUser returns the user of the session in the cookie of r, empty if
+// there is none.
+func (a *app) sessionUser(r *http.Request) (string, error) {
+	c, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return "", nil
+	}
+	session, err := a.sessions.Get(c.Value)
+	if err == users.ErrNoSession {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	// the user may have been deleted since.
+	u, err := a.users.Get(session.User)
+	if errors.Is(err, users.ErrNotFound) {
+		return "", nil
+	}
+	return u.Name, err
+}
+
+// requireUser wraps h letting through only the requests of the users
+// logged in, but for the public paths. The others are sent to the login
+// page, or refused when they would change something.
+func (a *app) requireUser(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, err := a.sessionUser(r)
+		if err != nil {
+			status, message := utils.StatusOf(err)
+			utils.ErrorPage(w, r, status, message)
+			return
+		}
+		if name != "" {
+			h.ServeHTTP(w, withUser(r, name))
+			return
+		}
+		switch {
+		case publicPath(r.URL.Path):
+			h.ServeHTTP(w, r)
+		case r.Method == "GET" || r.Method == "HEAD":
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		default:
+			utils.ErrorPage(w, r, http.StatusUnauthorized, "log in first")
+		}
+	})
+}
+
+// requireAPIUser wraps the json API h letting through only the requests of
+// the users logged in, with a session or with HTTP basic authentication.
+func (a *app) requireAPIUser(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, err := a.sessionUser(r)
+		if err != nil {
+			status, message := utils.StatusOf(err)
+			utils.WriteJSON(w, status, utils.ErrorBody{Status: status, Error: message})
+			return
+		}
+		if basicName, password, ok := r.BasicAuth(); ok && name == "" {
+			u, err := a.users.Authenticate(basicName, password)
+			if err != nil && err != users.ErrCredentials {
+				status, message := utils.StatusOf(err)
+				utils.WriteJSON(w, status, utils.ErrorBody{Status: status, Error: message})
+				return
+			}
+			name = u.Name
+		}
+		if name == "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+appName+`"`)
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.ErrorBody{Status: http.StatusUnauthorized, Error: "log in first"})
+			return
+		}
+		h.ServeHTTP(w, withUser(r, name))
+	})
+}
+
+// sessionCookie returns the cookie for the session, secure when r came
+// through HTTPS.
+func sessionCookie(r *http.Request, session users.Session) *http.Cookie {
+	return &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    session.ID,
+		Path:     "/",
+		Expires:  session.Expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// localPath returns next if it's a path of this site, to go back there
+// after the login, the main page otherwise.
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// loginHandler logs in the user Name with Password, starting a session and
+// going back to the Next page.
+func (a *app) loginHandler(w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "POST":
+		name, next := r.PostFormValue("Name"), r.PostFormValue("Next")
+		u, err := a.users.Authenticate(name, r.PostFormValue("Password"))
+		if err == users.ErrCredentials {
+			w.WriteHeader(http.StatusUnauthorized)
+			return renderLogin(w, r, name, next, map[string]string{"Password": err.Error()})
+		}
+		if err != nil {
+			return err
+		}
+		session, err := a.sessions.Start(u.Name)
+		if err != nil {
+			return err
+		}
+		http.SetCookie(w, sessionCookie(r, session))
+		http.Redirect(w, r, localPath(next), http.StatusSeeOther)
+		return nil
+	case "GET":
+		return renderLogin(w, r, "", r.URL.Query().Get("next"), nil)
+	default:
+		return utils.MethodNotAllowed(r.Method)
+	}
+}
+
+// renderLogin renders the login form, errs are the errors to show next to
+// the fields.
+func renderLogin(w http.ResponseWriter, r *http.Request, name, next string, errs map[string]string) error {
+	t, err := prepareAppTemplate(r, "templates/users/login.html")
+	if err != nil {
+		return err
+	}
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage": WebPage{
+			Title:    appName,
+			PageName: "Log in",
+		},
+		"Name":   name,
+		"Next":   next,
+		"Errors": errs,
+	})
+}
+
+// logoutHandler ends the session of the browser.
+func (a *app) logoutHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	if c, err := r.Cookie(sessionCookieName); err == nil {
+		err = a.sessions.End(c.Value)
+		if err != nil {
+			return err
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+	return nil
+}
+
+// isAdmin reports if the user making r is an administrator.
+func (a *app) isAdmin(r *http.Request) (bool, error) {
+	u, err := a.users.Get(currentUser(r))
+	if errors.Is(err, users.ErrNotFound) {
+		return false, nil
+	}
+	return u.Admin, err
+}
+
+// usersHandler lists the users, the administrators can create a new one
+// posting its Name and Password.
+func (a *app) usersHandler(w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "POST":
+		admin, err := a.isAdmin(r)
+		if err != nil {
+			return err
+		}
+		if !admin {
+			return utils.Forbidden(errors.New("only the administrators add users"))
+		}
+		name := r.PostFormValue("Name")
+		_, err = a.users.Create(name, r.PostFormValue("Password"))
+		if errs, ok := formErrors(err); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return a.renderUsers(w, r, name, errs)
+		}
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, "/users", http.StatusSeeOther)
+		return nil
+	case "GET":
+		return a.renderUsers(w, r, "", nil)
+	default:
+		return utils.MethodNotAllowed(r.Method)
+	}
+}
+
+// passwordHandler changes the password of the user logged in, who has to
+// know the Current one. The other sessions of the user end.
+func (a *app) passwordHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return utils.MethodNotAllowed(r.Method)
+	}
+	name := currentUser(r)
+	_, err := a.users.Authenticate(name, r.PostFormValue("Current"))
+	if err == users.ErrCredentials {
+		w.WriteHeader(http.StatusBadRequest)
+		return a.renderUsers(w, r, "", map[string]string{"Current": "wrong password"})
+	}
+	if err != nil {
+		return err
+	}
+	err = a.users.SetPassword(name, r.PostFormValue("Password"))
+	if errs, ok := formErrors(err); ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return a.renderUsers(w, r, "", map[string]string{"NewPassword": errs["Password"]})
+	}
+	if err != nil {
+		return err
+	}
+	except := ""
+	if c, err := r.Cookie(sessionCookieName); err == nil {
+		except = c.Value
+	}
+	err = a.sessions.EndUser(name, except)
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/users", http.StatusSeeOther)
+	return nil
+}
+
+// renderUsers renders the list of the users with the forms to add one and
+// to change the password. name is the name of the user being added, errs
+// the errors to show next to the fields.
+func (a *app) renderUsers(w http.ResponseWriter, r *http.Request, name string, errs map[string]string) error {
+	us, err := a.users.All()
+	if err != nil {
+		return err
+	}
+	admin, err := a.isAdmin(r)
+	if err != nil {
+		return err
+	}
+	t, err := prepareAppTemplate(r, "templates/users/list.html")
+	if err != nil {
+		return err
+	}
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+	return t.Execute(w, map[string]interface{}{
+		"WebPage": WebPage{
+			Title:    appName,
+			PageName: "Users",
+		},
+		"Users":       us,
+		"Admin":       admin,
+		"Name":        name,
+		"MinPassword": users.MinPassword,
+		"Errors":      errs,
+	})
+}
+
+// addUser creates the user name with the password in the first line read
+// from r, to add the users from the command line. admin makes the user an
+// administrator, as the first one always is.
+func addUser(dir, name string, admin bool, r io.Reader) error {
+	password, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	err = os.MkdirAll(dir, 0775)
+	if err != nil {
+		return err
+	}
+	store := users.NewStore(dir)
+	u, err := store.Create(name, strings.TrimRight(password, "\r\n"))
+	if err != nil || !admin || u.Admin {
+		return err
+	}
+	return store.SetAdmin(u.Name, true)
+}
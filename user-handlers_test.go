@@ -0,0 +1,181 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"github.com/scompo/data-management/projects"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testPassword = "a good password"
+
+// loggedIn returns the routes of a serving the requests as the user name,
+// created for the test, logged in with a session.
+func loggedIn(t *testing.T, a *app, name string) http.Handler {
+	if _, err := a.users.Create(name, testPassword); err != nil {
+		t.Fatalf("Error creating the user: %v\n", err)
+	}
+	session, err := a.sessions.Start(name)
+	if err != nil {
+		t.Fatalf("Error starting the session: %v\n", err)
+	}
+	h := a.routes()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: session.ID})
+		h.ServeHTTP(w, r)
+	})
+}
+
+// formRequest returns a POST of the form values, with a valid CSRF token.
+func formRequest(path string, values url.Values) *http.Request {
+	token := strings.Repeat("t", 43)
+	values.Set("csrf_token", token)
+	r := httptest.NewRequest("POST", path, strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(&http.Cookie{Name: "csrf_token", Value: token})
+	return r
+}
+
+func TestLogin(t *testing.T) {
+	a := newApp(projects.NewMemoryStore(), t.TempDir())
+	if _, err := a.users.Create("mauro", testPassword); err != nil {
+		t.Fatalf("Error creating the user: %v\n", err)
+	}
+	h := a.routes()
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(httptest.NewRequest("GET", "/projects?x=1", nil))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login?next=%2Fprojects%3Fx%3D1" {
+		t.Errorf("Expected redirect to the login, got %v %v", w.Code, w.Header())
+	}
+	if w := serve(formRequest("/projects/new", url.Values{"Name": {"x"}})); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unauthorized change, got %v", w.Code)
+	}
+	if w := serve(httptest.NewRequest("GET", "/login", nil)); w.Code != http.StatusOK {
+		t.Errorf("Expected the login page, got %v", w.Code)
+	}
+	w = serve(formRequest("/login", url.Values{"Name": {"mauro"}, "Password": {"wrong password"}}))
+	if w.Code != http.StatusUnauthorized || len(w.Result().Cookies()) != 0 {
+		t.Errorf("Expected wrong credentials, got %v %v", w.Code, w.Result().Cookies())
+	}
+	w = serve(formRequest("/login", url.Values{"Name": {"mauro"}, "Password": {testPassword}, "Next": {"/projects"}}))
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/projects" || len(cookies) != 1 ||
+		cookies[0].Name != sessionCookieName || !cookies[0].HttpOnly {
+		t.Fatalf("Error logging in: %v %v %v", w.Code, w.Header(), cookies)
+	}
+	session := cookies[0]
+
+	r := httptest.NewRequest("GET", "/projects", nil)
+	r.AddCookie(session)
+	if w := serve(r); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "mauro") {
+		t.Errorf("Expected the projects of the user logged in, got %v", w.Code)
+	}
+	r = httptest.NewRequest("GET", "/api/v1/projects", nil)
+	if w := serve(r); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected unauthorized API request, got %v %v", w.Code, w.Header())
+	}
+	r = httptest.NewRequest("GET", "/api/v1/projects", nil)
+	r.SetBasicAuth("mauro", testPassword)
+	if w := serve(r); w.Code != http.StatusOK {
+		t.Errorf("Error authenticating the API request, got %v", w.Code)
+	}
+
+	r = formRequest("/logout", url.Values{})
+	r.AddCookie(session)
+	if w := serve(r); w.Code != http.StatusSeeOther {
+		t.Errorf("Error logging out: %v", w.Code)
+	}
+	r = httptest.NewRequest("GET", "/projects", nil)
+	r.AddCookie(session)
+	if w := serve(r); w.Code != http.StatusSeeOther {
+		t.Errorf("the session should have ended, got %v", w.Code)
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	for next, expected := range map[string]string{
+		"/projects/x?page=2":  "/projects/x?page=2",
+		"":                    "/",
+		"//evil.example":      "/",
+		"/\\evil.example":     "/",
+		"http://evil.example": "/",
+	} {
+		if got := localPath(next); got != expected {
+			t.Errorf("Expected \"%v\" for \"%v\", but was \"%v\"", expected, next, got)
+		}
+	}
+}
+
+func TestAddUser(t *testing.T) {
+	a := newApp(projects.NewMemoryStore(), t.TempDir())
+	admin := loggedIn(t, a, "mauro")
+	other := loggedIn(t, a, "other")
+	add := func(h http.Handler, name string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, formRequest("/users", url.Values{"Name": {name}, "Password": {testPassword}}))
+		return w.Code
+	}
+	if code := add(other, "third"); code != http.StatusForbidden {
+		t.Errorf("only the administrators should add users, got %v", code)
+	}
+	if code := add(admin, "third"); code != http.StatusSeeOther {
+		t.Errorf("Error adding the user: %v", code)
+	}
+	if _, err := a.users.Get("third"); err != nil {
+		t.Errorf("the user was not added: %v\n", err)
+	}
+}
+
+func TestChangeAuthor(t *testing.T) {
+	a := newApp(projects.NewMemoryStore(), t.TempDir())
+	h := loggedIn(t, a, "mauro")
+	if err := a.projects.Save(ownedProject(withUser(httptest.NewRequest("GET", "/", nil), "mauro"), projects.Project{Name: "x"})); err != nil {
+		t.Fatalf("Error saving: %v\n", err)
+	}
+	prj, _ := a.projects.Get("x")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, formRequest("/pages/new", url.Values{"Project": {prj.ID}, "Name": {"home"}, "Author": {"someone else"}}))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Error creating the page: %v", w.Code)
+	}
+	if p, err := a.pages(prj).Get("home"); err != nil || p.Author != "mauro" {
+		t.Errorf("the author should be the user logged in: %+v, %v", p, err)
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/scompo/data-management/utils"
+)
+
+var sessionsName = "sessions.json"
+
+// SessionLifetime is how long a session lasts after the login.
+const SessionLifetime = 7 * 24 * time.Hour
+
+// ErrNoSession is returned when a session does not exist or has expired.
+var ErrNoSession = errors.New("session not found or expired")
+
+// Session is a browser where a user logged in. ID is the secret token
+// identifying it, only its hash is saved.
+type Session struct {
+	ID      string `json:"-"`
+	User    string
+	Created time.Time
+	Expires time.Time
+}
+
+// Sessions saves the sessions in a file inside Dir, keeping them in memory
+// until the file changes. The changes take the lock of the projects in Dir
+// to work with the other processes sharing it.
+type Sessions struct {
+	Dir string
+
+	mu sync.Mutex
+	// byHash are the sessions by the hash of their ID, as read from the
+	// file described by info. nil before reading the file.
+	byHash map[string]Session
+	info   os.FileInfo
+}
+
+// NewSessions returns the Sessions in dir, the data directory.
+func NewSessions(dir string) *Sessions {
+	return &Sessions{Dir: dir}
+}
+
+// tokenHash returns the hash of the session ID id as saved in the file.
+func tokenHash(id string) string {
+	h := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(h[:])
+}
+
+// load reads the sessions, if the file changed since the last time: every
+// change replaces it with a new file. s.mu must be held.
+func (s *Sessions) load() error {
+	info, err := os.Stat(filepath.Join(s.Dir, sessionsName))
+	if os.IsNotExist(err) {
+		s.byHash, s.info = make(map[string]Session), nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.byHash != nil && s.info != nil && os.SameFile(s.info, info) {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(s.Dir, sessionsName))
+	if err != nil {
+		return err
+	}
+	byHash := make(map[string]Session)
+	err = json.Unmarshal(data, &byHash)
+	if err != nil {
+		return err
+	}
+	s.byHash, s.info = byHash, info
+	return nil
+}
+
+// change applies change to the sessions read from the file and writes
+// the ones not expired.
+func (s *Sessions) change(change func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	err = s.load()
+	if err != nil {
+		return err
+	}
+	change()
+	now := currentTime()
+	for h, session := range s.byHash {
+		if !now.Before(session.Expires) {
+			delete(s.byHash, h)
+		}
+	}
+	data, err := json.Marshal(s.byHash)
+	if err == nil {
+		err = utils.WritePrivateFileAtomic(filepath.Join(s.Dir, sessionsName), data)
+	}
+	if err != nil {
+		// read the file again the next time.
+		s.byHash = nil
+		return err
+	}
+	// nobody else writes while holding the lock.
+	s.info, err = os.Stat(filepath.Join(s.Dir, sessionsName))
+	return err
+}
+
+// Start starts a new session for the user name.
+func (s *Sessions) Start(name string) (Session, error) {
+	var b [32]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return Session{}, err
+	}
+	now := currentTime()
+	session := Session{
+		ID:      base64.RawURLEncoding.EncodeToString(b[:]),
+		User:    name,
+		Created: now,
+		Expires: now.Add(SessionLifetime),
+	}
+	err = s.change(func() {
+		s.byHash[tokenHash(session.ID)] = session
+	})
+	return session, err
+}
+
+// Get returns the session with the ID id, ErrNoSession if it does not
+// exist or has expired.
+func (s *Sessions) Get(id string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.load()
+	if err != nil {
+		return Session{}, err
+	}
+	session, ok := s.byHash[tokenHash(id)]
+	if !ok || !currentTime().Before(session.Expires) {
+		return Session{}, ErrNoSession
+	}
+	session.ID = id
+	return session, nil
+}
+
+// End ends the session with the ID id.
+// Ending a session that does not exist is not an error.
+func (s *Sessions) End(id string) error {
+	return s.change(func() {
+		delete(s.byHash, tokenHash(id))
+	})
+}
+
+// EndUser ends all the sessions of the user name, but the one with the ID
+// except.
+func (s *Sessions) EndUser(name, except string) error {
+	keep := tokenHash(except)
+	return s.change(func() {
+		for h, session := range s.byHash {
+			if session.User == name && h != keep {
+				delete(s.byHash, h)
+			}
+		}
+	})
+}
@@ -0,0 +1,101 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package users
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	s := setup(t)
+
+	sessions := NewSessions(s.Dir)
+	first, err := sessions.Start("mauro")
+	if err != nil {
+		t.Fatalf("Error starting: %v\n", err)
+	}
+	second, _ := sessions.Start("mauro")
+	if first.ID == "" || first.ID == second.ID {
+		t.Errorf("the sessions should have different IDs: %v %v", first.ID, second.ID)
+	}
+	// a new Sessions reads them from the file.
+	sessions = NewSessions(s.Dir)
+	got, err := sessions.Get(first.ID)
+	if err != nil || got.User != "mauro" || got.ID != first.ID || !testTime.Add(SessionLifetime).Equal(got.Expires) {
+		t.Errorf("Error getting: %+v, %v\n", got, err)
+	}
+	if _, err := sessions.Get("not a session"); err != ErrNoSession {
+		t.Errorf("Expected no session: %v\n", err)
+	}
+	if err := sessions.EndUser("mauro", second.ID); err != nil {
+		t.Errorf("Error ending the sessions of the user: %v\n", err)
+	}
+	if _, err := sessions.Get(first.ID); err != ErrNoSession {
+		t.Errorf("the other sessions should have ended: %v\n", err)
+	}
+	if _, err := sessions.Get(second.ID); err != nil {
+		t.Errorf("the session kept has ended: %v\n", err)
+	}
+	currentTime = func() time.Time {
+		return testTime.Add(SessionLifetime)
+	}
+	if _, err := sessions.Get(second.ID); err != ErrNoSession {
+		t.Errorf("Expected the session to expire: %v\n", err)
+	}
+	if err := sessions.End(second.ID); err != nil {
+		t.Errorf("Error ending: %v\n", err)
+	}
+}
+
+func TestSessionsShared(t *testing.T) {
+	s := setup(t)
+
+	// two processes sharing the directory.
+	first, second := NewSessions(s.Dir), NewSessions(s.Dir)
+	session, err := first.Start("mauro")
+	if err != nil {
+		t.Fatalf("Error starting: %v\n", err)
+	}
+	if _, err := second.Get(session.ID); err != nil {
+		t.Errorf("Error getting the session started elsewhere: %v\n", err)
+	}
+	other, _ := second.Start("other")
+	if err := first.End(session.ID); err != nil {
+		t.Errorf("Error ending: %v\n", err)
+	}
+	if _, err := second.Get(session.ID); err != ErrNoSession {
+		t.Errorf("the session ended elsewhere should have ended: %v\n", err)
+	}
+	if _, err := first.Get(other.ID); err != nil {
+		t.Errorf("the session started elsewhere should be kept: %v\n", err)
+	}
+}
@@ -0,0 +1,294 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+// Package users contains the accounts of the people using the application
+// and the sessions of the browsers they logged in from.
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/scompo/data-management/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var fileName = "users.json"
+
+// MinPassword is the minimum length of a password, in bytes.
+const MinPassword = 8
+
+// maxPassword is the maximum length of a password bcrypt can hash.
+const maxPassword = 72
+
+// ErrNotFound is returned when a user does not exist.
+var ErrNotFound = errors.New("user not found")
+
+// ErrExists is returned creating a user with a name already used.
+var ErrExists = errors.New("user name already existent")
+
+// ErrCredentials is returned when a user name and a password don't match.
+var ErrCredentials = errors.New("wrong user name or password")
+
+// User is an account, only the hash of its password is kept.
+// The administrators add the other accounts.
+type User struct {
+	Name    string
+	Hash    []byte
+	Created time.Time
+	Admin   bool `json:",omitempty"`
+}
+
+var currentTime = time.Now
+
+// cost is the bcrypt cost of the password hashes.
+var cost = bcrypt.DefaultCost
+
+// ValidationError is returned when a user field is not acceptable.
+type ValidationError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid user " + e.Field + " \"" + e.Value + "\": " + e.Reason
+}
+
+// hash returns the hash of password, checking its length.
+// The password is never part of the errors.
+func hash(password string) ([]byte, error) {
+	if len(password) < MinPassword {
+		return nil, &ValidationError{Field: "Password", Reason: fmt.Sprintf("at least %v characters", MinPassword)}
+	}
+	if len(password) > maxPassword {
+		return nil, &ValidationError{Field: "Password", Reason: fmt.Sprintf("at most %v bytes", maxPassword)}
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), cost)
+}
+
+// dummyHash is compared with the passwords of the users that don't exist,
+// so that checking them takes as long as for the ones that do.
+var dummyHash = sync.OnceValue(func() []byte {
+	h, _ := bcrypt.GenerateFromPassword([]byte("not a password"), cost)
+	return h
+})
+
+// Store saves the users in a file inside Dir, the changes take the lock
+// of the projects in Dir to work with the other processes sharing it.
+type Store struct {
+	Dir string
+}
+
+// NewStore returns the Store for the users in dir, the data directory.
+func NewStore(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+func (s *Store) read() ([]User, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.Dir, fileName))
+	if os.IsNotExist(err) {
+		return []User{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var us []User
+	err = json.Unmarshal(data, &us)
+	return us, err
+}
+
+func (s *Store) write(us []User) error {
+	sort.Slice(us, func(i, j int) bool {
+		return us[i].Name < us[j].Name
+	})
+	data, err := json.Marshal(us)
+	if err != nil {
+		return err
+	}
+	// the file holds the password hashes, only the application reads it.
+	return utils.WritePrivateFileAtomic(filepath.Join(s.Dir, fileName), data)
+}
+
+func indexOf(us []User, name string) int {
+	for i, u := range us {
+		if u.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Create creates the user name with password.
+// The first user is an administrator.
+func (s *Store) Create(name, password string) (User, error) {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return User{}, err
+	}
+	h, err := hash(password)
+	if err != nil {
+		return User{}, err
+	}
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return User{}, err
+	}
+	defer unlock()
+	us, err := s.read()
+	if err != nil {
+		return User{}, err
+	}
+	if indexOf(us, name) >= 0 {
+		return User{}, fmt.Errorf("%w: %v", ErrExists, name)
+	}
+	u := User{Name: name, Hash: h, Created: currentTime(), Admin: len(us) == 0}
+	return u, s.write(append(us, u))
+}
+
+// All returns all the users sorted by name.
+func (s *Store) All() ([]User, error) {
+	return s.read()
+}
+
+// Get returns a user by name.
+func (s *Store) Get(name string) (User, error) {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return User{}, err
+	}
+	us, err := s.read()
+	if err != nil {
+		return User{}, err
+	}
+	i := indexOf(us, name)
+	if i < 0 {
+		return User{}, fmt.Errorf("%w: %v", ErrNotFound, name)
+	}
+	return us[i], nil
+}
+
+// Authenticate returns the user name if password is its password,
+// ErrCredentials otherwise.
+func (s *Store) Authenticate(name, password string) (User, error) {
+	u, err := s.Get(name)
+	var verr *utils.ValidationError
+	if errors.Is(err, ErrNotFound) || errors.As(err, &verr) {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return User{}, ErrCredentials
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if bcrypt.CompareHashAndPassword(u.Hash, []byte(password)) != nil {
+		return User{}, ErrCredentials
+	}
+	return u, nil
+}
+
+// SetPassword changes the password of the user name.
+func (s *Store) SetPassword(name, password string) error {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return err
+	}
+	h, err := hash(password)
+	if err != nil {
+		return err
+	}
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	us, err := s.read()
+	if err != nil {
+		return err
+	}
+	i := indexOf(us, name)
+	if i < 0 {
+		return fmt.Errorf("%w: %v", ErrNotFound, name)
+	}
+	us[i].Hash = h
+	return s.write(us)
+}
+
+// SetAdmin makes the user name an administrator, or not.
+func (s *Store) SetAdmin(name string, admin bool) error {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return err
+	}
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	us, err := s.read()
+	if err != nil {
+		return err
+	}
+	i := indexOf(us, name)
+	if i < 0 {
+		return fmt.Errorf("%w: %v", ErrNotFound, name)
+	}
+	us[i].Admin = admin
+	return s.write(us)
+}
+
+// Delete deletes a user by name.
+// Deleting a user that does not exist is not an error.
+func (s *Store) Delete(name string) error {
+	name, err := utils.NormalizeName(name)
+	if err != nil {
+		return err
+	}
+	unlock, err := utils.LockDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	us, err := s.read()
+	if err != nil {
+		return err
+	}
+	i := indexOf(us, name)
+	if i < 0 {
+		return nil
+	}
+	return s.write(append(us[:i], us[i+1:]...))
+}
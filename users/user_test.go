@@ -0,0 +1,139 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package users
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scompo/data-management/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testTime = time.Now()
+
+func setup(t *testing.T) *Store {
+	currentTime = func() time.Time {
+		return testTime
+	}
+	cost = bcrypt.MinCost
+	t.Cleanup(func() {
+		currentTime = time.Now
+		cost = bcrypt.DefaultCost
+	})
+	return NewStore(t.TempDir())
+}
+
+func TestCreate(t *testing.T) {
+	s := setup(t)
+
+	u, err := s.Create("mauro", "a good password")
+	if err != nil {
+		t.Fatalf("Error creating: %v\n", err)
+	}
+	if u.Name != "mauro" || !testTime.Equal(u.Created) || string(u.Hash) == "a good password" || !u.Admin {
+		t.Errorf("wrong user created: %+v", u)
+	}
+	if _, err := s.Create("mauro", "another password"); !errors.Is(err, ErrExists) {
+		t.Errorf("no error for user name already existent: %v\n", err)
+	}
+	var nerr *utils.ValidationError
+	if _, err := s.Create("../escape", "a good password"); !errors.As(err, &nerr) {
+		t.Errorf("Expected validation error for the name: %v\n", err)
+	}
+	var verr *ValidationError
+	if _, err := s.Create("short", "short"); !errors.As(err, &verr) || verr.Field != "Password" {
+		t.Errorf("Expected validation error for the password: %v\n", err)
+	}
+	info, err := os.Stat(filepath.Join(s.Dir, fileName))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("the users file should be private: %v, %v", info, err)
+	}
+	if _, err := s.Get("nobody"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for user not existent: %v\n", err)
+	}
+}
+
+func TestSetAdmin(t *testing.T) {
+	s := setup(t)
+
+	for _, name := range []string{"mauro", "other"} {
+		if _, err := s.Create(name, "a good password"); err != nil {
+			t.Fatalf("Error creating: %v\n", err)
+		}
+	}
+	if u, _ := s.Get("other"); u.Admin {
+		t.Errorf("only the first user should be an administrator")
+	}
+	if err := s.SetAdmin("other", true); err != nil {
+		t.Errorf("Error setting the administrator: %v\n", err)
+	}
+	if u, _ := s.Get("other"); !u.Admin {
+		t.Errorf("the user should be an administrator")
+	}
+	if err := s.SetAdmin("nobody", true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error for user not existent: %v\n", err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := setup(t)
+
+	if _, err := s.Create("mauro", "a good password"); err != nil {
+		t.Fatalf("Error creating: %v\n", err)
+	}
+	if u, err := s.Authenticate("mauro", "a good password"); err != nil || u.Name != "mauro" {
+		t.Errorf("Error authenticating: %+v, %v\n", u, err)
+	}
+	for _, c := range [][2]string{{"mauro", "wrong password"}, {"nobody", "a good password"}, {"../x", "a good password"}} {
+		if _, err := s.Authenticate(c[0], c[1]); err != ErrCredentials {
+			t.Errorf("Expected wrong credentials for %v: %v\n", c, err)
+		}
+	}
+	if err := s.SetPassword("mauro", "a new password"); err != nil {
+		t.Errorf("Error changing the password: %v\n", err)
+	}
+	if _, err := s.Authenticate("mauro", "a good password"); err != ErrCredentials {
+		t.Errorf("the old password still works: %v\n", err)
+	}
+	if _, err := s.Authenticate("mauro", "a new password"); err != nil {
+		t.Errorf("Error authenticating with the new password: %v\n", err)
+	}
+	if err := s.Delete("mauro"); err != nil {
+		t.Errorf("Error deleting: %v\n", err)
+	}
+	if us, err := s.All(); err != nil || len(us) != 0 {
+		t.Errorf("Expected no users, but found %v, %v", us, err)
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+)
+
+// CSRFCookieName is the cookie holding the CSRF token of a browser.
+const CSRFCookieName = "csrf_token"
+
+// CSRFFieldName is the form field, or the header, where requests changing
+// something have to send back the CSRF token.
+const CSRFFieldName = "csrf_token"
+
+// CSRFHeaderName is the header alternative to CSRFFieldName, for scripts.
+const CSRFHeaderName = "X-CSRF-Token"
+
+type csrfKey struct{}
+
+// CSRFToken returns the CSRF token for the request, to put in the forms.
+// It's empty if the request has not gone through CSRF.
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey{}).(string)
+	return token
+}
+
+// safeMethod reports if method does not change anything.
+func safeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// crossSite reports if the browser tells that r comes from another site.
+func crossSite(r *http.Request) bool {
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != r.Host
+}
+
+// CrossSiteChange reports if r changes something and, according to the
+// browser, comes from another site.
+func CrossSiteChange(r *http.Request) bool {
+	return !safeMethod(r.Method) && crossSite(r)
+}
+
+// SameOrigin wraps h refusing the requests that change something and come
+// from another site, according to the browser.
+func SameOrigin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if CrossSiteChange(r) {
+			ErrorPage(w, r, http.StatusForbidden, "cross-site request refused")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// CSRF wraps h protecting it from cross-site request forgery.
+// Every browser gets a random token in a cookie, available to the handlers
+// with CSRFToken, and the requests that change something must send it
+// back in the CSRFFieldName form field or in the CSRFHeaderName header.
+// Requests coming from other sites are refused too, like SameOrigin does.
+func CSRF(h http.Handler) http.Handler {
+	return SameOrigin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if c, err := r.Cookie(CSRFCookieName); err == nil && len(c.Value) == 43 {
+			token = c.Value
+		}
+		if !safeMethod(r.Method) {
+			sent := r.Header.Get(CSRFHeaderName)
+			if sent == "" {
+				err := ParseForm(r)
+				if err != nil {
+					status, message := StatusOf(err)
+					ErrorPage(w, r, status, message)
+					return
+				}
+				sent = r.PostFormValue(CSRFFieldName)
+			}
+			if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				ErrorPage(w, r, http.StatusForbidden, "invalid or missing CSRF token, reload the page and try again")
+				return
+			}
+		}
+		if token == "" {
+			var b [32]byte
+			_, err := rand.Read(b[:])
+			if err != nil {
+				status, message := StatusOf(err)
+				ErrorPage(w, r, status, message)
+				return
+			}
+			token = base64.RawURLEncoding.EncodeToString(b[:])
+			http.SetCookie(w, &http.Cookie{
+				Name:     CSRFCookieName,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfKey{}, token)))
+	}))
+}
@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	var seen string
+	h := CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = CSRFToken(r)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CSRFCookieName || cookies[0].Value != seen || seen == "" {
+		t.Fatalf("token not handed out: %v, \"%v\"", cookies, seen)
+	}
+	token := cookies[0]
+
+	post := func(form url.Values, cookie *http.Cookie, header map[string]string) int {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		seen = ""
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	good := url.Values{CSRFFieldName: {token.Value}}
+	if code := post(good, token, nil); code != http.StatusOK || seen != token.Value {
+		t.Errorf("valid token refused: %v", code)
+	}
+	if code := post(url.Values{}, token, map[string]string{CSRFHeaderName: token.Value}); code != http.StatusOK {
+		t.Errorf("valid token in header refused: %v", code)
+	}
+	if code := post(url.Values{}, token, nil); code != http.StatusForbidden {
+		t.Errorf("missing token accepted: %v", code)
+	}
+	if code := post(url.Values{CSRFFieldName: {"wrong"}}, token, nil); code != http.StatusForbidden {
+		t.Errorf("wrong token accepted: %v", code)
+	}
+	if code := post(good, nil, nil); code != http.StatusForbidden {
+		t.Errorf("token without cookie accepted: %v", code)
+	}
+	if code := post(good, token, map[string]string{"Origin": "http://evil.example"}); code != http.StatusForbidden {
+		t.Errorf("cross-site origin accepted: %v", code)
+	}
+	if code := post(good, token, map[string]string{"Sec-Fetch-Site": "cross-site"}); code != http.StatusForbidden {
+		t.Errorf("cross-site request accepted: %v", code)
+	}
+	if code := post(good, token, map[string]string{"Origin": "http://example.com", "Sec-Fetch-Site": "same-origin"}); code != http.StatusOK {
+		t.Errorf("same-origin request refused: %v", code)
+	}
+}
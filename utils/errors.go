@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package utils
+
+import (
+	"net/http"
+)
+
+// Error is an error that knows the HTTP status to answer with, and a
+// message that is safe to show to the user.
+type Error struct {
+	Status  int
+	Message string
+	// Err is the error that caused this one, if any.
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the error that caused this one.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError returns an Error with the given status and message, caused by err.
+func NewError(status int, message string, err error) *Error {
+	return &Error{Status: status, Message: message, Err: err}
+}
+
+// NotFound returns an Error answering 404, with the message of err.
+func NotFound(err error) *Error {
+	return &Error{Status: http.StatusNotFound, Message: err.Error(), Err: err}
+}
+
+// Conflict returns an Error answering 409, with the message of err.
+func Conflict(err error) *Error {
+	return &Error{Status: http.StatusConflict, Message: err.Error(), Err: err}
+}
+
+// Forbidden returns an Error answering 403, with the message of err.
+func Forbidden(err error) *Error {
+	return &Error{Status: http.StatusForbidden, Message: err.Error(), Err: err}
+}
+
+// BadRequest returns an Error answering 400, with the message of err.
+func BadRequest(err error) *Error {
+	return &Error{Status: http.StatusBadRequest, Message: err.Error(), Err: err}
+}
+
+// MethodNotAllowed returns an Error answering 405 for method.
+func MethodNotAllowed(method string) *Error {
+	return &Error{Status: http.StatusMethodNotAllowed, Message: "method not supported, " + method}
+}
+
+// ErrorPage writes the answer for a failed request, with the status and the
+// message to show.
+// It defaults to a plain text answer, the application can replace it with
+// one rendering its own pages.
+var ErrorPage = func(w http.ResponseWriter, r *http.Request, status int, message string) {
+	http.Error(w, message, status)
+}
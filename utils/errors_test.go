@@ -0,0 +1,95 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatusOf(t *testing.T) {
+	cause := errors.New("cause")
+	tests := []struct {
+		err     error
+		status  int
+		message string
+	}{
+		{cause, http.StatusInternalServerError, "internal server error"},
+		{NotFound(cause), http.StatusNotFound, "cause"},
+		{Conflict(cause), http.StatusConflict, "cause"},
+		{BadRequest(cause), http.StatusBadRequest, "cause"},
+		{Forbidden(cause), http.StatusForbidden, "cause"},
+		{MethodNotAllowed("PUT"), http.StatusMethodNotAllowed, "method not supported, PUT"},
+		{NewError(http.StatusTeapot, "safe", cause), http.StatusTeapot, "safe"},
+		{fmt.Errorf("wrapped: %w", NotFound(cause)), http.StatusNotFound, "cause"},
+	}
+	for _, test := range tests {
+		status, message := StatusOf(test.err)
+		if status != test.status || message != test.message {
+			t.Errorf("Expected %v \"%v\", but was %v \"%v\"", test.status, test.message, status, message)
+		}
+	}
+	if !errors.Is(NotFound(cause), cause) {
+		t.Errorf("should unwrap to the cause")
+	}
+}
+
+func TestServeHTTPError(t *testing.T) {
+	w := httptest.NewRecorder()
+	AppHandler(func(w http.ResponseWriter, r *http.Request) error {
+		return NewError(http.StatusNotFound, "nothing here", errors.New("secret details"))
+	}).ServeHTTP(w, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("should return %v but returned %v\n", http.StatusNotFound, w.Code)
+	}
+	if b := w.Body.String(); !strings.Contains(b, "nothing here") || strings.Contains(b, "secret") {
+		t.Errorf("returned something else in the body: \"%v\"\n", b)
+	}
+}
+
+func TestErrorPage(t *testing.T) {
+	defer func(old func(http.ResponseWriter, *http.Request, int, string)) {
+		ErrorPage = old
+	}(ErrorPage)
+	ErrorPage = func(w http.ResponseWriter, r *http.Request, status int, message string) {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "<p>%v</p>", message)
+	}
+	w := httptest.NewRecorder()
+	AppHandler(failHandler).ServeHTTP(w, nil)
+	if b := w.Body.String(); b != "<p>internal server error</p>" {
+		t.Errorf("ErrorPage not used: \"%v\"\n", b)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package utils
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(path, []byte(content)); err != nil {
+			t.Errorf("Error writing: %v\n", err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil || string(data) != content {
+			t.Errorf("Expected \"%v\", but was \"%v\", %v", content, string(data), err)
+		}
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("temporary files left behind: %v\n", len(files))
+	}
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "file"), nil); err == nil {
+		t.Errorf("Expected error writing in a missing directory")
+	}
+}
+
+type failingReader struct{}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestWriteAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	n, err := WriteAtomic(path, strings.NewReader("content"))
+	if err != nil || n != 7 {
+		t.Errorf("Error writing: %v, %v\n", n, err)
+	}
+	if _, err := WriteAtomic(path, io.MultiReader(strings.NewReader("partial"), failingReader{})); err == nil {
+		t.Errorf("Expected error reading")
+	}
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != "content" {
+		t.Errorf("the file should not change on errors, but was \"%v\"", string(data))
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("temporary files left behind: %v\n", len(files))
+	}
+}
+
+func TestWritePrivateFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := WritePrivateFileAtomic(path, []byte("secret")); err != nil {
+		t.Errorf("Error writing: %v\n", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a private file, but was %v, %v", info, err)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package utils
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// LimitBody wraps h refusing the request bodies bigger than max bytes.
+// Handlers reading past the limit get an error, see TooLarge.
+func LimitBody(h http.Handler, max int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > max {
+			ErrorPage(w, r, http.StatusRequestEntityTooLarge, tooLargeMessage(max))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		h.ServeHTTP(w, r)
+	})
+}
+
+func tooLargeMessage(max int64) string {
+	return "request too large, the limit is " + strconv.FormatInt(max, 10) + " bytes"
+}
+
+// TooLarge returns an Error answering 413 if err is caused by a request body
+// over the limit of LimitBody, else err itself.
+func TooLarge(err error) error {
+	var merr *http.MaxBytesError
+	if errors.As(err, &merr) {
+		return NewError(http.StatusRequestEntityTooLarge, tooLargeMessage(merr.Limit), err)
+	}
+	return err
+}
+
+// maxMemory is how much of a multipart form is kept in memory, the rest
+// goes to temporary files.
+const maxMemory = 1 << 20
+
+// ParseForm parses the body of r, as a multipart form when it is one.
+// The errors answer 413 for bodies too large, else 400.
+func ParseForm(r *http.Request) error {
+	var err error
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt == "multipart/form-data" {
+		if r.MultipartForm != nil {
+			return nil
+		}
+		err = r.ParseMultipartForm(maxMemory)
+	} else {
+		err = r.ParseForm()
+	}
+	if err == nil {
+		return nil
+	}
+	if tooLarge := TooLarge(err); tooLarge != err {
+		return tooLarge
+	}
+	return BadRequest(err)
+}
@@ -0,0 +1,75 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitBody(t *testing.T) {
+	var form string
+	h := LimitBody(CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		form = r.FormValue("field")
+	})), 1024)
+	token := strings.Repeat("t", 43)
+
+	post := func(size int, length bool) int {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField(CSRFFieldName, token)
+		mw.WriteField("field", strings.Repeat("x", size))
+		mw.Close()
+		r := httptest.NewRequest("POST", "/", &body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		r.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: token})
+		if !length {
+			r.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		form = ""
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := post(10, true); code != http.StatusOK || form != strings.Repeat("x", 10) {
+		t.Errorf("multipart form refused: %v", code)
+	}
+	if code := post(2048, true); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a body too large, but was %v", code)
+	}
+	if code := post(2048, false); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a body too large without length, but was %v", code)
+	}
+}
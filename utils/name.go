@@ -0,0 +1,111 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxNameLength is the maximum number of characters in a name.
+const MaxNameLength = 64
+
+// deviceNames can't be used as names: some platforms don't allow them for
+// files.
+var deviceNames = []string{
+	"con", "prn", "aux", "nul",
+	"com1", "com2", "com3", "com4", "com5", "com6", "com7", "com8", "com9",
+	"lpt1", "lpt2", "lpt3", "lpt4", "lpt5", "lpt6", "lpt7", "lpt8", "lpt9",
+}
+
+// ValidationError is returned when a name is not acceptable.
+type ValidationError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid " + strings.ToLower(e.Field) + " \"" + e.Value + "\": " + e.Reason
+}
+
+// NormalizeName checks that name can be used as the name of a project, a
+// page, a user or anything else saved in a file named after it, and
+// returns it in Unicode normal form C, which is how it's saved.
+// Names can contain letters, digits, spaces, '-', '_' and '.', but can't
+// start with a '.' or a space nor end with a space. The reserved names,
+// like the files kept next to the named ones, can't be used either.
+// Returns a *ValidationError if the name is not valid.
+func NormalizeName(name string, reserved ...string) (string, error) {
+	invalid := func(reason string) (string, error) {
+		return "", &ValidationError{Field: "Name", Value: name, Reason: reason}
+	}
+	if !utf8.ValidString(name) {
+		return invalid("not valid UTF-8")
+	}
+	n := norm.NFC.String(name)
+	if n == "" {
+		return invalid("can't be empty")
+	}
+	if utf8.RuneCountInString(n) > MaxNameLength {
+		return invalid("longer than " + strconv.Itoa(MaxNameLength) + " characters")
+	}
+	for _, r := range n {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) &&
+			!strings.ContainsRune(" -_.", r) {
+			return invalid("can contain only letters, digits, spaces, '-', '_' and '.'")
+		}
+	}
+	if n[0] == '.' || n[0] == ' ' || n[len(n)-1] == ' ' {
+		return invalid("can't start with '.' or spaces, nor end with spaces")
+	}
+	lower := strings.ToLower(n)
+	// device names are reserved with any extension too.
+	device := lower
+	if i := strings.IndexByte(lower, '.'); i > 0 {
+		device = lower[:i]
+	}
+	for _, d := range deviceNames {
+		if lower == d || device == d {
+			return invalid("is a reserved name")
+		}
+	}
+	for _, r := range reserved {
+		if lower == strings.ToLower(r) {
+			return invalid("is a reserved name")
+		}
+	}
+	return n, nil
+}
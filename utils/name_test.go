@@ -0,0 +1,89 @@
+/*
+Copyright (c) 2016, Mauro Scomparin
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of data-management nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	valid := map[string]string{
+		"test":                             "test",
+		"my project 2":                     "my project 2",
+		"a-b_c.d":                          "a-b_c.d",
+		"cafe\u0301":                       "caf\u00e9",
+		"データ":                              "データ",
+		strings.Repeat("a", MaxNameLength): strings.Repeat("a", MaxNameLength),
+	}
+	for name, expected := range valid {
+		res, err := NormalizeName(name)
+		if err != nil {
+			t.Errorf("\"%v\" should be valid: %v\n", name, err)
+		}
+		if res != expected {
+			t.Errorf("Expected \"%v\", but was \"%v\"", expected, res)
+		}
+	}
+	invalid := []string{
+		"",
+		"..",
+		"../../etc",
+		"a/b",
+		"a\\b",
+		".hidden",
+		" leading",
+		"trailing ",
+		"tab\there",
+		"nul\x00",
+		"\xff",
+		strings.Repeat("a", MaxNameLength+1),
+		"CON",
+		"lpt1.txt",
+	}
+	for _, name := range invalid {
+		_, err := NormalizeName(name)
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("\"%v\" should not be valid, got %v\n", name, err)
+		}
+	}
+}
+
+func TestReservedName(t *testing.T) {
+	if _, err := NormalizeName("Index.json", "index.json"); err == nil {
+		t.Errorf("a reserved name should not be valid")
+	}
+	if _, err := NormalizeName("index.json"); err != nil {
+		t.Errorf("\"index.json\" should be valid: %v\n", err)
+	}
+}
@@ -31,20 +31,67 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 // Package utils contains utilities for the application
 package utils
 
-import "net/http"
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
 
 // AppHandler is a function that handes http request but can return an error.
 type AppHandler func(http.ResponseWriter, *http.Request) error
 
 // ServeHTTP implementation used to handle errors from the application.
-// if the fn returns an error an HTTP 500 is returned with the details of what's gone wrong.
+// if the fn returns an *Error its status and message are used, otherwise
+// an HTTP 500 is returned and the details of what's gone wrong are logged.
+// The answer is written by ErrorPage.
 func (fn AppHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err := fn(w, r); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		status, message := StatusOf(err)
+		ErrorPage(w, r, status, message)
 		return
 	}
 }
 
+// StatusOf returns the HTTP status and the message to answer with for err.
+// The errors that are not an *Error are unexpected: they are logged, and
+// the user only gets a generic message.
+func StatusOf(err error) (int, string) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Status, e.Message
+	}
+	log.Printf("internal server error: %v\n", err)
+	return http.StatusInternalServerError, "internal server error"
+}
+
+// APIHandler is like AppHandler, but it's meant for the json API: errors
+// are answered with a json body.
+type APIHandler func(http.ResponseWriter, *http.Request) error
+
+// ErrorBody is the json body answered by APIHandler when something goes
+// wrong.
+type ErrorBody struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// ServeHTTP implementation used to handle errors from the json API.
+func (fn APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := fn(w, r); err != nil {
+		status, message := StatusOf(err)
+		WriteJSON(w, status, ErrorBody{Status: status, Error: message})
+		return
+	}
+}
+
+// WriteJSON answers with status and v encoded as json.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
 // Config is a map of string to pointers of string used to save configurations
 // I need to add a validate method to make sure everything is fine.
 type Config map[string]*string
@@ -31,6 +31,7 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 package utils
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -61,11 +62,31 @@ func TestServeHTTP(t *testing.T) {
 	if w.Code != http.StatusInternalServerError {
 		t.Errorf("should return %v but returned %v\n", http.StatusInternalServerError, w.Code)
 	}
-	if b := w.Body.String(); !strings.Contains(b, "fail") {
+	if b := w.Body.String(); !strings.Contains(b, "internal server error") || strings.Contains(b, "fail") {
 		t.Errorf("returned something else in the body: \"%v\"\n", b)
 	}
 }
 
+func TestAPIHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	APIHandler(func(w http.ResponseWriter, r *http.Request) error {
+		return NotFound(errors.New("no such thing"))
+	}).ServeHTTP(w, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("should return %v but returned %v\n", http.StatusNotFound, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("should return json but returned \"%v\"\n", ct)
+	}
+	var body ErrorBody
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Errorf("Error decoding: %v\n", err)
+	}
+	if body.Status != http.StatusNotFound || body.Error != "no such thing" {
+		t.Errorf("returned something else in the body: %+v\n", body)
+	}
+}
+
 func TestCreateConfig(t *testing.T) {
 	res := CreateConfig("a", "b")
 	first, err := res["a"]